@@ -0,0 +1,294 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// Block is a rectangular selection. Lines are buffer lines and columns are
+// display columns, so the rectangle stays straight across wide characters and
+// may reach past the end of short lines.
+type Block struct {
+	Anchor Position
+	Head   Position
+}
+
+// bounds returns the rows top through bottom and the display columns
+// [left, right) the block covers.
+func (b Block) bounds() (top, bottom, left, right int) {
+	return min(b.Anchor.Line, b.Head.Line), max(b.Anchor.Line, b.Head.Line),
+		min(b.Anchor.Column, b.Head.Column), max(b.Anchor.Column, b.Head.Column)
+}
+
+// cellWidth is the number of screen cells a character takes.
+func cellWidth(r rune) int {
+	return max(lipgloss.Width(string(r)), 1)
+}
+
+// displayColumn is the display column of byte column col in line.
+func displayColumn(line string, col int) int {
+	w := 0
+	for _, r := range line[:min(col, len(line))] {
+		w += cellWidth(r)
+	}
+	return w
+}
+
+func displayWidth(s string) int {
+	return displayColumn(s, len(s))
+}
+
+// columnSpan maps the display columns [left, right) of line to the byte
+// columns [start, end). Wide characters partly inside the range are included.
+// pad is how many columns left lies past the end of the line.
+func columnSpan(line string, left, right int) (start, end, pad int) {
+	start, end = -1, len(line)
+	w := 0
+	for i, r := range line {
+		if start < 0 && w+cellWidth(r) > left {
+			start = i
+		}
+		if w >= right {
+			end = i
+			break
+		}
+		w += cellWidth(r)
+	}
+	if start < 0 {
+		return len(line), len(line), left - w
+	}
+	if left == right || end < start {
+		end = start
+	}
+	return start, end, 0
+}
+
+// replaceColumns replaces the display columns [left, right) of line with
+// text, padding a short line with spaces up to left first.
+func replaceColumns(line string, left, right int, text string) string {
+	start, end, pad := columnSpan(line, left, right)
+	if text == "" {
+		pad = 0
+	}
+	return line[:start] + strings.Repeat(" ", pad) + text + line[end:]
+}
+
+// GetBlock returns the block selection, or nil once the cursor has moved off
+// its head or another selection has replaced it.
+func (tb *TextBuffer) GetBlock() *Block {
+	tb.mu.RLock()
+	defer tb.mu.RUnlock()
+	if tb.block == nil || tb.cursor != tb.blockCursor || tb.selection != nil || len(tb.carets) > 0 {
+		return nil
+	}
+	b := *tb.block
+	return &b
+}
+
+// SetBlock makes b the selection and puts the cursor on its head, or as close
+// to it as the head line allows.
+func (tb *TextBuffer) SetBlock(b *Block) {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	tb.selection = nil
+	tb.carets = nil
+	tb.selectAllOriginalCursor = nil
+	line := tb.lines[tb.clampLine(b.Head.Line)]
+	start, _, _ := columnSpan(line, b.Head.Column, b.Head.Column)
+	tb.cursor = tb.clampPosition(Position{Line: b.Head.Line, Column: start})
+	tb.blockCursor = tb.cursor
+	block := *b
+	tb.block = &block
+}
+
+func (tb *TextBuffer) ClearBlock() {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	tb.block = nil
+}
+
+// BlockText returns the text inside the block, one string per row. Rows
+// shorter than the block are not padded.
+func (tb *TextBuffer) BlockText(b Block) []string {
+	tb.mu.RLock()
+	defer tb.mu.RUnlock()
+	top, bottom, left, right := b.bounds()
+	var rows []string
+	for line := top; line <= bottom && line < len(tb.lines); line++ {
+		start, end, _ := columnSpan(tb.lines[line], left, right)
+		rows = append(rows, tb.lines[line][start:end])
+	}
+	return rows
+}
+
+// ReplaceBlock replaces the display columns [left, right) of lines top
+// through bottom with text as a single undoable edit.
+func (tb *TextBuffer) ReplaceBlock(top, bottom, left, right int, text string) {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	tb.saveState()
+	for line := tb.clampLine(top); line <= bottom && line < len(tb.lines); line++ {
+		tb.lines[line] = replaceColumns(tb.lines[line], left, right, text)
+	}
+	tb.block = nil
+	tb.lastLineCount = len(tb.lines)
+	tb.lastContentHash = tb.calculateContentHash(tb.lines)
+}
+
+// InsertBlock inserts rows as a rectangle whose top left corner is at line
+// at.Line and display column at.Column, as a single undoable edit. Rows are
+// padded to the same width where text follows them, and lines are added past
+// the end of the buffer as needed. The cursor ends at the top left corner.
+func (tb *TextBuffer) InsertBlock(at Position, rows []string) error {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	if at.Line < 0 || at.Line >= len(tb.lines) || at.Column < 0 {
+		return fmt.Errorf("%w: block at line %d, column %d", ErrInvalidPosition, at.Line, at.Column)
+	}
+	tb.saveState()
+	width := 0
+	for _, row := range rows {
+		width = max(width, displayWidth(row))
+	}
+	for i, row := range rows {
+		line := at.Line + i
+		for line >= len(tb.lines) {
+			tb.lines = append(tb.lines, "")
+		}
+		if start, _, _ := columnSpan(tb.lines[line], at.Column, at.Column); start < len(tb.lines[line]) {
+			row += strings.Repeat(" ", width-displayWidth(row))
+		}
+		tb.lines[line] = replaceColumns(tb.lines[line], at.Column, at.Column, row)
+	}
+	start, _, _ := columnSpan(tb.lines[at.Line], at.Column, at.Column)
+	tb.cursor = Position{Line: at.Line, Column: start}
+	tb.selection = nil
+	tb.carets = nil
+	tb.block = nil
+	tb.lastLineCount = len(tb.lines)
+	tb.lastContentHash = tb.calculateContentHash(tb.lines)
+	return nil
+}
+
+func handleBlockUp(m Model, _ tea.KeyMsg) (tea.Model, tea.Cmd) {
+	return m.extendBlock(-1, 0)
+}
+
+func handleBlockDown(m Model, _ tea.KeyMsg) (tea.Model, tea.Cmd) {
+	return m.extendBlock(1, 0)
+}
+
+func handleBlockLeft(m Model, _ tea.KeyMsg) (tea.Model, tea.Cmd) {
+	return m.extendBlock(0, -1)
+}
+
+func handleBlockRight(m Model, _ tea.KeyMsg) (tea.Model, tea.Cmd) {
+	return m.extendBlock(0, 1)
+}
+
+// extendBlock moves the head of the block selection, starting one at the
+// cursor if there is none. The head may move past the end of the line.
+func (m Model) extendBlock(dLine, dCol int) (tea.Model, tea.Cmd) {
+	b := m.textBuffer.GetBlock()
+	if b == nil {
+		cursor := m.textBuffer.GetCursor()
+		head := Position{Line: cursor.Line, Column: displayColumn(m.textBuffer.GetLine(cursor.Line), cursor.Column)}
+		b = &Block{Anchor: head, Head: head}
+	}
+	b.Head.Line = clamp(b.Head.Line+dLine, 0, m.textBuffer.GetLineCount()-1)
+	b.Head.Column = max(b.Head.Column+dCol, 0)
+	m.textBuffer.SetBlock(b)
+	m.postMovementUpdate()
+	m.hintBlockSize(*b)
+	return m, nil
+}
+
+func (m *Model) hintBlockSize(b Block) {
+	top, bottom, left, right := b.bounds()
+	m.hint(fmt.Sprintf("Block %d×%d", bottom-top+1, right-left))
+}
+
+// handleBlockKey edits every row of the block: typing replaces the block and
+// leaves an empty block after the typed text, so typing continues on every
+// row, and Backspace and Delete remove the block or, when it is empty, the
+// column beside it. Keys it does not handle end the block selection.
+func (m Model) handleBlockKey(msg tea.KeyMsg, b Block) (tea.Model, tea.Cmd, bool) {
+	top, bottom, left, right := b.bounds()
+	var text string
+	switch msg.Type {
+	case tea.KeyEscape:
+		m.textBuffer.ClearBlock()
+		return m, nil, true
+	case tea.KeyBackspace:
+		if left == right {
+			if left == 0 {
+				return m, nil, true
+			}
+			left--
+		}
+	case tea.KeyDelete:
+		if left == right {
+			right++
+		}
+	case tea.KeyTab:
+		text = m.settings.IndentUnit()
+	case tea.KeySpace:
+		text = " "
+	case tea.KeyRunes:
+		if msg.Paste {
+			return m, nil, false
+		}
+		text = string(msg.Runes)
+	default:
+		return m, nil, false
+	}
+
+	m.textBuffer.ReplaceBlock(top, bottom, left, right, text)
+	col := left + displayWidth(text)
+	m.textBuffer.SetBlock(&Block{
+		Anchor: Position{Line: b.Anchor.Line, Column: col},
+		Head:   Position{Line: b.Head.Line, Column: col},
+	})
+	m.invalidateHighlightCache()
+	m.updateModified()
+	m.postMovementUpdate()
+	return m, nil, true
+}
+
+// copyBlock puts the rows of the block on the clipboard, one per line.
+func (m *Model) copyBlock(b Block, verb string) {
+	m.storeClipboard(KillEntry{Text: strings.Join(m.textBuffer.BlockText(b), "\n"), Block: true}, verb)
+}
+
+// pasteBlock inserts text as a rectangle: over the block selection if there
+// is one, otherwise at the cursor. A single line pasted over a block taller
+// than one row goes on every row.
+func (m *Model) pasteBlock(text string) error {
+	rows := strings.Split(text, "\n")
+	at := m.textBuffer.GetCursor()
+	at.Column = displayColumn(m.textBuffer.GetLine(at.Line), at.Column)
+
+	m.textBuffer.BeginUndoGroup()
+	defer m.textBuffer.EndUndoGroup()
+	if b := m.textBuffer.GetBlock(); b != nil {
+		top, bottom, left, right := b.bounds()
+		if left < right {
+			m.textBuffer.ReplaceBlock(top, bottom, left, right, "")
+		}
+		at = Position{Line: top, Column: left}
+		if len(rows) == 1 {
+			rows = slices.Repeat(rows[:1], bottom-top+1)
+		}
+	}
+	if err := m.textBuffer.InsertBlock(at, rows); err != nil {
+		return err
+	}
+	m.yankState = yankState{}
+	m.invalidateHighlightCache()
+	m.updateModified()
+	return nil
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// Bindings may be key sequences such as "ctrl+x ctrl+s": keys separated by
+// spaces. While a sequence is only partially typed the keys pressed so far
+// are held in Model.pendingKeys until a binding completes, an unbound key is
+// pressed, or the chord timeout expires.
+
+const (
+	defaultChordTimeout  = 2 * time.Second
+	defaultWhichKeyDelay = 500 * time.Millisecond
+	maxWhichKeyRows      = 8
+)
+
+type chordTimeoutMsg struct {
+	seq int
+}
+
+type whichKeyMsg struct {
+	seq int
+}
+
+// whichKeyEntry is one possible continuation of the pending prefix.
+type whichKeyEntry struct {
+	key  string
+	desc string
+}
+
+// matchKeySequence looks up the typed sequence. It returns the command of a
+// binding that matches exactly, or reports whether the sequence is a prefix
+// of at least one longer binding.
+func matchKeySequence(seq []string) (*Command, bool) {
+	typed := strings.Join(seq, " ")
+	prefix := false
+	for _, action := range keys.actions() {
+		exact, isPrefix := bindingMatch(*action.binding, typed)
+		if exact {
+			if cmd, ok := commands.Lookup(action.name); ok {
+				return cmd, false
+			}
+		}
+		prefix = prefix || isPrefix
+	}
+	return nil, prefix
+}
+
+// bindingMatch reports whether the typed sequence is one of b's keys, or the
+// start of a longer one.
+func bindingMatch(b key.Binding, typed string) (exact, prefix bool) {
+	if !b.Enabled() {
+		return false, false
+	}
+	for _, k := range b.Keys() {
+		if k == typed {
+			exact = true
+		}
+		if strings.HasPrefix(k, typed+" ") {
+			prefix = true
+		}
+	}
+	return exact, prefix
+}
+
+// matchBindingKeys feeds a key press through the pending keys like
+// handleKeySequence, but against b alone. Overlays and prompts read most keys
+// themselves and use it for the bindings they still honour, which may be
+// chords. It reports whether b was completed and whether the key was held as
+// the start of it; a key that is neither is left for the caller.
+func (m Model) matchBindingKeys(msg tea.KeyMsg, b key.Binding) (Model, tea.Cmd, bool, bool) {
+	seq := make([]string, 0, len(m.pendingKeys)+1)
+	seq = append(seq, m.pendingKeys...)
+	seq = append(seq, msg.String())
+
+	exact, prefix := bindingMatch(b, strings.Join(seq, " "))
+	switch {
+	case exact:
+		m.clearPendingKeys()
+		return m, nil, true, false
+	case prefix:
+		next, cmd := m.beginPendingKeys(seq)
+		return next.(Model), cmd, false, true
+	}
+	m.clearPendingKeys()
+	return m, nil, false, false
+}
+
+// handleKeySequence feeds a key press through the chord matcher. It reports
+// false when the key is not part of any binding and should be handled as
+// plain editing input.
+func (m Model) handleKeySequence(msg tea.KeyMsg) (tea.Model, tea.Cmd, bool) {
+	seq := make([]string, 0, len(m.pendingKeys)+1)
+	seq = append(seq, m.pendingKeys...)
+	seq = append(seq, msg.String())
+
+	command, isPrefix := matchKeySequence(seq)
+	switch {
+	case command != nil:
+		m.clearPendingKeys()
+		next, cmd := m.runCommand(command, msg)
+		return next, cmd, true
+	case isPrefix:
+		next, cmd := m.beginPendingKeys(seq)
+		return next, cmd, true
+	case len(m.pendingKeys) > 0:
+		m.clearPendingKeys()
+		if msg.Type != tea.KeyEscape {
+			m.notify(MessageWarning, strings.Join(seq, " ")+" is undefined")
+		}
+		return m, nil, true
+	}
+	return m, nil, false
+}
+
+func (m Model) beginPendingKeys(seq []string) (tea.Model, tea.Cmd) {
+	m.pendingKeys = seq
+	m.pendingKeysSeq++
+	m.showWhichKey = false
+
+	id := m.pendingKeysSeq
+	return m, tea.Batch(
+		tea.Tick(m.config.WhichKeyDelay(), func(time.Time) tea.Msg { return whichKeyMsg{seq: id} }),
+		tea.Tick(m.config.ChordTimeout(), func(time.Time) tea.Msg { return chordTimeoutMsg{seq: id} }),
+	)
+}
+
+func (m *Model) clearPendingKeys() {
+	if len(m.pendingKeys) == 0 && !m.showWhichKey {
+		return
+	}
+	m.pendingKeys = nil
+	m.pendingKeysSeq++
+	m.showWhichKey = false
+}
+
+// whichKeyEntries lists the keys that can follow the pending prefix.
+func (m Model) whichKeyEntries() []whichKeyEntry {
+	typed := strings.Join(m.pendingKeys, " ") + " "
+	var entries []whichKeyEntry
+	for _, action := range keys.actions() {
+		if !action.binding.Enabled() {
+			continue
+		}
+		for _, k := range action.binding.Keys() {
+			rest, ok := strings.CutPrefix(k, typed)
+			if !ok {
+				continue
+			}
+			next, more, _ := strings.Cut(rest, " ")
+			desc := action.binding.Help().Desc
+			if more != "" {
+				desc = fmt.Sprintf("%s (%s …)", desc, next)
+			}
+			entries = append(entries, whichKeyEntry{key: next, desc: desc})
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].key < entries[j].key })
+	return entries
+}
+
+func (m Model) getWhichKeyHeight() int {
+	if !m.showWhichKey {
+		return 0
+	}
+	rows := min(len(m.whichKeyEntries()), maxWhichKeyRows)
+	return rows + 1 // header
+}
+
+// renderWhichKey draws the continuation popup shown above the status bar.
+func (m Model) renderWhichKey() string {
+	entries := m.whichKeyEntries()
+	var lines []string
+	lines = append(lines, minibufferPromptStyle.Render(strings.Join(m.pendingKeys, " ")+" …"))
+
+	shown := min(len(entries), maxWhichKeyRows)
+	for _, e := range entries[:shown] {
+		k := lipgloss.NewStyle().Width(14).Render(helpKeyStyle.Render(e.key))
+		lines = append(lines, "  "+k+" "+helpDescStyle.Render(e.desc))
+	}
+	if len(entries) > shown {
+		lines[len(lines)-1] = helpStyle.Render(fmt.Sprintf("  … %d more", len(entries)-shown+1))
+	}
+
+	return minibufferStyle.Width(m.width - 2).Render(strings.Join(lines, "\n"))
+}
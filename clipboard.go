@@ -0,0 +1,185 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/aymanbagabas/go-osc52/v2"
+)
+
+// errPasteUnsupported is returned by providers that can only write, such as
+// OSC 52. Paste then falls back to the internal clipboard.
+var errPasteUnsupported = errors.New("paste is not supported")
+
+// ClipboardProvider moves text to and from a system clipboard.
+type ClipboardProvider interface {
+	Name() string
+	Copy(text string) error
+	Paste() (string, error)
+}
+
+// commandProvider shells out to a pair of clipboard tools.
+type commandProvider struct {
+	name  string
+	copy  []string
+	paste []string
+	// copyArg passes the text as the last argument instead of on stdin.
+	copyArg bool
+}
+
+func (p commandProvider) Name() string { return p.name }
+
+func (p commandProvider) Copy(text string) error {
+	args := p.copy[1:]
+	if p.copyArg {
+		args = append(append([]string(nil), args...), text)
+	}
+	cmd := exec.Command(p.copy[0], args...)
+	if !p.copyArg {
+		cmd.Stdin = strings.NewReader(text)
+	}
+	return cmd.Run()
+}
+
+func (p commandProvider) Paste() (string, error) {
+	output, err := exec.Command(p.paste[0], p.paste[1:]...).Output()
+	if err != nil {
+		return "", err
+	}
+	// PowerShell adds a trailing CRLF
+	return strings.TrimSuffix(string(output), "\r\n"), nil
+}
+
+// available reports whether the provider's tools are installed.
+func (p commandProvider) available() bool {
+	for _, tool := range []string{p.copy[0], p.paste[0]} {
+		if _, err := exec.LookPath(tool); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// osc52Provider asks the terminal to set the clipboard with an OSC 52
+// escape sequence, which also works over SSH. Terminals do not allow reading
+// the clipboard back this way.
+type osc52Provider struct{}
+
+func (osc52Provider) Name() string { return "osc52" }
+
+func (osc52Provider) Copy(text string) error {
+	seq := osc52.New(text)
+	if os.Getenv("TMUX") != "" {
+		seq = seq.Tmux()
+	} else if strings.HasPrefix(os.Getenv("TERM"), "screen") {
+		seq = seq.Screen()
+	}
+	// One write, so the sequence cannot be split by a frame
+	_, err := io.WriteString(programOutput, seq.String())
+	return err
+}
+
+// programOutput is the stdout the program renders to. Writes are serialized,
+// so text written to it outside the renderer, such as an OSC 52 sequence,
+// lands between two frames instead of inside one.
+var programOutput = &syncOutput{file: os.Stdout}
+
+// syncOutput locks around each write to a terminal file. It keeps the Fd
+// method, so the program still sees a terminal and can query its size.
+type syncOutput struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+func (o *syncOutput) Write(p []byte) (int, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.file.Write(p)
+}
+
+func (o *syncOutput) Read(p []byte) (int, error) { return o.file.Read(p) }
+func (o *syncOutput) Close() error               { return o.file.Close() }
+func (o *syncOutput) Fd() uintptr                { return o.file.Fd() }
+
+func (osc52Provider) Paste() (string, error) { return "", errPasteUnsupported }
+
+// internalProvider keeps text inside the editor only.
+type internalProvider struct{}
+
+func (internalProvider) Name() string           { return "internal" }
+func (internalProvider) Copy(string) error      { return nil }
+func (internalProvider) Paste() (string, error) { return "", errPasteUnsupported }
+
+var clipboardCommands = map[string]commandProvider{
+	"wl-clipboard": {name: "wl-clipboard", copy: []string{"wl-copy"}, paste: []string{"wl-paste", "--no-newline"}},
+	"xclip":        {name: "xclip", copy: []string{"xclip", "-selection", "clipboard"}, paste: []string{"xclip", "-selection", "clipboard", "-o"}},
+	"xsel":         {name: "xsel", copy: []string{"xsel", "--clipboard", "--input"}, paste: []string{"xsel", "--clipboard", "--output"}},
+	"tmux":         {name: "tmux", copy: []string{"tmux", "load-buffer", "-w", "-"}, paste: []string{"tmux", "save-buffer", "-"}},
+	"pbcopy":       {name: "pbcopy", copy: []string{"pbcopy"}, paste: []string{"pbpaste"}},
+	"powershell": {name: "powershell", copy: []string{"powershell", "-command", "Set-Clipboard -Value $args[0]"},
+		paste: []string{"powershell", "-command", "Get-Clipboard"}, copyArg: true},
+}
+
+// clipboardProviderNames lists the values accepted by the clipboard setting.
+func clipboardProviderNames() []string {
+	return []string{"auto", "wl-clipboard", "xclip", "xsel", "tmux", "osc52", "pbcopy", "powershell", "internal"}
+}
+
+// newClipboardProvider returns the named provider, detecting one for "auto"
+// or an empty name.
+func newClipboardProvider(name string) (ClipboardProvider, error) {
+	switch name {
+	case "", "auto":
+		return detectClipboardProvider(os.Getenv), nil
+	case "osc52":
+		return osc52Provider{}, nil
+	case "internal":
+		return internalProvider{}, nil
+	}
+	if p, ok := clipboardCommands[name]; ok {
+		return p, nil
+	}
+	return detectClipboardProvider(os.Getenv), fmt.Errorf("unknown clipboard %q (want %s)", name, strings.Join(clipboardProviderNames(), ", "))
+}
+
+// detectClipboardProvider picks the platform tool, then on Linux and other
+// Unix systems Wayland, X11 and tmux tools in that order. Over SSH, or when
+// no tool is installed, it uses OSC 52 if there is a terminal to write to.
+func detectClipboardProvider(getenv func(string) string) ClipboardProvider {
+	switch runtime.GOOS {
+	case "windows":
+		return clipboardCommands["powershell"]
+	case "darwin":
+		if getenv("SSH_TTY") == "" {
+			return clipboardCommands["pbcopy"]
+		}
+	}
+
+	remote := getenv("SSH_TTY") != "" || getenv("SSH_CONNECTION") != ""
+	var candidates []string
+	if getenv("WAYLAND_DISPLAY") != "" {
+		candidates = append(candidates, "wl-clipboard")
+	}
+	if getenv("DISPLAY") != "" && !remote {
+		candidates = append(candidates, "xclip", "xsel")
+	}
+	if getenv("TMUX") != "" {
+		candidates = append(candidates, "tmux")
+	}
+	for _, name := range candidates {
+		if p := clipboardCommands[name]; p.available() {
+			return p
+		}
+	}
+
+	if term := getenv("TERM"); term != "" && term != "dumb" {
+		return osc52Provider{}
+	}
+	return internalProvider{}
+}
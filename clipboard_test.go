@@ -0,0 +1,124 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/aymanbagabas/go-osc52/v2"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// stubClipboard is a system clipboard holding text, whose Copy fails with
+// copyErr.
+type stubClipboard struct {
+	text    string
+	copyErr error
+}
+
+func (c *stubClipboard) Name() string { return "stub" }
+
+func (c *stubClipboard) Copy(text string) error {
+	if c.copyErr != nil {
+		return c.copyErr
+	}
+	c.text = text
+	return nil
+}
+
+func (c *stubClipboard) Paste() (string, error) { return c.text, nil }
+
+func TestPaste(t *testing.T) {
+	tests := []struct {
+		name      string
+		sensitive bool
+		copyErr   error
+		kill      bool   // the copy is a kill that never reaches the system
+		later     string // text another program copies after the copy
+		want      string
+	}{
+		{name: "mirrored copy", want: "secret secret"},
+		{name: "sensitive buffer", sensitive: true, want: "secret secret"},
+		{name: "failed copy", copyErr: errors.New("no display"), want: "secret secret"},
+		{name: "kill", kill: true, want: "secret secret"},
+		{name: "later copy elsewhere", later: "other", want: "secret other"},
+		{name: "copy elsewhere after a kill", kill: true, later: "other", want: "secret other"},
+		{name: "copy elsewhere after a failed copy", copyErr: errors.New("no display"), later: "other", want: "secret other"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTestModel(t, "", nil)
+			clip := &stubClipboard{text: "stale", copyErr: tt.copyErr}
+			m.clipboardProvider = clip
+			m.sensitive = tt.sensitive
+			m.textBuffer.SetContent("secret ")
+			if tt.kill {
+				m.kill("secret", false)
+			} else {
+				m.textBuffer.SetSelection(&Selection{Start: Position{}, End: Position{Column: 6}})
+				next, _ := m.handleCopy()
+				m = next.(Model)
+			}
+			if tt.later != "" {
+				clip.text = tt.later
+			}
+
+			m.textBuffer.ClearSelection()
+			m.textBuffer.SetCursor(Position{Column: 7})
+			next, _ := handlePaste(m, tea.KeyMsg{})
+			if got := next.(Model).textBuffer.GetContent(); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClipboardHistoryFilterSkipsSensitiveText(t *testing.T) {
+	m := newTestModel(t, "", nil)
+	m.killRing.push(KillEntry{Text: "hunter2", Sensitive: true})
+	m.killRing.push(KillEntry{Text: "hunter of words"})
+	m.minibufferType = MinibufferClipboardHistory
+
+	tests := []struct {
+		filter string
+		want   []string
+	}{
+		{"", []string{"hunter of words", "hunter2"}},
+		{"hunter", []string{"hunter of words"}},
+		{"hunter2", nil},
+		{"2", []string{"hunter2"}},
+	}
+	for _, tt := range tests {
+		m.minibufferInput = tt.filter
+		var got []string
+		for _, item := range m.clipboardItems() {
+			got = append(got, item.entry.Text)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("filter %q: got %q, want %q", tt.filter, got, tt.want)
+		}
+	}
+}
+
+func TestOSC52WritesToProgramOutput(t *testing.T) {
+	t.Setenv("TMUX", "")
+	t.Setenv("TERM", "xterm")
+	path := filepath.Join(t.TempDir(), "out")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	stdout := programOutput.file
+	programOutput.file = f
+	t.Cleanup(func() { programOutput.file = stdout })
+
+	if err := (osc52Provider{}).Copy("hi"); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != osc52.New("hi").String() {
+		t.Fatalf("program output got %q", data)
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/muesli/termenv"
+)
+
+// ColorMode is the color depth the terminal supports. Both the lipgloss
+// styles and the chroma formatter are rendered at this depth.
+type ColorMode int
+
+const (
+	ColorNone ColorMode = iota
+	Color16
+	Color256
+	ColorTrue
+)
+
+func (c ColorMode) String() string {
+	switch c {
+	case Color16:
+		return "16"
+	case Color256:
+		return "256"
+	case ColorTrue:
+		return "truecolor"
+	}
+	return "none"
+}
+
+// colorMode is set once at startup from the environment or --color.
+var colorMode = Color256
+
+// parseColorMode reads a --color value. "auto" and "" defer to detection.
+func parseColorMode(value string) (ColorMode, bool, error) {
+	switch strings.ToLower(value) {
+	case "", "auto":
+		return 0, false, nil
+	case "none", "never", "off", "mono":
+		return ColorNone, true, nil
+	case "16", "ansi":
+		return Color16, true, nil
+	case "256", "ansi256":
+		return Color256, true, nil
+	case "truecolor", "24bit", "16m":
+		return ColorTrue, true, nil
+	}
+	return 0, false, fmt.Errorf("unknown color mode %q (want auto, none, 16, 256 or truecolor)", value)
+}
+
+// detectColorMode picks the color depth from NO_COLOR, COLORTERM and TERM,
+// following https://no-color.org for NO_COLOR.
+func detectColorMode(getenv func(string) string) ColorMode {
+	if getenv("NO_COLOR") != "" {
+		return ColorNone
+	}
+	switch strings.ToLower(getenv("COLORTERM")) {
+	case "truecolor", "24bit":
+		return ColorTrue
+	}
+
+	term := strings.ToLower(getenv("TERM"))
+	switch {
+	case term == "dumb":
+		return ColorNone
+	case strings.Contains(term, "truecolor"), strings.Contains(term, "direct"):
+		return ColorTrue
+	case strings.Contains(term, "256color"):
+		return Color256
+	case term == "" && runtime.GOOS == "windows":
+		// Windows Terminal sets WT_SESSION; the classic console handles 256 colors
+		if getenv("WT_SESSION") != "" {
+			return ColorTrue
+		}
+		return Color256
+	case term == "":
+		return ColorNone
+	}
+	return Color16
+}
+
+// setupColors resolves the color mode from the --color flag and the
+// environment and applies it to lipgloss. The chroma formatter follows it
+// through chromaFormatter.
+func setupColors(flagValue string) error {
+	mode, forced, err := parseColorMode(flagValue)
+	if err != nil {
+		return err
+	}
+	if !forced {
+		mode = detectColorMode(os.Getenv)
+	}
+	colorMode = mode
+	lipgloss.SetColorProfile(mode.profile())
+	return nil
+}
+
+// profile is the lipgloss profile for the mode. The Ascii profile would also
+// drop reverse video and underline, so monochrome renders as 16 colors and
+// View strips the colors afterwards with stripColors.
+func (c ColorMode) profile() termenv.Profile {
+	switch c {
+	case Color256:
+		return termenv.ANSI256
+	case ColorTrue:
+		return termenv.TrueColor
+	}
+	return termenv.ANSI
+}
+
+var sgrPattern = regexp.MustCompile(`\x1b\[([0-9;]*)m`)
+
+// stripColors removes the color parameters from SGR sequences, keeping
+// attributes such as bold, underline and reverse video.
+func stripColors(s string) string {
+	return sgrPattern.ReplaceAllStringFunc(s, func(seq string) string {
+		params := sgrPattern.FindStringSubmatch(seq)[1]
+		if params == "" {
+			return seq
+		}
+		parts := strings.Split(params, ";")
+		var kept []string
+		for i := 0; i < len(parts); i++ {
+			n, err := strconv.Atoi(parts[i])
+			if err != nil {
+				continue
+			}
+			switch {
+			case n == 38 || n == 48:
+				// Extended color: 5;n or 2;r;g;b
+				if i+1 < len(parts) && parts[i+1] == "5" {
+					i += 2
+				} else if i+1 < len(parts) && parts[i+1] == "2" {
+					i += 4
+				}
+			case (n >= 30 && n <= 37) || n == 39 || (n >= 40 && n <= 47) || n == 49,
+				(n >= 90 && n <= 97) || (n >= 100 && n <= 107):
+			default:
+				kept = append(kept, parts[i])
+			}
+		}
+		if len(kept) == 0 {
+			return ""
+		}
+		return "\x1b[" + strings.Join(kept, ";") + "m"
+	})
+}
+
+// chromaFormatter names the chroma formatter for the color mode. Without
+// color the noop formatter passes the text through unstyled.
+func (c ColorMode) chromaFormatter() string {
+	switch c {
+	case Color16:
+		return "terminal16"
+	case Color256:
+		return "terminal256"
+	case ColorTrue:
+		return "terminal16m"
+	}
+	return "noop"
+}
+
+// applyMonochromeStyles replaces colors that carry meaning with attributes a
+// monochrome terminal can still show: the selection and status bar in
+// reverse video, the cursor underlined on top of that so it stands out
+// inside a selection, and word highlights in bold.
+func applyMonochromeStyles() {
+	selectedTextStyle = lipgloss.NewStyle().Reverse(true)
+	cursorStyle = lipgloss.NewStyle().Reverse(true).Underline(true)
+	cursorLineStyle = lipgloss.NewStyle()
+	wordHighlightStyle = lipgloss.NewStyle().Bold(true)
+	statusBarStyle = statusBarStyle.UnsetBackground().UnsetForeground().Reverse(true)
+	minibufferStyle = minibufferStyle.UnsetBackground().UnsetForeground()
+	minibufferCursorStyle = lipgloss.NewStyle().Reverse(true)
+	searchResultSelectedStyle = lipgloss.NewStyle().Reverse(true).Bold(true)
+	rulerStyle = lipgloss.NewStyle()
+	flashErrorStyle = flashErrorStyle.Bold(true)
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// Command is a named editor action. Key bindings, the command palette and
+// config-defined commands all resolve to entries in the command registry, and
+// the command name doubles as the action name used in [keybindings].
+type Command struct {
+	Name        string
+	Description string
+	// Category groups the command in the help overlay and --keys output.
+	Category string
+	Run      keyHandler
+	// Requires lists the conditions that must hold for the command to run.
+	Requires []Predicate
+	// Keys are default bindings for commands that have no built-in binding.
+	Keys []string
+
+	fromConfig bool
+}
+
+// Predicate gates a command on the current editor state.
+type Predicate struct {
+	Reason string // shown when the check fails
+	Check  func(m Model) bool
+}
+
+var (
+	requiresSelection = Predicate{"requires a selection", func(m Model) bool {
+		return m.textBuffer.HasSelection()
+	}}
+	requiresSelectionOrBlock = Predicate{"requires a selection", func(m Model) bool {
+		return m.textBuffer.HasSelection() || m.textBuffer.GetBlock() != nil
+	}}
+	requiresUnlocked = Predicate{"buffer is locked", func(m Model) bool {
+		return !m.isLocked()
+	}}
+	requiresSearch = Predicate{"no previous search", func(m Model) bool {
+		return m.lastSearchQuery != "" || len(m.findResults) > 0
+	}}
+)
+
+// disabledReason returns why the command cannot run, or "" if it can.
+func (c *Command) disabledReason(m Model) string {
+	for _, p := range c.Requires {
+		if !p.Check(m) {
+			return p.Reason
+		}
+	}
+	return ""
+}
+
+// CommandRegistry holds every command in registration order.
+type CommandRegistry struct {
+	byName map[string]*Command
+	order  []string
+}
+
+var commands = &CommandRegistry{byName: make(map[string]*Command)}
+
+// RegisterCommand adds a command to the global registry. Plugins call this
+// from an init function; names must be unique.
+func RegisterCommand(cmd Command) error {
+	return commands.Register(cmd)
+}
+
+func (r *CommandRegistry) Register(cmd Command) error {
+	if cmd.Name == "" {
+		return fmt.Errorf("command has no name")
+	}
+	if cmd.Run == nil {
+		return fmt.Errorf("command %q has no handler", cmd.Name)
+	}
+	if _, exists := r.byName[cmd.Name]; exists {
+		return fmt.Errorf("command %q is already registered", cmd.Name)
+	}
+	r.byName[cmd.Name] = &cmd
+	r.order = append(r.order, cmd.Name)
+	return nil
+}
+
+func (r *CommandRegistry) Lookup(name string) (*Command, bool) {
+	cmd, ok := r.byName[name]
+	return cmd, ok
+}
+
+// All returns the registered commands in registration order.
+func (r *CommandRegistry) All() []*Command {
+	all := make([]*Command, 0, len(r.order))
+	for _, name := range r.order {
+		all = append(all, r.byName[name])
+	}
+	return all
+}
+
+// removeConfigCommands drops commands defined by a previous config so a
+// reload can register the new set.
+func (r *CommandRegistry) removeConfigCommands() {
+	kept := r.order[:0]
+	for _, name := range r.order {
+		if r.byName[name].fromConfig {
+			delete(r.byName, name)
+			continue
+		}
+		kept = append(kept, name)
+	}
+	r.order = kept
+}
+
+func init() {
+	for _, cmd := range builtinCommands() {
+		if err := commands.Register(cmd); err != nil {
+			panic(err)
+		}
+	}
+}
+
+func builtinCommands() []Command {
+	return []Command{
+		{Name: "quit", Category: "File", Description: "Quit the editor", Run: handleQuit},
+		{Name: "save", Category: "File", Description: "Save the file", Run: handleSave, Requires: []Predicate{requiresUnlocked}},
+		{Name: "help", Category: "General", Description: "Toggle the help overlay", Run: handleHelp},
+		{Name: "palette", Category: "General", Description: "Open the command palette", Run: handleCommandPalette},
+		{Name: "commandLine", Category: "General", Description: "Open the ex command line", Run: handleCommandLine},
+		{Name: "goto", Category: "Navigation", Description: "Go to line", Run: handleGoToLine},
+		{Name: "find", Category: "Search", Description: "Find text", Run: handleFind},
+		{Name: "findNext", Category: "Search", Description: "Jump to the next search result", Run: handleFindNext, Requires: []Predicate{requiresSearch}},
+		{Name: "findPrev", Category: "Search", Description: "Jump to the previous search result", Run: handleFindPrev, Requires: []Predicate{requiresSearch}},
+		{Name: "copy", Category: "Edit", Description: "Copy the selection", Run: handleCopy, Requires: []Predicate{requiresSelectionOrBlock}},
+		{Name: "cut", Category: "Edit", Description: "Cut the selection", Run: handleCut, Requires: []Predicate{requiresSelectionOrBlock}},
+		{Name: "paste", Category: "Edit", Description: "Paste from the clipboard", Run: handlePaste},
+		{Name: "yankPop", Category: "Edit", Description: "Replace the text just pasted with the previous clipboard entry", Run: handleYankPop, Keys: []string{"alt+y"}},
+		{Name: "clipboardHistory", Category: "Edit", Description: "Pick a clipboard history entry or register to paste", Run: handleClipboardHistory},
+		{Name: "copyToRegister", Category: "Edit", Description: "Copy the selection to a named register", Run: handleCopyToRegister, Requires: []Predicate{requiresSelection}},
+		{Name: "insertRegister", Category: "Edit", Description: "Insert the text of a named register", Run: handleInsertRegister},
+		{Name: "undo", Category: "Edit", Description: "Undo the last change", Run: handleUndo},
+		{Name: "redo", Category: "Edit", Description: "Redo the last undone change", Run: handleRedo},
+		{Name: "moveLinesUp", Category: "Edit", Description: "Move the current or selected lines up", Run: handleMoveLinesUp, Requires: []Predicate{requiresUnlocked}, Keys: []string{"alt+up"}},
+		{Name: "moveLinesDown", Category: "Edit", Description: "Move the current or selected lines down", Run: handleMoveLinesDown, Requires: []Predicate{requiresUnlocked}, Keys: []string{"alt+down"}},
+		{Name: "duplicateLines", Category: "Edit", Description: "Duplicate the current or selected lines", Run: handleDuplicateLines, Requires: []Predicate{requiresUnlocked}, Keys: []string{"alt+d"}},
+		{Name: "deleteLines", Category: "Edit", Description: "Delete the current or selected lines", Run: handleDeleteLines, Requires: []Predicate{requiresUnlocked}, Keys: []string{"alt+k"}},
+		{Name: "joinLines", Category: "Edit", Description: "Join the selected lines, or the current line with the next", Run: handleJoinLines, Requires: []Predicate{requiresUnlocked}, Keys: []string{"alt+j"}},
+		{Name: "insertLineAbove", Category: "Edit", Description: "Open a new line above the current line", Run: handleInsertLineAbove, Requires: []Predicate{requiresUnlocked}, Keys: []string{"alt+O"}},
+		{Name: "insertLineBelow", Category: "Edit", Description: "Open a new line below the current line", Run: handleInsertLineBelow, Requires: []Predicate{requiresUnlocked}, Keys: []string{"alt+o"}},
+		{Name: "transposeLines", Category: "Edit", Description: "Swap the current line with the line above", Run: handleTransposeLines, Requires: []Predicate{requiresUnlocked}, Keys: []string{"alt+t"}},
+		{Name: "indentLines", Category: "Edit", Description: "Indent the current or selected lines", Run: handleIndentLines, Requires: []Predicate{requiresUnlocked}},
+		{Name: "outdentLines", Category: "Edit", Description: "Outdent the current or selected lines", Run: handleOutdentLines, Requires: []Predicate{requiresUnlocked}},
+		{Name: "indentToSpaces", Category: "Edit", Description: "Convert the buffer's indentation to spaces", Run: handleIndentToSpaces, Requires: []Predicate{requiresUnlocked}},
+		{Name: "indentToTabs", Category: "Edit", Description: "Convert the buffer's indentation to tabs", Run: handleIndentToTabs, Requires: []Predicate{requiresUnlocked}},
+		{Name: "sortLines", Category: "Edit", Description: "Sort the selected lines", Run: handleSortLines, Requires: []Predicate{requiresSelection, requiresUnlocked}},
+		{Name: "toggleComment", Category: "Edit", Description: "Comment or uncomment the current or selected lines", Run: handleToggleComment, Requires: []Predicate{requiresUnlocked}, Keys: []string{"alt+/"}},
+		{Name: "toggleBlockComment", Category: "Edit", Description: "Wrap the selection in a block comment, or unwrap it", Run: handleToggleBlockComment, Requires: []Predicate{requiresUnlocked}, Keys: []string{"alt+A"}},
+		{Name: "selectAll", Category: "Selection", Description: "Select the whole buffer", Run: handleSelectAll},
+		{Name: "shiftLeft", Category: "Selection", Description: "Extend the selection left", Run: handleShiftLeft},
+		{Name: "shiftRight", Category: "Selection", Description: "Extend the selection right", Run: handleShiftRight},
+		{Name: "shiftUp", Category: "Selection", Description: "Extend the selection up", Run: handleShiftUp},
+		{Name: "shiftDown", Category: "Selection", Description: "Extend the selection down", Run: handleShiftDown},
+		{Name: "altLeft", Category: "Selection", Description: "Extend the selection to the previous word", Run: handleAltLeft},
+		{Name: "altRight", Category: "Selection", Description: "Extend the selection to the next word", Run: handleAltRight},
+		{Name: "reload", Category: "File", Description: "Reload the configuration file", Run: handleReloadConfig},
+		{Name: "messages", Category: "General", Description: "Show the message history", Run: handleShowMessages},
+		{Name: "theme", Category: "General", Description: "Pick a theme with live preview", Run: handleThemePicker},
+		{Name: "log", Category: "General", Description: "Show the debug log", Run: handleShowLog},
+		{Name: "editorconfig", Category: "General", Description: "Show the .editorconfig properties for this buffer", Run: handleEditorConfigInfo},
+		{Name: "blockUp", Category: "Selection", Description: "Extend the block selection up", Run: handleBlockUp, Keys: []string{"alt+shift+up"}},
+		{Name: "blockDown", Category: "Selection", Description: "Extend the block selection down", Run: handleBlockDown, Keys: []string{"alt+shift+down"}},
+		{Name: "blockLeft", Category: "Selection", Description: "Extend the block selection left", Run: handleBlockLeft, Keys: []string{"alt+shift+left"}},
+		{Name: "blockRight", Category: "Selection", Description: "Extend the block selection right", Run: handleBlockRight, Keys: []string{"alt+shift+right"}},
+		{Name: "addCursorAbove", Category: "Selection", Description: "Add a cursor on the line above", Run: handleAddCursorAbove, Keys: []string{"alt+ctrl+up"}},
+		{Name: "addCursorBelow", Category: "Selection", Description: "Add a cursor on the line below", Run: handleAddCursorBelow, Keys: []string{"alt+ctrl+down"}},
+		{Name: "addNextOccurrence", Category: "Selection", Description: "Select the word, then add a cursor at its next occurrence", Run: handleAddNextOccurrence, Keys: []string{"ctrl+d"}},
+		{Name: "cursorsFromFind", Category: "Search", Description: "Put a cursor on every search result", Run: handleCursorsFromFind, Requires: []Predicate{requiresSearch}},
+		{Name: "macroRecord", Category: "Macros", Description: "Start or stop recording a keyboard macro", Run: handleMacroRecord, Keys: []string{"alt+m"}},
+		{Name: "macroPlay", Category: "Macros", Description: "Replay the last macro", Run: handleMacroPlay, Keys: []string{"alt+p"}},
+		{Name: "macroPlayCount", Category: "Macros", Description: "Replay the last macro a number of times", Run: handleMacroPlayCount},
+		{Name: "macroPlayLines", Category: "Macros", Description: "Replay the last macro on every selected line", Run: handleMacroPlayLines, Requires: []Predicate{requiresSelection}},
+		{Name: "macroSave", Category: "Macros", Description: "Save the last macro under a name", Run: handleMacroSave},
+		{Name: "macroRun", Category: "Macros", Description: "Run a saved macro", Run: handleMacroRun},
+		{Name: "dismiss", Category: "General", Description: "Dismiss the current notification", Run: handleDismissMessage},
+	}
+}
+
+// runCommand executes cmd if its predicates allow it and reports why not
+// otherwise.
+func (m Model) runCommand(cmd *Command, msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	if reason := cmd.disabledReason(m); reason != "" {
+		m.notifyf(MessageWarning, "%s: %s", cmd.Description, reason)
+		return m, nil
+	}
+	return cmd.Run(m, msg)
+}
+
+// CommandConfig defines a command in the config file. The command pipes the
+// selection, or the whole buffer when nothing is selected, through a shell
+// command and replaces it with the output.
+type CommandConfig struct {
+	Description       string  `json:"description" toml:"description"`
+	Category          string  `json:"category" toml:"category"`
+	Shell             string  `json:"shell" toml:"shell"`
+	RequiresSelection bool    `json:"requires_selection" toml:"requires_selection"`
+	Keys              KeyList `json:"keys" toml:"keys"`
+}
+
+// registerConfigCommands replaces the commands defined by the previous config
+// with those in defs.
+func registerConfigCommands(defs map[string]CommandConfig) []string {
+	commands.removeConfigCommands()
+
+	names := make([]string, 0, len(defs))
+	for name := range defs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var warnings []string
+	for _, name := range names {
+		def := defs[name]
+		if def.Shell == "" {
+			warnings = append(warnings, fmt.Sprintf("command %q has no shell command", name))
+			continue
+		}
+		desc := def.Description
+		if desc == "" {
+			desc = name
+		}
+		category := def.Category
+		if category == "" {
+			category = "Custom"
+		}
+		cmd := Command{
+			Name:        name,
+			Description: desc,
+			Category:    category,
+			Run:         shellFilterHandler(def.Shell),
+			Requires:    []Predicate{requiresUnlocked},
+			Keys:        def.Keys,
+			fromConfig:  true,
+		}
+		if def.RequiresSelection {
+			cmd.Requires = append(cmd.Requires, requiresSelection)
+		}
+		if err := commands.Register(cmd); err != nil {
+			warnings = append(warnings, err.Error())
+		}
+	}
+	return warnings
+}
+
+func shellFilterHandler(shell string) keyHandler {
+	return func(m Model, _ tea.KeyMsg) (tea.Model, tea.Cmd) {
+		return m.filterThroughShell(shell)
+	}
+}
+
+// filterThroughShell replaces the selection, or the whole buffer, with the
+// output of a shell command. Like formatters, it never sees sensitive buffers.
+func (m Model) filterThroughShell(shell string) (tea.Model, tea.Cmd) {
+	if m.sensitive {
+		m.notify(MessageWarning, "Shell commands are disabled for sensitive buffers")
+		return m, nil
+	}
+
+	hasSelection := m.textBuffer.HasSelection()
+	input := m.textBuffer.GetContent()
+	if hasSelection {
+		input = m.textBuffer.GetSelectedText()
+	}
+
+	output, err := runShellFilter(shell, input)
+	if err != nil {
+		m.notify(MessageError, err.Error())
+		return m, nil
+	}
+	output = normalizeLineEndings(output)
+	if output == input {
+		return m, nil
+	}
+
+	if hasSelection {
+		if err := m.textBuffer.InsertText(output); err != nil {
+			m.notify(MessageError, err.Error())
+			return m, nil
+		}
+	} else {
+		m.textBuffer.SetContent(output)
+	}
+	m.invalidateHighlightCache()
+	m.updateModified()
+	m.postMovementUpdate()
+	return m, nil
+}
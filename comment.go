@@ -0,0 +1,275 @@
+package main
+
+import (
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// commentSyntax is how one language writes comments. Either kind may be
+// missing.
+type commentSyntax struct {
+	line       string
+	blockStart string
+	blockEnd   string
+}
+
+var (
+	cComments    = commentSyntax{line: "//", blockStart: "/*", blockEnd: "*/"}
+	hashComments = commentSyntax{line: "#"}
+	lispComments = commentSyntax{line: ";"}
+	htmlComments = commentSyntax{blockStart: "<!--", blockEnd: "-->"}
+	sqlComments  = commentSyntax{line: "--", blockStart: "/*", blockEnd: "*/"}
+)
+
+// commentSyntaxByLexer is keyed by chroma lexer name.
+var commentSyntaxByLexer = map[string]commentSyntax{
+	"Go":                     cComments,
+	"C":                      cComments,
+	"C++":                    cComments,
+	"C#":                     cComments,
+	"Java":                   cComments,
+	"JavaScript":             cComments,
+	"TypeScript":             cComments,
+	"react":                  cComments,
+	"Rust":                   cComments,
+	"Swift":                  cComments,
+	"Kotlin":                 cComments,
+	"Scala":                  cComments,
+	"Dart":                   cComments,
+	"PHP":                    cComments,
+	"Groovy":                 cComments,
+	"Solidity":               cComments,
+	"Protocol Buffer":        cComments,
+	"Zig":                    {line: "//"},
+	"Odin":                   cComments,
+	"Gleam":                  {line: "//"},
+	"SCSS":                   cComments,
+	"CSS":                    {blockStart: "/*", blockEnd: "*/"},
+	"Python":                 hashComments,
+	"Python 2":               hashComments,
+	"Bash":                   hashComments,
+	"Fish":                   hashComments,
+	"PowerShell":             {line: "#", blockStart: "<#", blockEnd: "#>"},
+	"Ruby":                   hashComments,
+	"Perl":                   hashComments,
+	"Elixir":                 hashComments,
+	"R":                      hashComments,
+	"Nim":                    hashComments,
+	"Julia":                  {line: "#", blockStart: "#=", blockEnd: "=#"},
+	"Crystal":                hashComments,
+	"YAML":                   hashComments,
+	"GraphQL":                hashComments,
+	"TOML":                   hashComments,
+	"Makefile":               hashComments,
+	"Docker":                 hashComments,
+	"CMake":                  hashComments,
+	"Terraform":              {line: "#", blockStart: "/*", blockEnd: "*/"},
+	"HCL":                    {line: "#", blockStart: "/*", blockEnd: "*/"},
+	"Nix":                    {line: "#", blockStart: "/*", blockEnd: "*/"},
+	"Lua":                    {line: "--", blockStart: "--[[", blockEnd: "]]"},
+	"SQL":                    sqlComments,
+	"MySQL":                  sqlComments,
+	"PostgreSQL SQL dialect": sqlComments,
+	"Transact-SQL":           sqlComments,
+	"Haskell":                {line: "--", blockStart: "{-", blockEnd: "-}"},
+	"Elm":                    {line: "--", blockStart: "{-", blockEnd: "-}"},
+	"VHDL":                   {line: "--"},
+	"Common Lisp":            {line: ";", blockStart: "#|", blockEnd: "|#"},
+	"Clojure":                lispComments,
+	"Scheme":                 lispComments,
+	"EmacsLisp":              lispComments,
+	"Racket":                 {line: ";", blockStart: "#|", blockEnd: "|#"},
+	"INI":                    lispComments,
+	"NASM":                   lispComments,
+	"TeX":                    {line: "%"},
+	"Erlang":                 {line: "%"},
+	"VimL":                   {line: "\""},
+	"OCaml":                  {blockStart: "(*", blockEnd: "*)"},
+	"Batchfile":              {line: "REM"},
+	"HTML":                   htmlComments,
+	"XML":                    htmlComments,
+	"markdown":               htmlComments,
+	"vue":                    htmlComments,
+	"Svelte":                 htmlComments,
+}
+
+// commentSyntax returns the comment syntax for the buffer's language.
+func (m Model) commentSyntax() (commentSyntax, bool) {
+	syntax, ok := commentSyntaxByLexer[m.highlighter.LexerName()]
+	return syntax, ok
+}
+
+// columnEdit records that delta bytes were inserted (or removed, when
+// negative) at column at of one line, so positions can follow the text.
+type columnEdit struct {
+	at, delta int
+}
+
+// followEdits moves the cursor and selection to stay on the same text after
+// the edits to lines first onward.
+func (m *Model) followEdits(cursor Position, sel *Selection, first int, edits []columnEdit) {
+	follow := func(p Position) Position {
+		i := p.Line - first
+		if i < 0 || i >= len(edits) || p.Column < edits[i].at {
+			return p
+		}
+		p.Column = max(p.Column+edits[i].delta, edits[i].at)
+		return p
+	}
+	if sel != nil {
+		m.textBuffer.SetSelection(&Selection{Start: follow(sel.Start), End: follow(sel.End)})
+	}
+	m.textBuffer.SetCursor(follow(cursor))
+	m.postMovementUpdate()
+}
+
+// handleToggleComment comments out the selected lines, or the cursor line,
+// with the language's line comment, or uncomments them when every non-blank
+// line is already commented. The markers line up at the smallest indentation
+// of the lines. Languages without line comments get a block comment instead.
+func handleToggleComment(m Model, _ tea.KeyMsg) (tea.Model, tea.Cmd) {
+	syntax, ok := m.commentSyntax()
+	if !ok {
+		m.notifyf(MessageWarning, "No comment syntax for %s", m.highlighter.LexerName())
+		return m, nil
+	}
+	if syntax.line == "" {
+		return m.toggleBlockComment(syntax)
+	}
+
+	first, last := m.lineRange()
+	cursor, sel := m.textBuffer.GetCursor(), m.textBuffer.GetSelection()
+	lines := m.rangeLines(exRange{start: first, end: last})
+	indent, commented, blank := -1, true, true
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		col := firstNonBlank(line)
+		if indent < 0 || col < indent {
+			indent = col
+		}
+		commented = commented && strings.HasPrefix(line[col:], syntax.line)
+		blank = false
+	}
+	if blank {
+		return m, nil
+	}
+
+	edits := make([]columnEdit, len(lines))
+	for i, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if commented {
+			col := firstNonBlank(line)
+			n := len(syntax.line)
+			if strings.HasPrefix(line[col+n:], " ") {
+				n++
+			}
+			lines[i] = line[:col] + line[col+n:]
+			edits[i] = columnEdit{at: col, delta: -n}
+		} else {
+			lines[i] = line[:indent] + syntax.line + " " + line[indent:]
+			edits[i] = columnEdit{at: indent, delta: len(syntax.line) + 1}
+		}
+	}
+	m.replaceRange(exRange{start: first, end: last}, lines)
+	m.followEdits(cursor, sel, first, edits)
+	return m, nil
+}
+
+// handleToggleBlockComment wraps the selection, or the selected lines, in the
+// language's block comment, or unwraps it when it is one already.
+func handleToggleBlockComment(m Model, _ tea.KeyMsg) (tea.Model, tea.Cmd) {
+	syntax, ok := m.commentSyntax()
+	if !ok || syntax.blockStart == "" {
+		m.notifyf(MessageWarning, "No block comment syntax for %s", m.highlighter.LexerName())
+		return m, nil
+	}
+	return m.toggleBlockComment(syntax)
+}
+
+// toggleBlockComment wraps a selection within one line in place. Otherwise
+// it comments whole lines: the start marker goes at the smallest indentation
+// of the lines, on the first non-blank one, and the end marker at the end of
+// the last non-blank one.
+func (m Model) toggleBlockComment(syntax commentSyntax) (tea.Model, tea.Cmd) {
+	start, end := syntax.blockStart, syntax.blockEnd
+	cursor, sel := m.textBuffer.GetCursor(), m.textBuffer.GetSelection()
+	first, last := m.lineRange()
+	lines := m.rangeLines(exRange{start: first, end: last})
+
+	// A selection inside one line
+	if sel != nil && first == last {
+		s, e := sel.Normalize()
+		if s.Line == e.Line && s.Column != e.Column && (s.Column > 0 || e.Column < len(lines[0])) {
+			line := lines[0]
+			inner := line[s.Column:e.Column]
+			if unwrapped, ok := unwrapBlockComment(inner, start, end); ok {
+				lines[0] = line[:s.Column] + unwrapped + line[e.Column:]
+				e.Column = s.Column + len(unwrapped)
+			} else {
+				lines[0] = line[:s.Column] + start + " " + inner + " " + end + line[e.Column:]
+				e.Column += len(start) + len(end) + 2
+			}
+			m.replaceRange(exRange{start: first, end: last}, lines)
+			m.textBuffer.SetSelection(&Selection{Start: s, End: e})
+			m.textBuffer.SetCursor(e)
+			m.postMovementUpdate()
+			return m, nil
+		}
+	}
+
+	// The markers go on the first and last non-blank lines
+	indent, top, bottom := -1, -1, -1
+	for i, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if indent < 0 || firstNonBlank(line) < indent {
+			indent = firstNonBlank(line)
+		}
+		if top < 0 {
+			top = i
+		}
+		bottom = i
+	}
+	if indent < 0 {
+		return m, nil
+	}
+
+	edits := make([]columnEdit, len(lines))
+	col := firstNonBlank(lines[top])
+	lastLine := strings.TrimRight(lines[bottom], " \t")
+	if strings.HasPrefix(lines[top][col:], start) && strings.HasSuffix(lastLine, end) && (bottom > top || len(lastLine)-col >= len(start)+len(end)) {
+		lines[bottom] = strings.TrimSuffix(strings.TrimSuffix(lastLine, end), " ")
+		removed := len(start)
+		if strings.HasPrefix(lines[top][col+removed:], " ") {
+			removed++
+		}
+		lines[top] = lines[top][:col] + lines[top][col+removed:]
+		edits[top] = columnEdit{at: col, delta: -removed}
+	} else {
+		lines[top] = lines[top][:indent] + start + " " + lines[top][indent:]
+		lines[bottom] = strings.TrimRight(lines[bottom], " \t") + " " + end
+		edits[top] = columnEdit{at: indent, delta: len(start) + 1}
+	}
+	m.replaceRange(exRange{start: first, end: last}, lines)
+	m.followEdits(cursor, sel, first, edits)
+	return m, nil
+}
+
+// unwrapBlockComment removes the block comment markers around text, and one
+// space inside each, ignoring whitespace outside them.
+func unwrapBlockComment(text, start, end string) (string, bool) {
+	trimmed := strings.TrimSpace(text)
+	if len(trimmed) < len(start)+len(end) || !strings.HasPrefix(trimmed, start) || !strings.HasSuffix(trimmed, end) {
+		return "", false
+	}
+	inner := trimmed[len(start) : len(trimmed)-len(end)]
+	inner = strings.TrimPrefix(inner, " ")
+	inner = strings.TrimSuffix(inner, " ")
+	return inner, true
+}
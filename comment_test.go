@@ -0,0 +1,135 @@
+package main
+
+import (
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestToggleComment(t *testing.T) {
+	tests := []struct {
+		name     string
+		filename string
+		content  string
+		sel      *Selection
+		cursor   Position
+		block    bool
+		want     string
+	}{
+		{
+			name:     "line comment at minimum indent",
+			filename: "x.go",
+			content:  "func f() {\n\tif x {\n\t\ty()\n\n\t}\n}",
+			sel:      &Selection{Start: Position{Line: 1}, End: Position{Line: 4, Column: 2}},
+			want:     "func f() {\n\t// if x {\n\t// \ty()\n\n\t// }\n}",
+		},
+		{
+			name:     "uncomment",
+			filename: "x.go",
+			content:  "\t// if x {\n\t// \ty()\n\t// }",
+			sel:      &Selection{Start: Position{}, End: Position{Line: 2, Column: 5}},
+			want:     "\tif x {\n\t\ty()\n\t}",
+		},
+		{
+			name:     "partly commented lines are commented",
+			filename: "x.py",
+			content:  "  a = 1\n  # b",
+			sel:      &Selection{Start: Position{}, End: Position{Line: 1, Column: 5}},
+			want:     "  # a = 1\n  # # b",
+		},
+		{
+			name:     "cursor line only",
+			filename: "x.sql",
+			content:  "select 1;\nselect 2;",
+			cursor:   Position{Line: 1},
+			want:     "select 1;\n-- select 2;",
+		},
+		{
+			name:     "block comment for a language without line comments",
+			filename: "x.html",
+			content:  "  <p>\n    hi\n  </p>",
+			sel:      &Selection{Start: Position{}, End: Position{Line: 2, Column: 6}},
+			want:     "  <!-- <p>\n    hi\n  </p> -->",
+		},
+		{
+			name:     "block uncomment",
+			filename: "x.html",
+			content:  "  <!-- <p>\n    hi\n  </p> -->",
+			sel:      &Selection{Start: Position{}, End: Position{Line: 2, Column: 10}},
+			want:     "  <p>\n    hi\n  </p>",
+		},
+		{
+			name:     "block comment with blank first and last lines",
+			filename: "x.css",
+			content:  "\n    a {}\n    b {}\n",
+			sel:      &Selection{Start: Position{}, End: Position{Line: 3}},
+			want:     "\n    /* a {}\n    b {} */\n",
+		},
+		{
+			name:     "block comment on a deeper first line",
+			filename: "x.css",
+			content:  "\n      a {}\n    b {}",
+			sel:      &Selection{Start: Position{}, End: Position{Line: 2, Column: 8}},
+			want:     "\n    /*   a {}\n    b {} */",
+		},
+		{
+			name:     "inline block comment",
+			filename: "x.c",
+			content:  "int a = f(b);",
+			sel:      &Selection{Start: Position{Column: 10}, End: Position{Column: 11}},
+			block:    true,
+			want:     "int a = f(/* b */);",
+		},
+		{
+			name:     "inline block uncomment",
+			filename: "x.c",
+			content:  "int a = f(/* b */);",
+			sel:      &Selection{Start: Position{Column: 10}, End: Position{Column: 17}},
+			block:    true,
+			want:     "int a = f(b);",
+		},
+		{
+			name:     "no comment syntax",
+			filename: "x.txt",
+			content:  "a",
+			want:     "a",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTestModel(t, tt.filename, nil)
+			m.textBuffer.SetContent(tt.content)
+			m.textBuffer.SetCursor(tt.cursor)
+			if tt.sel != nil {
+				m.textBuffer.SetSelection(tt.sel)
+				m.textBuffer.SetCursor(tt.sel.End)
+			}
+			run := handleToggleComment
+			if tt.block {
+				run = handleToggleBlockComment
+			}
+			next, _ := run(m, tea.KeyMsg{})
+			if got := next.(Model).textBuffer.GetContent(); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestToggleCommentUndo(t *testing.T) {
+	m := newTestModel(t, "x.go", nil)
+	if err := m.textBuffer.InsertText("x"); err != nil {
+		t.Fatal(err)
+	}
+	next, _ := handleToggleComment(m, tea.KeyMsg{})
+	m = next.(Model)
+	if got := m.textBuffer.GetContent(); got != "// x" {
+		t.Fatalf("got %q", got)
+	}
+	next, _ = m.handleUndo()
+	m = next.(Model)
+	if got := m.textBuffer.GetContent(); got != "x" {
+		t.Fatalf("after undo got %q, want %q", got, "x")
+	}
+}
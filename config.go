@@ -0,0 +1,414 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// Config is the user configuration loaded from config.toml or config.json.
+type Config struct {
+	Theme              string                      `json:"theme" toml:"theme"`
+	Style              string                      `json:"style" toml:"style"`
+	Colors             map[string]string           `json:"colors" toml:"colors"`
+	MaxHistory         int                         `json:"max_history" toml:"max_history"`
+	MaxResultsDisplay  int                         `json:"max_results_display" toml:"max_results_display"`
+	BlinkIntervalMs    int                         `json:"blink_interval_ms" toml:"blink_interval_ms"`
+	HighlightTimeoutMs int                         `json:"highlight_timeout_ms" toml:"highlight_timeout_ms"`
+	Editor             LanguageSettings            `json:"editor" toml:"editor"`
+	Languages          map[string]LanguageSettings `json:"languages" toml:"languages"`
+	Keymap             string                      `json:"keymap" toml:"keymap"`
+	Keybindings        map[string]KeyList          `json:"keybindings" toml:"keybindings"`
+	ChordTimeoutMs     int                         `json:"chord_timeout_ms" toml:"chord_timeout_ms"`
+	WhichKeyDelayMs    int                         `json:"which_key_delay_ms" toml:"which_key_delay_ms"`
+	VimMode            bool                        `json:"vim_mode" toml:"vim_mode"`
+	Commands           map[string]CommandConfig    `json:"commands" toml:"commands"`
+	Clipboard          string                      `json:"clipboard" toml:"clipboard"`
+	KillRingSize       int                         `json:"kill_ring_size" toml:"kill_ring_size"`
+	PersistKillRing    bool                        `json:"persist_kill_ring" toml:"persist_kill_ring"`
+
+	// path is the file the config was loaded from, empty for defaults.
+	path string
+}
+
+// LanguageSettings holds editing options that can be overridden per language.
+// Nil fields are unset and inherit from the enclosing level.
+type LanguageSettings struct {
+	TabWidth     *int   `json:"tab_width" toml:"tab_width"`
+	InsertSpaces *bool  `json:"insert_spaces" toml:"insert_spaces"`
+	DetectIndent *bool  `json:"detect_indent" toml:"detect_indent"` // use the buffer's own indentation unless the two above are set
+	Rulers       []int  `json:"rulers" toml:"rulers"`
+	AutoSave     *int   `json:"auto_save" toml:"auto_save"` // idle seconds before saving, 0 disables
+	Formatter    string `json:"formatter" toml:"formatter"` // shell command filtering the buffer on save
+}
+
+// EditorSettings is the fully resolved set of options for one buffer.
+type EditorSettings struct {
+	TabWidth     int
+	InsertSpaces bool
+	DetectIndent bool
+	// IndentSource says where the indent style came from: "default",
+	// "config", "editorconfig", "detected" or "command", for the
+	// editorconfig info view.
+	IndentSource string
+	Rulers       []int
+	AutoSave     time.Duration
+	Formatter    string
+	// The save options below are only set by .editorconfig. An empty
+	// EndOfLine means the platform's line ending.
+	EndOfLine              string
+	Charset                string
+	TrimTrailingWhitespace bool
+	InsertFinalNewline     *bool
+}
+
+const (
+	defaultStyle             = "doom-one"
+	defaultMaxHistory        = 100
+	defaultMaxResultsDisplay = 8
+	defaultBlinkInterval     = 500 * time.Millisecond
+	defaultHighlightTimeout  = 100 * time.Millisecond
+	defaultTabWidth          = 4
+	configDirName            = "gecko"
+	configFileTOML           = "config.toml"
+	configFileJSON           = "config.json"
+	formatterTimeout         = 10 * time.Second
+	configGlobMetaCharacters = "*?["
+)
+
+// DefaultConfig returns the built-in settings used when no config file exists.
+func DefaultConfig() *Config {
+	return &Config{
+		Theme:              defaultTheme,
+		MaxHistory:         defaultMaxHistory,
+		MaxResultsDisplay:  defaultMaxResultsDisplay,
+		BlinkIntervalMs:    int(defaultBlinkInterval / time.Millisecond),
+		HighlightTimeoutMs: int(defaultHighlightTimeout / time.Millisecond),
+		KillRingSize:       defaultKillRingSize,
+	}
+}
+
+// configDir returns $XDG_CONFIG_HOME/gecko, falling back to the platform config directory.
+func configDir() (string, error) {
+	if xdg := os.Getenv("XDG_CONFIG_HOME"); xdg != "" {
+		return filepath.Join(xdg, configDirName), nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, configDirName), nil
+}
+
+// findConfigFile returns the first existing config file in the config directory.
+func findConfigFile() string {
+	dir, err := configDir()
+	if err != nil {
+		return ""
+	}
+	for _, name := range []string{configFileTOML, configFileJSON} {
+		path := filepath.Join(dir, name)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return ""
+}
+
+// LoadConfig reads the config at path, or the default location when path is
+// empty. A missing default file is not an error; defaults are returned instead.
+func LoadConfig(path string) (*Config, error) {
+	cfg := DefaultConfig()
+	if path == "" {
+		path = findConfigFile()
+		if path == "" {
+			return cfg, nil
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, fmt.Errorf("reading config: %w", err)
+	}
+
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		err = json.Unmarshal(data, cfg)
+	} else {
+		_, err = toml.Decode(string(data), cfg)
+	}
+	if err != nil {
+		return DefaultConfig(), fmt.Errorf("parsing %s: %w", filepath.Base(path), err)
+	}
+
+	cfg.path = path
+	cfg.fillDefaults()
+	return cfg, nil
+}
+
+// fillDefaults replaces zero or invalid values with the built-in defaults.
+func (c *Config) fillDefaults() {
+	if c.Theme == "" {
+		c.Theme = defaultTheme
+	}
+	if c.MaxHistory <= 0 {
+		c.MaxHistory = defaultMaxHistory
+	}
+	if c.MaxResultsDisplay <= 0 {
+		c.MaxResultsDisplay = defaultMaxResultsDisplay
+	}
+	if c.BlinkIntervalMs <= 0 {
+		c.BlinkIntervalMs = int(defaultBlinkInterval / time.Millisecond)
+	}
+	if c.HighlightTimeoutMs <= 0 {
+		c.HighlightTimeoutMs = int(defaultHighlightTimeout / time.Millisecond)
+	}
+	if c.KillRingSize <= 0 {
+		c.KillRingSize = defaultKillRingSize
+	}
+}
+
+func (c *Config) BlinkInterval() time.Duration {
+	return time.Duration(c.BlinkIntervalMs) * time.Millisecond
+}
+
+func (c *Config) HighlightTimeout() time.Duration {
+	return time.Duration(c.HighlightTimeoutMs) * time.Millisecond
+}
+
+// ChordTimeout is how long a partially typed key sequence stays pending.
+func (c *Config) ChordTimeout() time.Duration {
+	if c.ChordTimeoutMs <= 0 {
+		return defaultChordTimeout
+	}
+	return time.Duration(c.ChordTimeoutMs) * time.Millisecond
+}
+
+// WhichKeyDelay is how long to wait before listing a prefix's continuations.
+func (c *Config) WhichKeyDelay() time.Duration {
+	if c.WhichKeyDelayMs <= 0 {
+		return defaultWhichKeyDelay
+	}
+	return time.Duration(c.WhichKeyDelayMs) * time.Millisecond
+}
+
+// SettingsFor resolves the editor settings for a file. Global editor settings
+// are applied first, then overrides keyed by lexer name, then glob overrides
+// matched against the file's base name.
+func (c *Config) SettingsFor(filename, lexerName string) EditorSettings {
+	settings := EditorSettings{TabWidth: defaultTabWidth, DetectIndent: true, IndentSource: "default"}
+	settings.merge(c.Editor)
+
+	keys := make([]string, 0, len(c.Languages))
+	for k := range c.Languages {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		if !isConfigGlob(k) && strings.EqualFold(k, lexerName) {
+			settings.merge(c.Languages[k])
+		}
+	}
+
+	base := filepath.Base(filename)
+	for _, k := range keys {
+		if !isConfigGlob(k) || filename == "" {
+			continue
+		}
+		if ok, err := filepath.Match(k, base); err == nil && ok {
+			settings.merge(c.Languages[k])
+		}
+	}
+
+	return settings
+}
+
+func isConfigGlob(key string) bool {
+	return strings.ContainsAny(key, configGlobMetaCharacters)
+}
+
+func (s *EditorSettings) merge(o LanguageSettings) {
+	if o.TabWidth != nil && *o.TabWidth > 0 {
+		s.TabWidth = *o.TabWidth
+		s.IndentSource = "config"
+	}
+	if o.InsertSpaces != nil {
+		s.InsertSpaces = *o.InsertSpaces
+		s.IndentSource = "config"
+	}
+	if o.DetectIndent != nil {
+		s.DetectIndent = *o.DetectIndent
+	}
+	if o.Rulers != nil {
+		s.Rulers = o.Rulers
+	}
+	if o.AutoSave != nil {
+		s.AutoSave = time.Duration(max(*o.AutoSave, 0)) * time.Second
+	}
+	if o.Formatter != "" {
+		s.Formatter = o.Formatter
+	}
+}
+
+// IndentUnit returns the text inserted for one level of indentation.
+func (s EditorSettings) IndentUnit() string {
+	if s.InsertSpaces {
+		return strings.Repeat(" ", s.TabWidth)
+	}
+	return "\t"
+}
+
+// IndentLabel describes the indent style for the status bar.
+func (s EditorSettings) IndentLabel() string {
+	if s.InsertSpaces {
+		return fmt.Sprintf("Spaces: %d", s.TabWidth)
+	}
+	return fmt.Sprintf("Tabs: %d", s.TabWidth)
+}
+
+// applyConfig pushes the loaded configuration into the model, styles, keymap
+// and highlighter. Non-fatal problems are returned as warnings.
+func (m *Model) applyConfig(cfg *Config) []string {
+	m.config = cfg
+	m.maxResultsDisplay = cfg.MaxResultsDisplay
+	m.textBuffer.SetMaxHistory(cfg.MaxHistory)
+	m.killRing.configure(cfg.KillRingSize, cfg.PersistKillRing)
+
+	var warnings []string
+
+	warnings = append(warnings, loadUserThemes()...)
+	theme, ok := themes[cfg.Theme]
+	if !ok {
+		warnings = append(warnings, fmt.Sprintf("unknown theme %q", cfg.Theme))
+		theme = themes[defaultTheme]
+	}
+
+	warnings = append(warnings, registerConfigCommands(cfg.Commands)...)
+
+	provider, err := newClipboardProvider(cfg.Clipboard)
+	if err != nil {
+		warnings = append(warnings, err.Error())
+	}
+	m.clipboardProvider = provider
+	slog.Debug("clipboard provider", "name", provider.Name())
+
+	keymap, keyWarnings := buildKeyMap(cfg.Keymap, cfg.Keybindings)
+	keys = keymap
+	warnings = append(warnings, keyWarnings...)
+
+	if cfg.VimMode != m.vim.enabled {
+		m.textBuffer.ClearSelection()
+		m.vimEndUndoGroup()
+		m.vim = vimState{enabled: cfg.VimMode}
+		if cfg.VimMode {
+			m.vimClampCursor()
+		}
+	}
+
+	if err := m.applyTheme(theme); err != nil {
+		warnings = append(warnings, err.Error())
+	}
+	m.applyFileType()
+	return warnings
+}
+
+// applyFileType picks the lexer and per-language settings for the current
+// filename and re-highlights the buffer.
+func (m *Model) applyFileType() {
+	m.highlighter = NewHighlighter(plainFilename(m.filename), m.syntaxStyle())
+	m.resolveSettings()
+
+	m.highlightedLines = nil
+	m.applySyntaxHighlighting()
+}
+
+// resolveSettings works out the editor settings for the buffer: the config
+// for its file type, then any .editorconfig properties, then the indent style
+// detected from its content. Detection is skipped when detect_indent is off
+// or the config or .editorconfig set the indentation explicitly.
+func (m *Model) resolveSettings() {
+	m.settings = m.config.SettingsFor(plainFilename(m.filename), m.highlighter.LexerName())
+	ec, err := loadEditorConfig(plainFilename(m.filename))
+	if err != nil {
+		m.notify(MessageWarning, "EditorConfig: "+err.Error())
+	}
+	m.editorConfig = ec
+	if m.settings.applyEditorConfig(ec) || !m.settings.DetectIndent || m.settings.IndentSource == "config" {
+		return
+	}
+	if spaces, width, ok := detectIndent(m.textBuffer.GetLines()); ok {
+		m.settings.InsertSpaces = spaces
+		if spaces {
+			m.settings.TabWidth = width
+		}
+		m.settings.IndentSource = "detected"
+	}
+}
+
+// reloadConfig re-reads the config file the editor was started with and
+// re-applies it without restarting. A file that cannot be read or parsed
+// leaves the current configuration in place.
+func (m *Model) reloadConfig() ([]string, error) {
+	cfg, err := LoadConfig(m.configPath)
+	if err != nil {
+		return nil, err
+	}
+	return m.applyConfig(cfg), nil
+}
+
+// runShellFilter pipes content through a shell command, such as the
+// configured formatter, and returns its output.
+func runShellFilter(command, content string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), formatterTimeout)
+	defer cancel()
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", command)
+	}
+	cmd.Stdin = strings.NewReader(content)
+
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+
+	output, err := cmd.Output()
+	if ctx.Err() != nil {
+		return "", fmt.Errorf("%s timed out", command)
+	}
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("%s failed: %s", command, msg)
+		}
+		return "", fmt.Errorf("%s failed: %w", command, err)
+	}
+	return string(output), nil
+}
+
+type autoSaveMsg struct {
+	seq int
+}
+
+// autoSaveCmd schedules an auto-save for the current edit sequence number.
+// The save is skipped if further edits happen before the timer fires.
+func (m Model) autoSaveCmd() tea.Cmd {
+	if m.settings.AutoSave <= 0 || m.filename == "" {
+		return nil
+	}
+	seq := m.editSeq
+	return tea.Tick(m.settings.AutoSave, func(time.Time) tea.Msg {
+		return autoSaveMsg{seq: seq}
+	})
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReloadConfigKeepsConfigOnError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.toml")
+	if err := os.WriteFile(path, []byte("keymap = \"nano\"\n[editor]\ntab_width = 2\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := newTestModel(t, "", cfg)
+	m.configPath = path
+
+	if err := os.WriteFile(path, []byte("keymap = \"emacs\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	next, _ := m.handleReloadConfig()
+	m = next.(Model)
+	if m.config.Keymap != "nano" || m.settings.TabWidth != 2 {
+		t.Fatalf("config replaced: keymap %q, tab width %d", m.config.Keymap, m.settings.TabWidth)
+	}
+	if m.notification.Level != MessageError {
+		t.Fatalf("got notification %+v", m.notification)
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// Encrypted container layout:
+//
+//	magic (8) | version (1) | salt (16) | nonce (12) | AES-256-GCM ciphertext
+//
+// The header is passed to GCM as additional data so it cannot be altered
+// without failing authentication.
+const (
+	containerMagic   = "GECKOENC"
+	containerVersion = 1
+	containerSaltLen = 16
+	containerKeyLen  = 32
+
+	// encryptedFileExt marks new files that should be created as containers.
+	encryptedFileExt = ".genc"
+
+	// scrypt parameters recommended for interactive logins.
+	scryptN = 1 << 15
+	scryptR = 8
+	scryptP = 1
+)
+
+var (
+	ErrNotEncrypted      = errors.New("not an encrypted container")
+	ErrBadPassphrase     = errors.New("wrong passphrase or corrupted file")
+	ErrUnsupportedFormat = errors.New("unsupported container version")
+)
+
+// isEncryptedContainer reports whether data starts with the container magic.
+func isEncryptedContainer(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(containerMagic))
+}
+
+// isEncryptedFilename reports whether a new file should be created encrypted.
+func isEncryptedFilename(filename string) bool {
+	return strings.HasSuffix(filename, encryptedFileExt)
+}
+
+// plainFilename strips the container extension so syntax detection sees the
+// underlying file type, e.g. "secrets.env.genc" -> "secrets.env".
+func plainFilename(filename string) string {
+	return strings.TrimSuffix(filename, encryptedFileExt)
+}
+
+func deriveKey(passphrase, salt []byte) ([]byte, error) {
+	return scrypt.Key(passphrase, salt, scryptN, scryptR, scryptP, containerKeyLen)
+}
+
+func newContainerAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// encryptContainer seals plaintext with a key derived from passphrase using a
+// fresh salt and nonce on every call.
+func encryptContainer(plaintext, passphrase []byte) ([]byte, error) {
+	salt := make([]byte, containerSaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("generating salt: %w", err)
+	}
+
+	key, err := deriveKey(passphrase, salt)
+	if err != nil {
+		return nil, fmt.Errorf("deriving key: %w", err)
+	}
+
+	aead, err := newContainerAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("generating nonce: %w", err)
+	}
+
+	header := make([]byte, 0, len(containerMagic)+1+len(salt)+len(nonce))
+	header = append(header, containerMagic...)
+	header = append(header, containerVersion)
+	header = append(header, salt...)
+	header = append(header, nonce...)
+
+	return aead.Seal(header, nonce, plaintext, header), nil
+}
+
+// decryptContainer opens a container produced by encryptContainer.
+func decryptContainer(data, passphrase []byte) ([]byte, error) {
+	if !isEncryptedContainer(data) {
+		return nil, ErrNotEncrypted
+	}
+
+	offset := len(containerMagic)
+	if len(data) <= offset || data[offset] != containerVersion {
+		return nil, ErrUnsupportedFormat
+	}
+	offset++
+
+	if len(data) < offset+containerSaltLen {
+		return nil, ErrBadPassphrase
+	}
+	salt := data[offset : offset+containerSaltLen]
+	offset += containerSaltLen
+
+	key, err := deriveKey(passphrase, salt)
+	if err != nil {
+		return nil, fmt.Errorf("deriving key: %w", err)
+	}
+
+	aead, err := newContainerAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < offset+aead.NonceSize() {
+		return nil, ErrBadPassphrase
+	}
+	nonce := data[offset : offset+aead.NonceSize()]
+	offset += aead.NonceSize()
+
+	plaintext, err := aead.Open(nil, nonce, data[offset:], data[:offset])
+	if err != nil {
+		return nil, ErrBadPassphrase
+	}
+	return plaintext, nil
+}
+
+// unlockBuffer decrypts the pending container into the text buffer. The
+// passphrase is kept in memory so the buffer can be re-encrypted on save.
+func (m *Model) unlockBuffer(passphrase string) error {
+	plaintext, err := decryptContainer(m.encryptedData, []byte(passphrase))
+	if err != nil {
+		return err
+	}
+
+	content := normalizeLineEndings(string(plaintext))
+	m.textBuffer = NewTextBuffer(content)
+	if m.config != nil {
+		m.textBuffer.SetMaxHistory(m.config.MaxHistory)
+	}
+	m.originalText = content
+	m.modified = false
+	m.passphrase = []byte(passphrase)
+	m.encryptedData = nil
+	m.highlightedLines = nil
+	m.invalidateHighlightCache()
+	if m.config != nil {
+		m.resolveSettings()
+	}
+	m.postMovementUpdate()
+	return nil
+}
+
+// isLocked reports whether the buffer is still waiting for its passphrase.
+func (m Model) isLocked() bool {
+	return m.encryptedData != nil || (m.encrypted && m.passphrase == nil)
+}
@@ -0,0 +1,392 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/unicode"
+)
+
+const editorConfigFileName = ".editorconfig"
+
+// editorConfigProperty is one property that applies to a file and the
+// section that set it.
+type editorConfigProperty struct {
+	value  string
+	source string // section and file, for the info command
+}
+
+// EditorConfig holds the .editorconfig properties for one file, keyed by
+// lower-case name. Nearer files override farther ones, and later sections
+// override earlier ones.
+type EditorConfig struct {
+	props map[string]editorConfigProperty
+	files []string // the files read, farthest first
+}
+
+func (ec EditorConfig) get(name string) (string, bool) {
+	p, ok := ec.props[name]
+	return p.value, ok
+}
+
+// loadEditorConfig collects the properties for path from the .editorconfig
+// files in its directory and every parent, stopping at one marked root.
+func loadEditorConfig(path string) (EditorConfig, error) {
+	ec := EditorConfig{props: make(map[string]editorConfigProperty)}
+	if path == "" {
+		return ec, nil
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return ec, err
+	}
+
+	var files []string
+	for dir := filepath.Dir(abs); ; dir = filepath.Dir(dir) {
+		file := filepath.Join(dir, editorConfigFileName)
+		root, err := editorConfigIsRoot(file)
+		if err == nil {
+			files = append(files, file)
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return ec, err
+		}
+		if root || filepath.Dir(dir) == dir {
+			break
+		}
+	}
+
+	for i := len(files) - 1; i >= 0; i-- {
+		if err := ec.apply(files[i], abs); err != nil {
+			return ec, err
+		}
+		ec.files = append(ec.files, files[i])
+	}
+	return ec, nil
+}
+
+// editorConfigIsRoot reads the preamble of file for root = true.
+func editorConfigIsRoot(file string) (bool, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "[") {
+			break
+		}
+		if key, value, ok := parseEditorConfigPair(line); ok && key == "root" {
+			return value == "true", nil
+		}
+	}
+	return false, scanner.Err()
+}
+
+// apply reads file and records the properties of sections matching target.
+func (ec *EditorConfig) apply(file, target string) error {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	rel, err := filepath.Rel(filepath.Dir(file), target)
+	if err != nil {
+		return err
+	}
+	rel = filepath.ToSlash(rel)
+
+	var section string
+	matched := false
+	for n, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = line[1 : len(line)-1]
+			if matched, err = matchEditorConfigGlob(section, rel); err != nil {
+				return fmt.Errorf("%s:%d: %w", file, n+1, err)
+			}
+			continue
+		}
+		key, value, ok := parseEditorConfigPair(line)
+		if !ok || !matched {
+			continue
+		}
+		ec.props[key] = editorConfigProperty{value: value, source: fmt.Sprintf("[%s] %s", section, file)}
+	}
+	return nil
+}
+
+// parseEditorConfigPair splits "key = value". Keys and the values of every
+// property Gecko understands are case-insensitive, so both are lower-cased.
+func parseEditorConfigPair(line string) (string, string, bool) {
+	key, value, ok := strings.Cut(line, "=")
+	if !ok {
+		return "", "", false
+	}
+	key = strings.ToLower(strings.TrimSpace(key))
+	value = strings.ToLower(strings.TrimSpace(value))
+	return key, value, key != ""
+}
+
+var editorConfigRange = regexp.MustCompile(`^\{(-?\d+)\.\.(-?\d+)\}`)
+
+// matchEditorConfigGlob reports whether the slash-separated path rel,
+// relative to the .editorconfig file, matches a section glob. A glob without
+// a slash matches the file name in any directory.
+func matchEditorConfigGlob(glob, rel string) (bool, error) {
+	if !strings.Contains(glob, "/") {
+		glob = "**/" + glob
+	}
+	glob = strings.TrimPrefix(glob, "/")
+
+	var b strings.Builder
+	type numRange struct{ lo, hi int }
+	var ranges []numRange
+	braces := 0
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch {
+		case c == '\\' && i+1 < len(glob):
+			i++
+			b.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		case c == '*' && strings.HasPrefix(glob[i:], "**/"):
+			// Zero or more directories
+			b.WriteString(`(?:.*/)?`)
+			i += 2
+		case c == '*' && strings.HasPrefix(glob[i:], "**"):
+			b.WriteString(`.*`)
+			i++
+		case c == '*':
+			b.WriteString(`[^/]*`)
+		case c == '?':
+			b.WriteString(`[^/]`)
+		case c == '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				b.WriteString(`\[`)
+				continue
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		case c == '{':
+			if m := editorConfigRange.FindStringSubmatch(glob[i:]); m != nil {
+				lo, _ := strconv.Atoi(m[1])
+				hi, _ := strconv.Atoi(m[2])
+				ranges = append(ranges, numRange{min(lo, hi), max(lo, hi)})
+				b.WriteString(`([+-]?\d+)`)
+				i += len(m[0]) - 1
+				continue
+			}
+			braces++
+			b.WriteString(`(?:`)
+		case c == '}' && braces > 0:
+			braces--
+			b.WriteString(`)`)
+		case c == ',' && braces > 0:
+			b.WriteString(`|`)
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	if braces > 0 {
+		return false, fmt.Errorf("unbalanced braces in section [%s]", glob)
+	}
+
+	re, err := regexp.Compile("^" + b.String() + "$")
+	if err != nil {
+		return false, fmt.Errorf("bad section [%s]: %w", glob, err)
+	}
+	m := re.FindStringSubmatch(rel)
+	if m == nil {
+		return false, nil
+	}
+	for i, r := range ranges {
+		n, err := strconv.Atoi(m[i+1])
+		if err != nil || n < r.lo || n > r.hi {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// applyEditorConfig overrides settings with the properties Gecko supports.
+// It reports whether the indent style was set.
+func (s *EditorSettings) applyEditorConfig(ec EditorConfig) (indentSet bool) {
+	if style, ok := ec.get("indent_style"); ok && (style == "space" || style == "tab") {
+		s.InsertSpaces = style == "space"
+		indentSet = true
+	}
+	size, _ := ec.get("indent_size")
+	tabWidth, _ := ec.get("tab_width")
+	if size == "tab" {
+		size = tabWidth
+	}
+	// The indent size is the width Gecko uses for both; an explicit tab_width
+	// wins when indenting with tabs.
+	if n, err := strconv.Atoi(size); err == nil && n > 0 {
+		s.TabWidth = n
+		indentSet = true
+	}
+	if n, err := strconv.Atoi(tabWidth); err == nil && n > 0 && (!s.InsertSpaces || size == "") {
+		s.TabWidth = n
+		indentSet = true
+	}
+	if indentSet {
+		s.IndentSource = "editorconfig"
+	}
+
+	if eol, ok := ec.get("end_of_line"); ok && (eol == "lf" || eol == "crlf" || eol == "cr") {
+		s.EndOfLine = eol
+	}
+	if charset, ok := ec.get("charset"); ok {
+		if _, known := charsetEncodings[charset]; known {
+			s.Charset = charset
+		}
+	}
+	if v, ok := ec.get("trim_trailing_whitespace"); ok {
+		s.TrimTrailingWhitespace = v == "true"
+	}
+	if v, ok := ec.get("insert_final_newline"); ok && (v == "true" || v == "false") {
+		insert := v == "true"
+		s.InsertFinalNewline = &insert
+	}
+	if v, ok := ec.get("max_line_length"); ok {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			s.Rulers = []int{n}
+		} else if v == "off" {
+			s.Rulers = nil
+		}
+	}
+	return indentSet
+}
+
+// charsetEncodings maps the EditorConfig charsets to encodings. UTF-8 needs
+// none.
+var charsetEncodings = map[string]encoding.Encoding{
+	"utf-8":     nil,
+	"utf-8-bom": nil,
+	"latin1":    charmap.ISO8859_1,
+	"utf-16be":  unicode.UTF16(unicode.BigEndian, unicode.UseBOM),
+	"utf-16le":  unicode.UTF16(unicode.LittleEndian, unicode.UseBOM),
+}
+
+const utf8BOM = "\uFEFF"
+
+// decodeCharset turns file data in charset into text. A UTF-8 byte order
+// mark is dropped whatever the charset.
+func decodeCharset(data []byte, charset string) (string, error) {
+	if enc := charsetEncodings[charset]; enc != nil {
+		decoded, err := enc.NewDecoder().Bytes(data)
+		return strings.TrimPrefix(string(decoded), utf8BOM), err
+	}
+	return strings.TrimPrefix(string(data), utf8BOM), nil
+}
+
+// decodeFile reads the data of a plain file in the charset its .editorconfig
+// gives, falling back to UTF-8 when the data does not decode.
+func decodeFile(filename string, data []byte) string {
+	ec, _ := loadEditorConfig(filename)
+	charset, _ := ec.get("charset")
+	text, err := decodeCharset(data, charset)
+	if err != nil {
+		logIgnored(err, "decode file", "file", filename, "charset", charset)
+		return strings.TrimPrefix(string(data), utf8BOM)
+	}
+	return text
+}
+
+// encodeCharset turns text into file data in charset.
+func encodeCharset(text, charset string) ([]byte, error) {
+	if charset == "utf-8-bom" {
+		return []byte(utf8BOM + text), nil
+	}
+	if enc := charsetEncodings[charset]; enc != nil {
+		return enc.NewEncoder().Bytes([]byte(text))
+	}
+	return []byte(text), nil
+}
+
+// convertLineEndings writes text, which uses LF, with the given end_of_line
+// value, or the platform's line ending when it is empty.
+func convertLineEndings(text, eol string) string {
+	switch eol {
+	case "crlf":
+		return strings.ReplaceAll(text, "\n", "\r\n")
+	case "cr":
+		return strings.ReplaceAll(text, "\n", "\r")
+	case "lf":
+		return text
+	}
+	return convertLineEndingsForOS(text)
+}
+
+// applySaveActions trims trailing whitespace and adds or removes the final
+// newline as the settings ask, as one undo step.
+func (m *Model) applySaveActions() {
+	content := m.textBuffer.GetContent()
+	updated := content
+	if m.settings.TrimTrailingWhitespace {
+		lines := strings.Split(updated, "\n")
+		for i, line := range lines {
+			lines[i] = strings.TrimRight(line, " \t")
+		}
+		updated = strings.Join(lines, "\n")
+	}
+	if insert := m.settings.InsertFinalNewline; insert != nil {
+		if *insert && updated != "" && !strings.HasSuffix(updated, "\n") {
+			updated += "\n"
+		} else if !*insert {
+			updated = strings.TrimRight(updated, "\n")
+		}
+	}
+	if updated != content {
+		m.textBuffer.SetContent(updated)
+		m.invalidateHighlightCache()
+		m.postMovementUpdate()
+	}
+}
+
+// handleEditorConfigInfo lists the .editorconfig files that apply to the
+// buffer and the properties they set.
+func handleEditorConfigInfo(m Model, _ tea.KeyMsg) (tea.Model, tea.Cmd) {
+	ec := m.editorConfig
+	var lines []string
+	if len(ec.files) == 0 {
+		lines = append(lines, helpStyle.Render("No .editorconfig applies to this buffer"))
+	}
+	for _, file := range ec.files {
+		lines = append(lines, "Read "+file)
+	}
+	names := make([]string, 0, len(ec.props))
+	for name := range ec.props {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if len(names) > 0 {
+		lines = append(lines, "")
+	}
+	for _, name := range names {
+		p := ec.props[name]
+		lines = append(lines, fmt.Sprintf("%-26s %-8s %s", name, p.value, helpStyle.Render(p.source)))
+	}
+	lines = append(lines, "", "Indentation: "+strings.ToLower(m.settings.IndentLabel())+" ("+m.settings.IndentSource+")")
+	m.openViewer("EditorConfig", lines)
+	return m, nil
+}
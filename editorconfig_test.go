@@ -0,0 +1,77 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAutoSaveSkipsSaveActions(t *testing.T) {
+	dir := t.TempDir()
+	config := "root = true\n[*]\nend_of_line = lf\ntrim_trailing_whitespace = true\ninsert_final_newline = false\n"
+	if err := os.WriteFile(filepath.Join(dir, ".editorconfig"), []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(dir, "a.txt")
+	m := newTestModel(t, file, nil)
+	if err := m.textBuffer.InsertText("foo \n"); err != nil {
+		t.Fatal(err)
+	}
+	m.updateModified()
+
+	next, _ := m.Update(autoSaveMsg{seq: m.editSeq})
+	m = next.(Model)
+	if got := m.textBuffer.GetContent(); got != "foo \n" {
+		t.Fatalf("auto-save changed the buffer to %q", got)
+	}
+	if data, _ := os.ReadFile(file); string(data) != "foo \n" {
+		t.Fatalf("auto-save wrote %q", data)
+	}
+
+	next, _ = m.handleSave()
+	m = next.(Model)
+	if got := m.textBuffer.GetContent(); got != "foo" {
+		t.Fatalf("explicit save left %q", got)
+	}
+	if data, _ := os.ReadFile(file); string(data) != "foo" {
+		t.Fatalf("explicit save wrote %q", data)
+	}
+}
+
+func TestMatchEditorConfigGlob(t *testing.T) {
+	tests := []struct {
+		glob, rel string
+		want      bool
+	}{
+		{"*", "a/b.go", true},
+		{"*.go", "x/y/z.go", true},
+		{"*.go", "z.gox", false},
+		{"Makefile", "sub/Makefile", true},
+		{"?.md", "a.md", true},
+		{"?.md", "ab.md", false},
+		{"*.{js,ts}", "src/a.ts", true},
+		{"*.{js,ts}", "src/a.py", false},
+		{"{src,lib}/*.c", "lib/a.c", true},
+		{"{src,lib}/*.c", "test/a.c", false},
+		{"file{1..3}.txt", "file2.txt", true},
+		{"file{1..3}.txt", "file4.txt", false},
+		{"file{1..3}.txt", "file10.txt", false},
+		{"v{-1..1}", "v-1", true},
+		{"lib/**.js", "lib/a/b.js", true},
+		{"lib/*.js", "lib/a/b.js", false},
+		{"lib/**/x.js", "lib/a/b/x.js", true},
+		{"/top.txt", "top.txt", true},
+		{"/top.txt", "a/top.txt", false},
+		{"docs/*.md", "docs/a.md", true},
+		{"docs/*.md", "src/docs/a.md", false},
+		{"[!a]*.c", "b.c", true},
+		{"[!a]*.c", "a.c", false},
+		{"[a-c].h", "b.h", true},
+	}
+	for _, tt := range tests {
+		got, err := matchEditorConfigGlob(tt.glob, tt.rel)
+		if err != nil || got != tt.want {
+			t.Errorf("%q against %q: got %v, %v; want %v", tt.glob, tt.rel, got, err, tt.want)
+		}
+	}
+}
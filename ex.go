@@ -0,0 +1,611 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// The command line accepts ex commands in the form [range]name[!] [arg].
+// A range is one or two addresses separated by a comma, where an address is
+// a line number, . (current line), $ (last line), % (whole file) or '< and
+// '> (first and last line of the selection), optionally followed by +N/-N.
+
+// exRange is a zero-based, inclusive line range.
+type exRange struct {
+	start, end int
+	given      bool
+}
+
+type exCommand struct {
+	rng   exRange
+	name  string // canonical command name, or "!" for shell commands
+	bang  bool
+	arg   string
+	input string
+}
+
+// exHandler runs a parsed command. Returned errors are shown in the status bar.
+type exHandler func(m *Model, c exCommand) (tea.Cmd, error)
+
+// exCommandTable lists the commands in completion order. min is the shortest
+// accepted abbreviation, as in vim.
+var exCommandTable = []struct {
+	name string
+	min  int
+	run  exHandler
+}{
+	{"delete", 1, exDelete},
+	{"edit", 1, exEdit},
+	{"quit", 1, exQuit},
+	{"sort", 3, exSort},
+	{"substitute", 1, exSubstitute},
+	{"write", 1, exWrite},
+	{"wq", 2, exWriteQuit},
+	{"xit", 1, exWriteQuit},
+}
+
+func lookupExCommand(typed string) (string, exHandler, bool) {
+	for _, c := range exCommandTable {
+		if len(typed) >= c.min && strings.HasPrefix(c.name, typed) {
+			return c.name, c.run, true
+		}
+	}
+	return "", nil, false
+}
+
+func handleCommandLine(m Model, _ tea.KeyMsg) (tea.Model, tea.Cmd) {
+	m.openCommandLine("")
+	return m, nil
+}
+
+func (m *Model) openCommandLine(initial string) {
+	m.openPrompt(Prompt{
+		ID:       "command",
+		Label:    ":",
+		Complete: completeCommandLine,
+		Submit:   submitCommandLine,
+		Cancel: func(m Model) (tea.Model, tea.Cmd) {
+			if m.vim.enabled && m.vim.mode != VimInsert {
+				m.vimEnterNormal()
+			}
+			return m, nil
+		},
+	}, initial)
+}
+
+func submitCommandLine(m Model, input string) (tea.Model, tea.Cmd) {
+	input = strings.TrimSpace(input)
+	if input == "" {
+		return m, nil
+	}
+
+	// Registered commands can be run by name, e.g. :selectAll
+	if cmd, ok := commands.Lookup(input); ok {
+		if m.vim.enabled && m.vim.mode != VimInsert {
+			m.vimEnterNormal()
+		}
+		return m.runCommand(cmd, tea.KeyMsg{})
+	}
+
+	cmd, err := m.executeEx(input)
+	if err != nil {
+		m.notify(MessageError, err.Error())
+	}
+	if m.vim.enabled && m.vim.mode != VimInsert {
+		m.vimEnterNormal()
+	}
+	m.postMovementUpdate()
+	return m, cmd
+}
+
+func (m *Model) executeEx(input string) (tea.Cmd, error) {
+	c, err := m.parseExCommand(input)
+	if err != nil {
+		return nil, err
+	}
+
+	switch c.name {
+	case "":
+		// A bare range jumps to its last line
+		m.textBuffer.GoToLine(c.rng.end)
+		return nil, nil
+	case "!":
+		return exShell(m, c)
+	}
+	_, run, _ := lookupExCommand(c.name)
+	return run(m, c)
+}
+
+func (m Model) parseExCommand(input string) (exCommand, error) {
+	c := exCommand{input: input}
+	rest, rng, err := m.parseExRange(input)
+	if err != nil {
+		return c, err
+	}
+	c.rng = rng
+	rest = strings.TrimLeft(rest, " \t")
+
+	if strings.HasPrefix(rest, "!") {
+		c.name = "!"
+		c.arg = strings.TrimSpace(rest[1:])
+		if c.arg == "" {
+			return c, errors.New("Argument required")
+		}
+		return c, nil
+	}
+
+	n := 0
+	for n < len(rest) && (rest[n] >= 'a' && rest[n] <= 'z' || rest[n] >= 'A' && rest[n] <= 'Z') {
+		n++
+	}
+	typed := rest[:n]
+	rest = rest[n:]
+	if typed == "" {
+		if rest != "" {
+			return c, fmt.Errorf("Not an editor command: %s", input)
+		}
+		return c, nil
+	}
+
+	name, _, ok := lookupExCommand(typed)
+	if !ok {
+		return c, fmt.Errorf("Not an editor command: %s", input)
+	}
+	c.name = name
+	if strings.HasPrefix(rest, "!") {
+		c.bang = true
+		rest = rest[1:]
+	}
+	if name == "substitute" {
+		c.arg = strings.TrimLeft(rest, " \t")
+	} else {
+		c.arg = strings.TrimSpace(rest)
+	}
+	return c, nil
+}
+
+// parseExRange consumes the range at the start of input. Without a range the
+// current line is used and given is false.
+func (m Model) parseExRange(input string) (string, exRange, error) {
+	cur := m.textBuffer.GetCursor().Line
+	last := m.textBuffer.GetLineCount() - 1
+	rng := exRange{start: cur, end: cur}
+
+	if strings.HasPrefix(input, "%") {
+		return input[1:], exRange{start: 0, end: last, given: true}, nil
+	}
+
+	start, rest, ok, err := m.parseExAddress(input, cur, last)
+	if err != nil || !ok {
+		return rest, rng, err
+	}
+	rng = exRange{start: start, end: start, given: true}
+
+	if strings.HasPrefix(rest, ",") {
+		end, after, ok, err := m.parseExAddress(rest[1:], cur, last)
+		if err != nil {
+			return after, rng, err
+		}
+		if !ok {
+			end = cur
+		}
+		rng.end = end
+		rest = after
+	}
+
+	if rng.start > rng.end {
+		rng.start, rng.end = rng.end, rng.start
+	}
+	if rng.start < 0 || rng.end > last {
+		return rest, rng, errors.New("Invalid range")
+	}
+	return rest, rng, nil
+}
+
+// parseExAddress reads one address and any +N/-N offsets after it.
+func (m Model) parseExAddress(s string, cur, last int) (int, string, bool, error) {
+	line, found := cur, false
+	switch {
+	case s == "":
+		return cur, s, false, nil
+	case s[0] == '.':
+		s, found = s[1:], true
+	case s[0] == '$':
+		line, s, found = last, s[1:], true
+	case strings.HasPrefix(s, "'<"), strings.HasPrefix(s, "'>"):
+		start, end, ok := m.selectionLines()
+		if !ok {
+			return cur, s, false, errors.New("Mark not set")
+		}
+		line = start
+		if s[1] == '>' {
+			line = end
+		}
+		s, found = s[2:], true
+	case s[0] >= '0' && s[0] <= '9':
+		n := 0
+		for n < len(s) && s[n] >= '0' && s[n] <= '9' {
+			n++
+		}
+		num, _ := strconv.Atoi(s[:n])
+		line, s, found = num-1, s[n:], true
+	}
+
+	for len(s) > 0 && (s[0] == '+' || s[0] == '-') {
+		sign := 1
+		if s[0] == '-' {
+			sign = -1
+		}
+		n := 1
+		for n < len(s) && s[n] >= '0' && s[n] <= '9' {
+			n++
+		}
+		offset := 1
+		if n > 1 {
+			offset, _ = strconv.Atoi(s[1:n])
+		}
+		line += sign * offset
+		s, found = s[n:], true
+	}
+	return line, s, found, nil
+}
+
+// selectionLines returns the first and last line touched by the selection.
+func (m Model) selectionLines() (int, int, bool) {
+	sel := m.textBuffer.GetSelection()
+	if sel == nil {
+		return 0, 0, false
+	}
+	first, last := selectedLines(*sel)
+	return first, last, true
+}
+
+// selectedLines returns the first and last line sel covers. A selection that
+// ends at the start of a line does not take that line.
+func selectedLines(sel Selection) (int, int) {
+	start, end := sel.Normalize()
+	if end.Column == 0 && end.Line > start.Line {
+		end.Line--
+	}
+	return start.Line, end.Line
+}
+
+// rangeLines returns a copy of the lines covered by rng.
+func (m Model) rangeLines(rng exRange) []string {
+	lines := m.textBuffer.GetLinesRange(rng.start, rng.end+1)
+	return append([]string(nil), lines...)
+}
+
+// replaceRange swaps the lines in rng for newLines as one undo step.
+func (m *Model) replaceRange(rng exRange, newLines []string) {
+	m.textBuffer.ReplaceLines(rng.start, rng.end, newLines)
+	m.invalidateHighlightCache()
+	m.updateModified()
+}
+
+func exDelete(m *Model, c exCommand) (tea.Cmd, error) {
+	lines := m.rangeLines(c.rng)
+	m.kill(strings.Join(lines, "\n")+"\n", true)
+	m.replaceRange(c.rng, nil)
+	if len(lines) > 1 {
+		m.setMessage(fmt.Sprintf("%d fewer lines", len(lines)))
+	}
+	return nil, nil
+}
+
+func exSort(m *Model, c exCommand) (tea.Cmd, error) {
+	rng := c.rng
+	if !rng.given {
+		rng = exRange{start: 0, end: m.textBuffer.GetLineCount() - 1}
+	}
+
+	var unique, ignoreCase bool
+	for _, flag := range strings.ReplaceAll(c.arg, " ", "") {
+		switch flag {
+		case 'u':
+			unique = true
+		case 'i':
+			ignoreCase = true
+		default:
+			return nil, fmt.Errorf("Invalid argument: %s", c.arg)
+		}
+	}
+
+	sortKey := func(s string) string {
+		if ignoreCase {
+			return strings.ToLower(s)
+		}
+		return s
+	}
+	lines := m.rangeLines(rng)
+	sort.SliceStable(lines, func(i, j int) bool {
+		if c.bang {
+			return sortKey(lines[i]) > sortKey(lines[j])
+		}
+		return sortKey(lines[i]) < sortKey(lines[j])
+	})
+	if unique {
+		deduped := lines[:0]
+		for i, line := range lines {
+			if i == 0 || sortKey(line) != sortKey(deduped[len(deduped)-1]) {
+				deduped = append(deduped, line)
+			}
+		}
+		lines = deduped
+	}
+
+	m.replaceRange(rng, lines)
+	return nil, nil
+}
+
+// exSubstitute implements :s/pattern/replacement/flags. Patterns use Go
+// regular expression syntax; in the replacement & is the whole match, \1-\9
+// are groups and \n inserts a line break. Flags: g (all matches), i (ignore
+// case).
+func exSubstitute(m *Model, c exCommand) (tea.Cmd, error) {
+	if c.arg == "" {
+		return nil, errors.New("Usage: s/pattern/replacement/flags")
+	}
+	parts := splitDelimited(c.arg[1:], c.arg[0], 3)
+	pattern := parts[0]
+	replacement := ""
+	if len(parts) > 1 {
+		replacement = parts[1]
+	}
+	var global, ignoreCase bool
+	if len(parts) > 2 {
+		for _, flag := range strings.TrimSpace(parts[2]) {
+			switch flag {
+			case 'g':
+				global = true
+			case 'i':
+				ignoreCase = true
+			default:
+				return nil, fmt.Errorf("Trailing characters: %s", parts[2])
+			}
+		}
+	}
+
+	if ignoreCase {
+		pattern = "(?i)" + pattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid pattern: %v", err)
+	}
+	template := exReplacementTemplate(replacement)
+
+	lines := m.rangeLines(c.rng)
+	count, changedLines, lastChanged := 0, 0, -1
+	for i, line := range lines {
+		var out []byte
+		pos, n := 0, 0
+		for _, loc := range re.FindAllStringSubmatchIndex(line, -1) {
+			out = append(out, line[pos:loc[0]]...)
+			out = re.ExpandString(out, template, line, loc)
+			pos = loc[1]
+			n++
+			if !global {
+				break
+			}
+		}
+		if n == 0 {
+			continue
+		}
+		lines[i] = string(append(out, line[pos:]...))
+		count += n
+		changedLines++
+		lastChanged = i
+	}
+	if count == 0 {
+		return nil, fmt.Errorf("Pattern not found: %s", parts[0])
+	}
+
+	// Replacements may contain line breaks, so split the result again
+	cursorLine := c.rng.start + strings.Count(strings.Join(lines[:lastChanged+1], "\n"), "\n")
+	m.replaceRange(c.rng, strings.Split(strings.Join(lines, "\n"), "\n"))
+	m.textBuffer.SetCursor(Position{Line: cursorLine})
+	m.setMessage(fmt.Sprintf("%d substitutions on %d lines", count, changedLines))
+	return nil, nil
+}
+
+// splitDelimited splits s on unescaped delim into at most n parts, removing
+// the backslash from escaped delimiters.
+func splitDelimited(s string, delim byte, n int) []string {
+	var parts []string
+	var cur strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && i+1 < len(s) && s[i+1] == delim:
+			cur.WriteByte(delim)
+			i++
+		case s[i] == delim && len(parts) < n-1:
+			parts = append(parts, cur.String())
+			cur.Reset()
+		default:
+			cur.WriteByte(s[i])
+		}
+	}
+	return append(parts, cur.String())
+}
+
+// exReplacementTemplate converts vim replacement syntax into a template for
+// regexp.ExpandString.
+func exReplacementTemplate(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch ch := s[i]; {
+		case ch == '$':
+			b.WriteString("$$")
+		case ch == '&':
+			b.WriteString("${0}")
+		case ch == '\\' && i+1 < len(s):
+			i++
+			switch next := s[i]; {
+			case next >= '0' && next <= '9':
+				b.WriteString("${" + string(next) + "}")
+			case next == 'n':
+				b.WriteByte('\n')
+			case next == 't':
+				b.WriteByte('\t')
+			default:
+				b.WriteByte(next)
+			}
+		default:
+			b.WriteByte(ch)
+		}
+	}
+	return b.String()
+}
+
+// exShell runs :!cmd. With a range the lines are filtered through the command
+// and replaced by its output; otherwise the output is shown as a message.
+func exShell(m *Model, c exCommand) (tea.Cmd, error) {
+	if !c.rng.given {
+		output, err := runShellFilter(c.arg, "")
+		if err != nil {
+			return nil, err
+		}
+		output = strings.TrimSpace(normalizeLineEndings(output))
+		if output == "" {
+			output = "Command finished"
+		}
+		m.setMessage(strings.ReplaceAll(output, "\n", " | "))
+		return nil, nil
+	}
+
+	if m.sensitive {
+		return nil, errors.New("Shell commands are disabled for sensitive buffers")
+	}
+	input := strings.Join(m.rangeLines(c.rng), "\n") + "\n"
+	output, err := runShellFilter(c.arg, input)
+	if err != nil {
+		return nil, err
+	}
+	output = strings.TrimSuffix(normalizeLineEndings(output), "\n")
+	m.replaceRange(c.rng, strings.Split(output, "\n"))
+	return nil, nil
+}
+
+func exQuit(m *Model, c exCommand) (tea.Cmd, error) {
+	if m.modified && !c.bang {
+		return nil, errors.New("No write since last change (add ! to override)")
+	}
+	return tea.Quit, nil
+}
+
+// exWrite saves the buffer. With a path it writes a copy there, or names the
+// buffer if it had no filename yet.
+func exWrite(m *Model, c exCommand) (tea.Cmd, error) {
+	if m.isLocked() {
+		return nil, errors.New("Buffer is locked")
+	}
+	path := c.arg
+	if path == "" || path == m.filename {
+		if m.filename == "" {
+			return nil, errors.New("No file name")
+		}
+		next, cmd := m.handleSave()
+		*m = next.(Model)
+		return cmd, nil
+	}
+
+	if _, err := os.Stat(path); err == nil && !c.bang {
+		return nil, fmt.Errorf("%s exists (add ! to override)", path)
+	}
+	if m.filename == "" {
+		m.filename = path
+		m.applyFileType()
+		next, cmd := m.handleSave()
+		*m = next.(Model)
+		return cmd, nil
+	}
+
+	other := *m
+	other.filename = path
+	if err := other.saveFile(); err != nil {
+		return nil, fmt.Errorf("Error writing %s: %v", path, err)
+	}
+	m.notifyf(MessageSuccess, "Wrote %s", path)
+	return nil, nil
+}
+
+// exWriteQuit implements :wq, which always writes, and :x, which only writes
+// a modified buffer.
+func exWriteQuit(m *Model, c exCommand) (tea.Cmd, error) {
+	if c.name == "wq" || m.modified {
+		if _, err := exWrite(m, c); err != nil {
+			return nil, err
+		}
+		if m.modified {
+			return nil, nil
+		}
+	}
+	return tea.Quit, nil
+}
+
+// exEdit opens another file in place of the current buffer, or reloads the
+// current file when no path is given.
+func exEdit(m *Model, c exCommand) (tea.Cmd, error) {
+	path := c.arg
+	if path == "" {
+		path = m.filename
+	}
+	if path == "" {
+		return nil, errors.New("No file name")
+	}
+	if m.modified && !c.bang {
+		return nil, errors.New("No write since last change (add ! to override)")
+	}
+
+	next := NewModel(path, m.config)
+	next.configPath = m.configPath
+	next.width, next.height = m.width, m.height
+	next.killRing = m.killRing
+	next.messages = append(append([]Notification(nil), m.messages...), next.messages...)
+	if next.notification.Text == "" {
+		next.setMessage(fmt.Sprintf("\"%s\" %d lines", path, next.textBuffer.GetLineCount()))
+	}
+	*m = next
+	return nil, nil
+}
+
+// completeCommandLine completes an ex or registered command name, or a path
+// for :e and :w.
+func completeCommandLine(m Model, input string) (string, []string) {
+	n := len(input) - len(strings.TrimLeft(input, "0123456789.,$%+-'<> "))
+	prefix, rest := input[:n], input[n:]
+
+	name, arg, hasArg := strings.Cut(rest, " ")
+	if !hasArg {
+		var matches []string
+		for _, c := range exCommandTable {
+			if strings.HasPrefix(c.name, name) {
+				matches = append(matches, c.name)
+			}
+		}
+		// Registered commands run by name but take no range
+		if prefix == "" {
+			for _, cmd := range commands.All() {
+				if strings.HasPrefix(cmd.Name, name) {
+					matches = append(matches, cmd.Name)
+				}
+			}
+		}
+		completed, candidates := completeFrom(name, matches)
+		return prefix + completed, candidates
+	}
+
+	if full, _, ok := lookupExCommand(strings.TrimSuffix(name, "!")); !ok || (full != "edit" && full != "write") {
+		return input, nil
+	}
+	completed, candidates := completePath(arg)
+	return prefix + name + " " + completed, candidates
+}
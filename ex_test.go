@@ -0,0 +1,45 @@
+package main
+
+import "testing"
+
+func TestParseExRange(t *testing.T) {
+	m := newTestModel(t, "", nil)
+	m.textBuffer.SetContent("1\n2\n3\n4\n5\n6\n7\n8\n9\n10")
+	m.textBuffer.SetCursor(Position{Line: 4})
+	m.textBuffer.SetSelection(&Selection{Start: Position{Line: 1}, End: Position{Line: 3}})
+
+	tests := []struct {
+		input      string
+		rest       string
+		start, end int
+		given      bool
+		err        bool
+	}{
+		{"d", "d", 4, 4, false, false},
+		{"%s/a/b/", "s/a/b/", 0, 9, true, false},
+		{"3d", "d", 2, 2, true, false},
+		{"2,4d", "d", 1, 3, true, false},
+		{"4,2d", "d", 1, 3, true, false},
+		{".,$d", "d", 4, 9, true, false},
+		{".+1", "", 5, 5, true, false},
+		{"-2,+d", "d", 2, 5, true, false},
+		{"$-3,$", "", 6, 9, true, false},
+		{"3,", "", 2, 4, true, false},
+		{"'<,'>sort", "sort", 1, 2, true, false},
+		{"1,11d", "", 0, 0, false, true},
+		{"0d", "", 0, 0, false, true},
+	}
+	for _, tt := range tests {
+		rest, rng, err := m.parseExRange(tt.input)
+		if (err != nil) != tt.err {
+			t.Errorf("%q: error %v, want error %v", tt.input, err, tt.err)
+			continue
+		}
+		if tt.err {
+			continue
+		}
+		if rest != tt.rest || rng.start != tt.start || rng.end != tt.end || rng.given != tt.given {
+			t.Errorf("%q: got %q %+v, want %q {start:%d end:%d given:%v}", tt.input, rest, rng, tt.rest, tt.start, tt.end, tt.given)
+		}
+	}
+}
@@ -1,38 +1,91 @@
 package main
 
 import (
+	"errors"
 	"fmt"
+	"log/slog"
+	"strings"
 	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
 )
 
 func (m Model) handleSave() (tea.Model, tea.Cmd) {
+	return m.save(true)
+}
+
+// save writes the buffer to its file. Only explicit saves run the formatter
+// and the .editorconfig save actions; an auto-save fires while the user is
+// typing and must not rewrite the text around the cursor.
+func (m Model) save(explicit bool) (tea.Model, tea.Cmd) {
+	if m.isLocked() {
+		m.notify(MessageWarning, "Buffer is locked")
+		return m, nil
+	}
 	if m.filename != "" {
+		if explicit {
+			m.applyFormatter()
+			m.applySaveActions()
+		}
 		err := m.saveFile()
 		if err == nil {
 			m.modified = false
 			m.originalText = m.textBuffer.GetContent()
 			m.lastSaved = time.Now()
-			m.setMessage(flashSuccessStyle.Render("File saved successfully"))
+			m.notify(MessageSuccess, "File saved successfully")
 		} else {
-			m.setMessage(flashErrorStyle.Render(fmt.Sprintf("Error saving file: %v", err)))
+			m.notifyf(MessageError, "Error saving file: %v", err)
 		}
 	} else {
-		m.setMessage(flashWarningStyle.Render("No filename specified"))
+		m.notify(MessageWarning, "No filename specified")
 	}
 	return m, nil
 }
 
+// applyFormatter filters the buffer through the configured formatter. Failures
+// are reported but do not block the save. Sensitive buffers are never handed to
+// external programs.
+func (m *Model) applyFormatter() {
+	if m.settings.Formatter == "" || m.sensitive {
+		return
+	}
+	content := m.textBuffer.GetContent()
+	formatted, err := runShellFilter(m.settings.Formatter, content)
+	if err != nil {
+		m.notify(MessageWarning, err.Error())
+		return
+	}
+	formatted = normalizeLineEndings(formatted)
+	if formatted != content {
+		m.textBuffer.SetContent(formatted)
+		m.invalidateHighlightCache()
+		m.postMovementUpdate()
+	}
+}
+
+func (m Model) handleReloadConfig() (tea.Model, tea.Cmd) {
+	warnings, err := m.reloadConfig()
+	if err != nil {
+		m.notifyf(MessageError, "%v; kept the current configuration", err)
+		return m, nil
+	}
+	if len(warnings) > 0 {
+		m.notify(MessageWarning, strings.Join(warnings, "; "))
+		return m, nil
+	}
+	source := m.config.path
+	if source == "" {
+		source = "defaults"
+	}
+	m.notify(MessageSuccess, "Configuration reloaded from "+source)
+	return m, nil
+}
+
 func (m Model) handleCopy() (tea.Model, tea.Cmd) {
-	if m.textBuffer.HasSelection() {
-		text := m.textBuffer.GetSelectedText()
-		m.clipboard = text
-		if err := copyToClipboard(text); err != nil {
-			m.setMessage("Copied to internal clipboard")
-		} else {
-			m.setMessage("Copied to system clipboard")
-		}
+	if b := m.textBuffer.GetBlock(); b != nil {
+		m.copyBlock(*b, "Copied")
+	} else if m.textBuffer.HasSelection() {
+		m.storeClipboard(KillEntry{Text: strings.Join(m.selectedTexts(), "\n")}, "Copied")
 	} else {
 		m.setMessage("No text selected")
 	}
@@ -40,40 +93,101 @@ func (m Model) handleCopy() (tea.Model, tea.Cmd) {
 }
 
 func (m Model) handleCut() (tea.Model, tea.Cmd) {
-	if m.textBuffer.HasSelection() {
-		text := m.textBuffer.GetSelectedText()
-		m.clipboard = text
-		m.textBuffer.DeleteSelection()
+	if b := m.textBuffer.GetBlock(); b != nil {
+		m.copyBlock(*b, "Cut")
+		top, bottom, left, right := b.bounds()
+		m.textBuffer.ReplaceBlock(top, bottom, left, right, "")
+		m.invalidateHighlightCache()
 		m.updateModified()
-		if err := copyToClipboard(text); err != nil {
-			m.setMessage("Cut to internal clipboard")
-		} else {
-			m.setMessage("Cut to system clipboard")
-		}
+	} else if m.textBuffer.HasSelection() {
+		text := strings.Join(m.selectedTexts(), "\n")
+		logIgnored(m.textBuffer.ForEachCaret(func() error {
+			m.textBuffer.DeleteSelection()
+			return nil
+		}), "cut failed")
+		m.updateModified()
+		m.storeClipboard(KillEntry{Text: text}, "Cut")
 	} else {
 		m.setMessage("No text selected")
 	}
 	return m, nil
 }
 
-func (m Model) handlePaste() (tea.Model, tea.Cmd) {
-	if text, err := pasteFromClipboard(); err == nil && text != "" {
-		if err := m.textBuffer.InsertText(text); err != nil {
-			m.setMessage("Error pasting text")
-			return m, nil
+// storeClipboard pushes e onto the kill ring and mirrors its text through
+// the clipboard provider, reporting which one was used. Sensitive buffers
+// never leave the editor.
+func (m *Model) storeClipboard(e KillEntry, verb string) {
+	e.Sensitive = m.sensitive
+	m.killRing.push(e)
+	text := e.Text
+	provider := m.clipboardProvider
+	switch {
+	case m.sensitive:
+		m.noteSystemClipboard()
+		m.setMessage(verb + " to internal clipboard (sensitive buffer)")
+	case provider.Name() == "internal":
+		m.setMessage(verb + " to internal clipboard")
+	default:
+		if err := provider.Copy(text); err != nil {
+			m.noteSystemClipboard()
+			slog.Warn("clipboard copy failed", "provider", provider.Name(), "error", err)
+			m.notifyf(MessageWarning, "%s to internal clipboard; %s failed: %v", verb, provider.Name(), err)
+			return
 		}
-		m.updateModified()
-		m.setMessage("Pasted from system clipboard")
-	} else if m.clipboard != "" {
-		if err := m.textBuffer.InsertText(m.clipboard); err != nil {
-			m.setMessage("Error pasting text")
-			return m, nil
+		m.killRing.system = text
+		m.setMessage(verb + " via " + provider.Name())
+	}
+}
+
+// noteSystemClipboard records what the system clipboard holds while a newer
+// entry stays in the kill ring only, so that paste can tell it from text
+// another program copies later.
+func (m *Model) noteSystemClipboard() {
+	if text, err := m.clipboardProvider.Paste(); err == nil {
+		m.killRing.system = text
+	}
+}
+
+// handlePaste inserts the newest kill ring entry. When the system clipboard
+// holds text other than what Gecko last copied or pasted there, another
+// program put it there later, so it joins the ring first and is pasted.
+func (m Model) handlePaste() (tea.Model, tea.Cmd) {
+	provider := m.clipboardProvider
+	text, err := provider.Paste()
+	if err != nil && !errors.Is(err, errPasteUnsupported) {
+		slog.Info("clipboard paste failed", "provider", provider.Name(), "error", err)
+	}
+	if err == nil && text != "" && text != m.killRing.system {
+		m.killRing.system = text
+		if e, ok := m.killRing.current(); !ok || e.Text != text {
+			m.killRing.push(KillEntry{Text: text})
 		}
+	}
+
+	entry, ok := m.killRing.current()
+	if !ok {
+		m.setMessage("Nothing to paste")
+		return m, nil
+	}
+	source := "from internal clipboard"
+	if err == nil && text == entry.Text {
+		source = "via " + provider.Name()
+	}
+	if entry.Block || m.textBuffer.GetBlock() != nil {
+		err = m.pasteBlock(entry.Text)
+	} else if m.textBuffer.HasCarets() {
+		err = m.insertAtCarets(entry.Text)
+		m.yankState = yankState{}
 		m.updateModified()
-		m.setMessage("Pasted from internal clipboard")
 	} else {
-		m.setMessage("Nothing to paste")
+		err = m.yank(entry.Text, 0)
 	}
+	if err != nil {
+		slog.Warn("paste failed", "source", source, "error", err)
+		m.notify(MessageError, "Error pasting text")
+		return m, nil
+	}
+	m.setMessage("Pasted " + source)
 	return m, nil
 }
 
@@ -158,4 +272,4 @@ func (m *Model) setSearchMessage() {
 	if len(m.findResults) > 0 {
 		m.setMessage(fmt.Sprintf("Match %d of %d for \"%s\"", m.findIndex+1, len(m.findResults), m.lastSearchQuery))
 	}
-}
\ No newline at end of file
+}
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// helpCategories fixes the order of the help groups. Categories not listed
+// here, such as those named in config commands, follow in order of first
+// appearance.
+var helpCategories = []string{"General", "File", "Edit", "Selection", "Search", "Navigation", "Macros", "Custom"}
+
+// helpEntry is one row of the help overlay.
+type helpEntry struct {
+	category string
+	key      string
+	desc     string
+	name     string
+}
+
+// navigationHelp lists the fixed editing keys that are not commands.
+var navigationHelp = []helpEntry{
+	{"Navigation", "↑/↓/←/→", "Move the cursor", ""},
+	{"Navigation", "ctrl+←/→", "Move by word", ""},
+	{"Navigation", "home/end", "Move to line start/end", ""},
+	{"Navigation", "pgup/pgdn", "Move by page", ""},
+	{"Navigation", "enter", "Confirm a prompt", ""},
+	{"Navigation", "esc", "Cancel a prompt or clear the selection", ""},
+}
+
+// helpEntries builds the help table from the command registry and the active
+// keymap, grouped by category.
+func helpEntries() []helpEntry {
+	byCategory := make(map[string][]helpEntry)
+	order := append([]string(nil), helpCategories...)
+	add := func(e helpEntry) {
+		if _, seen := byCategory[e.category]; !seen && !containsString(order, e.category) {
+			order = append(order, e.category)
+		}
+		byCategory[e.category] = append(byCategory[e.category], e)
+	}
+
+	for _, cmd := range commands.All() {
+		category := cmd.Category
+		if category == "" {
+			category = "Custom"
+		}
+		binding := "—"
+		if b := keys.binding(cmd.Name); b != nil && b.Enabled() {
+			binding = b.Help().Key
+		}
+		add(helpEntry{category, binding, cmd.Description, cmd.Name})
+	}
+	for _, e := range navigationHelp {
+		add(e)
+	}
+
+	var entries []helpEntry
+	for _, category := range order {
+		entries = append(entries, byCategory[category]...)
+	}
+	return entries
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// filterHelpEntries keeps the entries whose key, name, description or
+// category contain the filter, ignoring case.
+func filterHelpEntries(entries []helpEntry, filter string) []helpEntry {
+	filter = strings.ToLower(strings.TrimSpace(filter))
+	if filter == "" {
+		return entries
+	}
+	var kept []helpEntry
+	for _, e := range entries {
+		haystack := strings.ToLower(strings.Join([]string{e.key, e.name, e.desc, e.category}, " "))
+		if strings.Contains(haystack, filter) {
+			kept = append(kept, e)
+		}
+	}
+	return kept
+}
+
+// helpContext describes what the keyboard is currently driving.
+func (m Model) helpContext() string {
+	switch m.minibufferType {
+	case MinibufferPrompt:
+		if m.prompt.Confirm {
+			return fmt.Sprintf("Answering %q: y to confirm, n or esc to cancel", strings.TrimSpace(m.prompt.Label))
+		}
+		desc := fmt.Sprintf("In the %q prompt: enter submits, esc cancels", strings.TrimSpace(m.prompt.Label))
+		if m.prompt.Complete != nil {
+			desc += ", tab completes"
+		}
+		if m.prompt.ID != "" {
+			desc += ", ↑/↓ browse history"
+		}
+		return desc
+	case MinibufferCommandPalette:
+		return "In the command palette: type to filter, ↑/↓ select, enter runs"
+	case MinibufferClipboardHistory:
+		return "In the clipboard history: type to filter, ↑/↓ select, enter pastes"
+	case MinibufferFindResults:
+		return fmt.Sprintf("Browsing %d results for %q: ↑/↓ move, enter jumps, esc closes", len(m.findResults), m.lastSearchQuery)
+	}
+	if m.vim.enabled {
+		return fmt.Sprintf("Vim %s mode", strings.ToLower(m.vim.mode.String()))
+	}
+	if m.isLocked() {
+		return "Buffer is locked"
+	}
+	return "Editing"
+}
+
+// handleHelpKey drives the help overlay: typing filters it, the arrow and
+// page keys scroll it, and the help binding or esc closes it.
+func (m Model) handleHelpKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	m, cmd, matched, held := m.matchBindingKeys(msg, keys.Help)
+	if matched {
+		return m.closeHelp(), nil
+	}
+	if held {
+		return m, cmd
+	}
+
+	page := max(m.helpPageSize(), 1)
+	switch msg.Type {
+	case tea.KeyEscape:
+		if m.helpFilter != "" {
+			m.helpFilter = ""
+			m.helpScroll = 0
+			return m, nil
+		}
+		return m.closeHelp(), nil
+	case tea.KeyUp:
+		m.helpScroll--
+	case tea.KeyDown:
+		m.helpScroll++
+	case tea.KeyPgUp:
+		m.helpScroll -= page
+	case tea.KeyPgDown:
+		m.helpScroll += page
+	case tea.KeyHome:
+		m.helpScroll = 0
+	case tea.KeyEnd:
+		m.helpScroll = len(m.helpRows())
+	case tea.KeyBackspace:
+		if m.helpFilter != "" {
+			runes := []rune(m.helpFilter)
+			m.helpFilter = string(runes[:len(runes)-1])
+			m.helpScroll = 0
+		}
+	case tea.KeyRunes, tea.KeySpace:
+		if msg.Type == tea.KeySpace {
+			m.helpFilter += " "
+		} else {
+			m.helpFilter += string(msg.Runes)
+		}
+		m.helpScroll = 0
+	}
+	m.clampHelpScroll()
+	return m, nil
+}
+
+func (m Model) closeHelp() Model {
+	m.showHelp = false
+	m.helpFilter = ""
+	m.helpScroll = 0
+	return m
+}
+
+// helpPageSize is the number of rows the overlay shows at once.
+func (m Model) helpPageSize() int {
+	// Border, padding, title, context, filter, footer and spacing
+	return m.height - 12
+}
+
+// helpRows groups the filtered entries under category headings.
+func (m Model) helpRows() []helpEntry {
+	var rows []helpEntry
+	category := ""
+	for _, e := range filterHelpEntries(helpEntries(), m.helpFilter) {
+		if e.category != category {
+			category = e.category
+			rows = append(rows, helpEntry{category: category})
+		}
+		rows = append(rows, e)
+	}
+	return rows
+}
+
+func (m *Model) clampHelpScroll() {
+	maxScroll := max(len(m.helpRows())-m.helpPageSize(), 0)
+	m.helpScroll = max(min(m.helpScroll, maxScroll), 0)
+}
+
+func (m Model) renderHelp() string {
+	const keyColumnWidth = 18
+	// Choose help box width based on current terminal size.
+	// Use 60% of width when wide enough, but never exceed terminal minus 4 cols.
+	maxWidth := m.width * 60 / 100
+	if maxWidth > m.width-4 {
+		maxWidth = m.width - 4
+	}
+	// Ensure a sane minimum so content is readable.
+	if maxWidth < 40 {
+		maxWidth = m.width - 4 // in very narrow terminals just use almost full width
+	}
+
+	contentWidth := maxWidth - 3
+	descWidth := contentWidth - keyColumnWidth - 1
+	var help strings.Builder
+
+	title := helpTitleStyle.Render("Text Editor Help")
+	help.WriteString(lipgloss.PlaceHorizontal(contentWidth, lipgloss.Center, title))
+	help.WriteString("\n")
+	help.WriteString(lipgloss.NewStyle().Width(contentWidth).Render(helpStyle.Render(m.helpContext())))
+	help.WriteString("\n\n")
+
+	filter := helpStyle.Render("Type to filter")
+	if m.helpFilter != "" {
+		filter = minibufferPromptStyle.Render("Filter: ") + minibufferInputStyle.Render(m.helpFilter)
+	}
+	help.WriteString(filter + "\n")
+
+	rows := m.helpRows()
+	if len(rows) == 0 {
+		help.WriteString(helpStyle.Render("No matching keys") + "\n")
+	}
+	end := min(m.helpScroll+max(m.helpPageSize(), 1), len(rows))
+	for _, row := range rows[min(m.helpScroll, end):end] {
+		if row.key == "" && row.desc == "" {
+			help.WriteString(helpTitleStyle.Render(row.category) + "\n")
+			continue
+		}
+		key := helpKeyStyle.Render(row.key)
+		key = lipgloss.NewStyle().Width(keyColumnWidth).Render(key)
+
+		desc := lipgloss.NewStyle().
+			Width(descWidth).
+			MaxWidth(descWidth).
+			Render(helpDescStyle.Render(row.desc))
+
+		help.WriteString(key + " " + desc + "\n")
+	}
+
+	help.WriteString("\n")
+	footer := fmt.Sprintf("Press %s again to close help", keys.Help.Help().Key)
+	if len(rows) > m.helpPageSize() {
+		footer = fmt.Sprintf("%d-%d of %d  ↑/↓ PgUp/PgDn scroll  ", m.helpScroll+1, end, len(rows)) + footer
+	}
+	help.WriteString(lipgloss.PlaceHorizontal(contentWidth, lipgloss.Center, helpStyle.Render(footer)))
+
+	return helpBoxStyle.Render(help.String())
+}
+
+// writeKeysMarkdown prints the help table as Markdown, one section per
+// category, for gecko --keys.
+func writeKeysMarkdown(w io.Writer) error {
+	escape := strings.NewReplacer("|", `\|`).Replace
+	category := ""
+	for _, e := range helpEntries() {
+		if e.category != category {
+			if category != "" {
+				fmt.Fprintln(w)
+			}
+			category = e.category
+			fmt.Fprintf(w, "## %s\n\n| Key | Command | Description |\n| --- | --- | --- |\n", category)
+		}
+		keyCell := e.key
+		if keyCell != "—" {
+			keyCell = "`" + escape(keyCell) + "`"
+		}
+		if _, err := fmt.Fprintf(w, "| %s | %s | %s |\n", keyCell, escape(e.name), escape(e.desc)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,377 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// indentRules says how Enter indents in one language: after a line ending in
+// one of the openers the new line gets one more level of indentation.
+type indentRules struct {
+	openers []string
+}
+
+var defaultIndentRules = indentRules{openers: []string{"{", "(", "["}}
+
+// indentRulesByLexer is keyed by chroma lexer name. Languages not listed use
+// the bracket rules, which also suit plain text.
+var indentRulesByLexer = map[string]indentRules{
+	"Python":   {openers: []string{"{", "(", "[", ":"}},
+	"Python 2": {openers: []string{"{", "(", "[", ":"}},
+	"YAML":     {openers: []string{":", "|", ">"}},
+	"Bash":     {openers: []string{"{", "(", "[", "then", "do", "else", "in"}},
+	"Lua":      {openers: []string{"{", "(", "[", "then", "do", "else", "repeat"}},
+	"Ruby":     {openers: []string{"{", "(", "[", "do", "then", "else"}},
+	"Elixir":   {openers: []string{"{", "(", "[", "do", "->"}},
+}
+
+// closingBrackets maps each closing bracket to its opener.
+var closingBrackets = map[byte]byte{'}': '{', ')': '(', ']': '['}
+
+func indentRulesFor(lexerName string) indentRules {
+	if rules, ok := indentRulesByLexer[lexerName]; ok {
+		return rules
+	}
+	return defaultIndentRules
+}
+
+// opens reports whether a line ending in text opens a block. Word openers
+// such as "then" must not be the tail of a longer word.
+func (r indentRules) opens(text string) bool {
+	text = strings.TrimRight(text, " \t")
+	for _, opener := range r.openers {
+		rest, ok := strings.CutSuffix(text, opener)
+		if !ok {
+			continue
+		}
+		if !isWordByte(opener[0]) || rest == "" || !isWordByte(rest[len(rest)-1]) {
+			return true
+		}
+	}
+	return false
+}
+
+func isWordByte(b byte) bool {
+	return b == '_' || unicode.IsLetter(rune(b)) || unicode.IsDigit(rune(b))
+}
+
+func (m Model) indentRules() indentRules {
+	return indentRulesFor(m.highlighter.LexerName())
+}
+
+// insertNewline breaks the line at the cursor, indenting the new line like
+// the current one plus a level after an opener. Between a pair of brackets
+// the closing bracket moves to a line of its own.
+func (m Model) insertNewline() error {
+	cursor := m.textBuffer.GetCursor()
+	line := m.textBuffer.GetLine(cursor.Line)
+	if m.textBuffer.HasSelection() {
+		start, _ := m.textBuffer.GetSelection().Normalize()
+		cursor, line = start, m.textBuffer.GetLine(start.Line)
+	}
+	before, after := line[:cursor.Column], strings.TrimLeft(line[cursor.Column:], " \t")
+	indent := before[:firstNonBlank(before)]
+	if !m.indentRules().opens(before) {
+		return m.textBuffer.InsertText("\n" + indent)
+	}
+
+	inner := indent + m.settings.IndentUnit()
+	trimmed := strings.TrimRight(before, " \t")
+	last := trimmed[len(trimmed)-1]
+	if after != "" && closingBrackets[after[0]] == last {
+		if err := m.textBuffer.InsertText("\n" + inner + "\n" + indent); err != nil {
+			return err
+		}
+		m.textBuffer.SetCursor(Position{Line: cursor.Line + 1, Column: len(inner)})
+		return nil
+	}
+	return m.textBuffer.InsertText("\n" + inner)
+}
+
+// insertClosingBracket types a closing bracket. As the first character on a
+// line it also lines the line up with the line of the matching opener, or
+// takes away one level when there is none.
+func (m Model) insertClosingBracket(closer byte) error {
+	cursor := m.textBuffer.GetCursor()
+	line := m.textBuffer.GetLine(cursor.Line)
+	before := line[:min(cursor.Column, len(line))]
+	if m.textBuffer.HasSelection() || strings.TrimLeft(before, " \t") != "" {
+		return m.textBuffer.InsertText(string(closer))
+	}
+
+	indent, ok := m.openerIndent(cursor, closer)
+	if !ok {
+		indent = dedent(before, m.settings.TabWidth)
+	}
+	if indent == before {
+		return m.textBuffer.InsertText(string(closer))
+	}
+	m.textBuffer.SetSelection(&Selection{Start: Position{Line: cursor.Line}, End: cursor})
+	return m.textBuffer.InsertText(indent + string(closer))
+}
+
+// openerIndent finds the bracket that a closer typed at pos would match and
+// returns the indentation of its line.
+func (m Model) openerIndent(pos Position, closer byte) (string, bool) {
+	opener := closingBrackets[closer]
+	depth := 0
+	for l := pos.Line; l >= 0; l-- {
+		text := m.textBuffer.GetLine(l)
+		end := len(text)
+		if l == pos.Line {
+			end = min(pos.Column, end)
+		}
+		for i := end - 1; i >= 0; i-- {
+			switch text[i] {
+			case closer:
+				depth++
+			case opener:
+				if depth == 0 {
+					return text[:firstNonBlank(text)], true
+				}
+				depth--
+			}
+		}
+	}
+	return "", false
+}
+
+// dedent removes one level of indentation, a tab or up to width spaces, from
+// the end of indent.
+func dedent(indent string, width int) string {
+	if strings.HasSuffix(indent, "\t") {
+		return indent[:len(indent)-1]
+	}
+	n := len(indent) - len(strings.TrimRight(indent, " "))
+	return indent[:len(indent)-min(n, max(width, 1))]
+}
+
+// backspace deletes the character before the cursor, both halves of an empty
+// pair such as (), or in the leading whitespace of a line indented with
+// spaces, back to the previous indent stop.
+func (m Model) backspace() error {
+	if ok, err := m.deletePair(); ok {
+		return err
+	}
+	cursor := m.textBuffer.GetCursor()
+	line := m.textBuffer.GetLine(cursor.Line)
+	before := line[:min(cursor.Column, len(line))]
+	width := m.settings.TabWidth
+	if m.textBuffer.HasSelection() || before == "" || strings.TrimLeft(before, " ") != "" || width < 2 {
+		return m.textBuffer.DeleteChar(true)
+	}
+	n := len(before) % width
+	if n == 0 {
+		n = width
+	}
+	m.textBuffer.SetSelection(&Selection{Start: Position{Line: cursor.Line, Column: len(before) - n}, End: cursor})
+	return m.textBuffer.DeleteChar(true)
+}
+
+// maxIndentSample caps how many lines detectIndent reads.
+const maxIndentSample = 1000
+
+// detectIndent guesses a buffer's indent style from its leading whitespace.
+// Tabs win when more lines start with a tab than with spaces. The width of a
+// space indent is the most common increase in indentation from one indented
+// line to the next. ok is false when no line is indented.
+func detectIndent(lines []string) (spaces bool, width int, ok bool) {
+	var tabLines, spaceLines int
+	steps := make(map[int]int)
+	prev := 0
+	for _, line := range lines[:min(len(lines), maxIndentSample)] {
+		trimmed := strings.TrimLeft(line, " \t")
+		// Skip blank lines and the " * " of block comments
+		if trimmed == "" || strings.HasPrefix(trimmed, "*") {
+			continue
+		}
+		switch line[0] {
+		case '\t':
+			tabLines++
+			prev = 0
+			continue
+		case ' ':
+			spaceLines++
+		}
+		n := len(line) - len(strings.TrimLeft(line, " "))
+		if step := n - prev; step > 1 && step <= 8 {
+			steps[step]++
+		}
+		prev = n
+	}
+	if tabLines == 0 && spaceLines == 0 {
+		return false, 0, false
+	}
+	if tabLines > spaceLines {
+		return false, 0, true
+	}
+	for step, count := range steps {
+		if count > steps[width] || (count == steps[width] && step < width) {
+			width = step
+		}
+	}
+	if width == 0 {
+		return false, 0, false
+	}
+	return true, width, true
+}
+
+// indentColumns is the display width of indentation, with tabs advancing to
+// the next multiple of tabWidth.
+func indentColumns(indent string, tabWidth int) int {
+	cols := 0
+	for _, c := range indent {
+		if c == '\t' {
+			cols += tabWidth - cols%tabWidth
+		} else {
+			cols++
+		}
+	}
+	return cols
+}
+
+// makeIndent builds indentation cols wide, from tabs and then spaces unless
+// spaces is set.
+func makeIndent(cols, tabWidth int, spaces bool) string {
+	if spaces {
+		return strings.Repeat(" ", cols)
+	}
+	return strings.Repeat("\t", cols/tabWidth) + strings.Repeat(" ", cols%tabWidth)
+}
+
+// insertTab indents from the cursor: a tab, or with spaces, enough of them
+// to reach the next indent stop.
+func (m Model) insertTab() error {
+	if !m.settings.InsertSpaces {
+		return m.textBuffer.InsertText("\t")
+	}
+	cursor := m.textBuffer.GetCursor()
+	if m.textBuffer.HasSelection() {
+		cursor, _ = m.textBuffer.GetSelection().Normalize()
+	}
+	width := max(m.settings.TabWidth, 1)
+	col := displayColumn(m.textBuffer.GetLine(cursor.Line), cursor.Column)
+	return m.textBuffer.InsertText(strings.Repeat(" ", width-col%width))
+}
+
+// spansLines reports whether any cursor's selection covers more than one
+// line.
+func (m Model) spansLines() bool {
+	for _, c := range m.cursors() {
+		if c.Selection != nil && c.Selection.Start.Line != c.Selection.End.Line {
+			return true
+		}
+	}
+	return false
+}
+
+// cursors returns the primary cursor followed by the secondary ones.
+func (m Model) cursors() []Caret {
+	primary := Caret{Pos: m.textBuffer.GetCursor(), Selection: m.textBuffer.GetSelection()}
+	return append([]Caret{primary}, m.textBuffer.Carets()...)
+}
+
+// shiftIndent adds (dir 1) or removes (dir -1) one level of indentation on
+// the selected lines, or the cursor line, of every cursor as one undo step.
+// Blank lines are left alone, a line under several cursors moves once, and
+// the selections stay on the same text.
+func (m *Model) shiftIndent(dir int) {
+	cursors := m.cursors()
+	marked := make(map[int]bool)
+	first, last := cursors[0].Pos.Line, cursors[0].Pos.Line
+	for _, c := range cursors {
+		from, to := c.Pos.Line, c.Pos.Line
+		if c.Selection != nil {
+			from, to = selectedLines(*c.Selection)
+		}
+		for line := from; line <= to; line++ {
+			marked[line] = true
+		}
+		first, last = min(first, from), max(last, to)
+	}
+
+	lines := m.rangeLines(exRange{start: first, end: last})
+	shifts := make([]int, len(lines))
+	width := max(m.settings.TabWidth, 1)
+	for i, line := range lines {
+		if !marked[first+i] || strings.TrimSpace(line) == "" {
+			continue
+		}
+		indent := line[:firstNonBlank(line)]
+		cols := indentColumns(indent, width)
+		if dir > 0 {
+			cols += width
+		} else {
+			// Outdent to the previous indent stop
+			cols = max(cols-1, 0) / width * width
+		}
+		newIndent := makeIndent(cols, width, m.settings.InsertSpaces)
+		lines[i] = newIndent + line[len(indent):]
+		shifts[i] = len(newIndent) - len(indent)
+	}
+	m.replaceRange(exRange{start: first, end: last}, lines)
+
+	shift := func(p Position) Position {
+		if p.Line < first || p.Line > last || (p.Column == 0 && dir > 0) {
+			return p
+		}
+		p.Column = max(p.Column+shifts[p.Line-first], 0)
+		return p
+	}
+	for i, c := range cursors {
+		c.Pos = shift(c.Pos)
+		if c.Selection != nil {
+			c.Selection = &Selection{Start: shift(c.Selection.Start), End: shift(c.Selection.End)}
+		}
+		cursors[i] = c
+	}
+	m.textBuffer.SetCursor(cursors[0].Pos)
+	m.textBuffer.SetSelection(cursors[0].Selection)
+	m.textBuffer.SetCarets(cursors[1:])
+	m.postMovementUpdate()
+}
+
+func handleIndentLines(m Model, _ tea.KeyMsg) (tea.Model, tea.Cmd) {
+	m.shiftIndent(1)
+	return m, nil
+}
+
+func handleOutdentLines(m Model, _ tea.KeyMsg) (tea.Model, tea.Cmd) {
+	m.shiftIndent(-1)
+	return m, nil
+}
+
+func handleIndentToSpaces(m Model, _ tea.KeyMsg) (tea.Model, tea.Cmd) {
+	return m.convertIndent(true)
+}
+
+func handleIndentToTabs(m Model, _ tea.KeyMsg) (tea.Model, tea.Cmd) {
+	return m.convertIndent(false)
+}
+
+// convertIndent rewrites the indentation of every line with spaces or tabs
+// as one undo step and makes that the buffer's indent style.
+func (m Model) convertIndent(spaces bool) (tea.Model, tea.Cmd) {
+	width := max(m.settings.TabWidth, 1)
+	lines := m.textBuffer.GetLines()
+	changed := 0
+	for i, line := range lines {
+		indent := line[:firstNonBlank(line)]
+		if newIndent := makeIndent(indentColumns(indent, width), width, spaces); newIndent != indent {
+			lines[i] = newIndent + line[len(indent):]
+			changed++
+		}
+	}
+	m.settings.InsertSpaces = spaces
+	m.settings.IndentSource = "command"
+	if changed > 0 {
+		m.textBuffer.SetContent(strings.Join(lines, "\n"))
+		m.invalidateHighlightCache()
+		m.updateModified()
+	}
+	m.setMessage(fmt.Sprintf("Indentation set to %s; %d lines changed", strings.ToLower(m.settings.IndentLabel()), changed))
+	return m, nil
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestDetectIndentStyle(t *testing.T) {
+	tests := []struct {
+		name   string
+		src    string
+		spaces bool
+		width  int
+		ok     bool
+	}{
+		{"two spaces", "a\n  b\n    c\n  d\n", true, 2, true},
+		{"four spaces", "a {\n    b {\n        c\n    }\n}", true, 4, true},
+		{"tabs", "a\n\tb\n\t\tc\n    d", false, 0, true},
+		{"no indentation", "a\nb", false, 0, false},
+		{"empty", "", false, 0, false},
+		{"block comment stars skipped", "/*\n * x\n */\nf {\n    y\n}", true, 4, true},
+		{"blank lines skipped", "a\n\n   \n  b\n\n    c", true, 2, true},
+		{"ties go to the smaller step", "a\n  b\nc\n    d", true, 2, true},
+		{"one space is not a step", "a\n b\nc", false, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spaces, width, ok := detectIndent(strings.Split(tt.src, "\n"))
+			if spaces != tt.spaces || width != tt.width || ok != tt.ok {
+				t.Errorf("got (%v, %d, %v), want (%v, %d, %v)", spaces, width, ok, tt.spaces, tt.width, tt.ok)
+			}
+		})
+	}
+}
+
+func TestIndentSettingsPrecedence(t *testing.T) {
+	spaces, width := true, 8
+	tests := []struct {
+		name   string
+		editor LanguageSettings
+		want   string
+		source string
+	}{
+		{"detected over defaults", LanguageSettings{}, "Spaces: 2", "detected"},
+		{"config over detection", LanguageSettings{InsertSpaces: &spaces, TabWidth: &width}, "Spaces: 8", "config"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			cfg.Editor = tt.editor
+			m := newTestModel(t, "", cfg)
+			m.textBuffer.SetContent("a\n  b\n    c")
+			m.resolveSettings()
+			if got := m.settings.IndentLabel(); got != tt.want || m.settings.IndentSource != tt.source {
+				t.Errorf("got %s (%s), want %s (%s)", got, m.settings.IndentSource, tt.want, tt.source)
+			}
+		})
+	}
+
+	m := newTestModel(t, "", nil)
+	m.textBuffer.SetContent("a\n  b")
+	m.resolveSettings()
+	next, _ := handleIndentToTabs(m, tea.KeyMsg{})
+	m = next.(Model)
+	if m.settings.InsertSpaces || m.settings.IndentSource != "command" {
+		t.Errorf("after converting: spaces %v, source %q", m.settings.InsertSpaces, m.settings.IndentSource)
+	}
+
+	before := m.theme.Name
+	next, _ = handleThemePicker(m, tea.KeyMsg{})
+	next, _ = next.(Model).handleThemePickerInput(tea.KeyMsg{Type: tea.KeyDown})
+	m = next.(Model)
+	if m.theme.Name == before {
+		t.Fatal("the picker did not preview another theme")
+	}
+	if m.settings.InsertSpaces || m.settings.IndentSource != "command" {
+		t.Errorf("after a theme preview: spaces %v, source %q", m.settings.InsertSpaces, m.settings.IndentSource)
+	}
+}
+
+func TestShiftIndentAtEveryCursor(t *testing.T) {
+	m := newTestModel(t, "", nil)
+	m.settings.InsertSpaces, m.settings.TabWidth = true, 4
+	m.textBuffer.SetContent("a\nb\nc\nd xy")
+	m.textBuffer.SetSelection(&Selection{Start: Position{0, 0}, End: Position{1, 1}})
+	m.textBuffer.SetCursor(Position{1, 1})
+	m.textBuffer.PushCaret(Position{3, 2}, nil)
+	m.textBuffer.PushCaret(Position{3, 4}, nil)
+
+	next, _ := handleTextModification(m, tea.KeyMsg{Type: tea.KeyTab})
+	m = next.(Model)
+	if got, want := m.textBuffer.GetContent(), "    a\n    b\nc\n    d xy"; got != want {
+		t.Fatalf("Tab left %q, want %q", got, want)
+	}
+	if got := m.textBuffer.GetCursor(); got != (Position{3, 8}) {
+		t.Errorf("cursor at %v", got)
+	}
+
+	next, _ = handleTextModification(m, tea.KeyMsg{Type: tea.KeyShiftTab})
+	m = next.(Model)
+	if got, want := m.textBuffer.GetContent(), "a\nb\nc\nd xy"; got != want {
+		t.Fatalf("Shift+Tab left %q, want %q", got, want)
+	}
+	var carets []Position
+	for _, c := range m.cursors() {
+		carets = append(carets, c.Pos)
+	}
+	if want := []Position{{3, 4}, {1, 1}, {3, 2}}; !slices.Equal(carets, want) {
+		t.Errorf("cursors at %v, want %v", carets, want)
+	}
+	if !m.textBuffer.Undo() || m.textBuffer.GetContent() != "    a\n    b\nc\n    d xy" {
+		t.Errorf("undo left %q", m.textBuffer.GetContent())
+	}
+}
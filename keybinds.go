@@ -1,6 +1,11 @@
 package main
 
 import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
 	"github.com/charmbracelet/bubbles/key"
 )
 
@@ -25,87 +30,387 @@ type KeyMap struct {
 	ShiftRight key.Binding
 	AltLeft    key.Binding
 	AltRight   key.Binding
+
+	ReloadConfig   key.Binding
+	CommandPalette key.Binding
+	CommandLine    key.Binding
+
+	// extra holds bindings for registered commands that have no field above,
+	// such as those defined by plugins or the config file.
+	extra map[string]*key.Binding
+}
+
+// keyAction ties a command name, as used in [keybindings], to the binding
+// that triggers it.
+type keyAction struct {
+	name    string
+	binding *key.Binding
+}
+
+// actions lists the bindable actions in matching and help order, built-in
+// actions first.
+func (k *KeyMap) actions() []keyAction {
+	actions := []keyAction{
+		{"quit", &k.Quit},
+		{"save", &k.Save},
+		{"help", &k.Help},
+		{"goto", &k.GoToLine},
+		{"find", &k.Find},
+		{"findNext", &k.FindNext},
+		{"findPrev", &k.FindPrev},
+		{"copy", &k.Copy},
+		{"cut", &k.Cut},
+		{"paste", &k.Paste},
+		{"undo", &k.Undo},
+		{"redo", &k.Redo},
+		{"selectAll", &k.SelectAll},
+		{"shiftLeft", &k.ShiftLeft},
+		{"shiftRight", &k.ShiftRight},
+		{"shiftUp", &k.ShiftUp},
+		{"shiftDown", &k.ShiftDown},
+		{"altLeft", &k.AltLeft},
+		{"altRight", &k.AltRight},
+		{"reload", &k.ReloadConfig},
+		{"palette", &k.CommandPalette},
+		{"commandLine", &k.CommandLine},
+	}
+
+	names := make([]string, 0, len(k.extra))
+	for name := range k.extra {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		actions = append(actions, keyAction{name, k.extra[name]})
+	}
+	return actions
+}
+
+// binding returns the binding for an action name, or nil if it is unknown.
+func (k *KeyMap) binding(name string) *key.Binding {
+	for _, a := range k.actions() {
+		if a.name == name {
+			return a.binding
+		}
+	}
+	return nil
+}
+
+// commandBinding returns the binding for a registered command without a
+// built-in binding, creating a disabled one on first use.
+func (k *KeyMap) commandBinding(name string) *key.Binding {
+	if b := k.binding(name); b != nil {
+		return b
+	}
+	cmd, ok := commands.Lookup(name)
+	if !ok {
+		return nil
+	}
+	if k.extra == nil {
+		k.extra = make(map[string]*key.Binding)
+	}
+	b := key.NewBinding(key.WithHelp("", cmd.Description), key.WithDisabled())
+	k.extra[name] = &b
+	return &b
 }
 
-var keys = KeyMap{
-	Save: key.NewBinding(
-		key.WithKeys("ctrl+s"),
-		key.WithHelp("ctrl+s", "save file"),
-	),
-	Quit: key.NewBinding(
-		key.WithKeys("ctrl+q"),
-		key.WithHelp("ctrl+q", "quit"),
-	),
-	Help: key.NewBinding(
-		key.WithKeys("ctrl+h"),
-		key.WithHelp("ctrl+h", "toggle help"),
-	),
-	Copy: key.NewBinding(
-		key.WithKeys("ctrl+c"),
-		key.WithHelp("ctrl+c", "copy"),
-	),
-	Cut: key.NewBinding(
-		key.WithKeys("ctrl+x"),
-		key.WithHelp("ctrl+x", "cut"),
-	),
-	Paste: key.NewBinding(
-		key.WithKeys("ctrl+v"),
-		key.WithHelp("ctrl+v", "paste"),
-	),
-	Undo: key.NewBinding(
-		key.WithKeys("ctrl+z"),
-		key.WithHelp("ctrl+z", "undo"),
-	),
-	Redo: key.NewBinding(
-		key.WithKeys("ctrl+y"),
-		key.WithHelp("ctrl+y", "redo"),
-	),
-	SelectAll: key.NewBinding(
-		key.WithKeys("ctrl+a"),
-		key.WithHelp("ctrl+a", "select all"),
-	),
-	GoToLine: key.NewBinding(
-		key.WithKeys("ctrl+g"),
-		key.WithHelp("ctrl+g", "go to line"),
-	),
-	Find: key.NewBinding(
-		key.WithKeys("ctrl+f"),
-		key.WithHelp("ctrl+f", "find"),
-	),
-	FindNext: key.NewBinding(
-		key.WithKeys("ctrl+n"),
-		key.WithHelp("ctrl+n", "find next"),
-	),
-	FindPrev: key.NewBinding(
-		key.WithKeys("ctrl+l"),
-		key.WithHelp("ctrl+l", "find previous"),
-	),
-	Delete: key.NewBinding(
-		key.WithKeys("backspace"),
-		key.WithHelp("backspace", "delete"),
-	),
-	ShiftLeft: key.NewBinding(
-		key.WithKeys("shift+left"),
-		key.WithHelp("shift+left", "select text left"),
-	),
-	ShiftRight: key.NewBinding(
-		key.WithKeys("shift+right"),
-		key.WithHelp("shift+right", "select text right"),
-	),
-	ShiftUp: key.NewBinding(
-		key.WithKeys("shift+up"),
-		key.WithHelp("shift+up", "select text up"),
-	),
-	ShiftDown: key.NewBinding(
-		key.WithKeys("shift+down"),
-		key.WithHelp("shift+down", "select text down"),
-	),
-	AltLeft: key.NewBinding(
-		key.WithKeys("alt+left"),
-		key.WithHelp("alt+left", "select previous word"),
-	),
-	AltRight: key.NewBinding(
-		key.WithKeys("alt+right"),
-		key.WithHelp("alt+right", "select next word"),
-	),
-}
\ No newline at end of file
+var keys = defaultKeyMap()
+
+func defaultKeyMap() KeyMap {
+	return KeyMap{
+		Save: key.NewBinding(
+			key.WithKeys("ctrl+s"),
+			key.WithHelp("ctrl+s", "save file"),
+		),
+		Quit: key.NewBinding(
+			key.WithKeys("ctrl+q"),
+			key.WithHelp("ctrl+q", "quit"),
+		),
+		Help: key.NewBinding(
+			key.WithKeys("ctrl+h", "f1"),
+			key.WithHelp("ctrl+h/f1", "toggle help"),
+		),
+		Copy: key.NewBinding(
+			key.WithKeys("ctrl+c"),
+			key.WithHelp("ctrl+c", "copy"),
+		),
+		Cut: key.NewBinding(
+			key.WithKeys("ctrl+x"),
+			key.WithHelp("ctrl+x", "cut"),
+		),
+		Paste: key.NewBinding(
+			key.WithKeys("ctrl+v"),
+			key.WithHelp("ctrl+v", "paste"),
+		),
+		Undo: key.NewBinding(
+			key.WithKeys("ctrl+z"),
+			key.WithHelp("ctrl+z", "undo"),
+		),
+		Redo: key.NewBinding(
+			key.WithKeys("ctrl+y"),
+			key.WithHelp("ctrl+y", "redo"),
+		),
+		SelectAll: key.NewBinding(
+			key.WithKeys("ctrl+a"),
+			key.WithHelp("ctrl+a", "select all"),
+		),
+		GoToLine: key.NewBinding(
+			key.WithKeys("ctrl+g"),
+			key.WithHelp("ctrl+g", "go to line"),
+		),
+		Find: key.NewBinding(
+			key.WithKeys("ctrl+f"),
+			key.WithHelp("ctrl+f", "find"),
+		),
+		FindNext: key.NewBinding(
+			key.WithKeys("ctrl+n"),
+			key.WithHelp("ctrl+n", "find next"),
+		),
+		FindPrev: key.NewBinding(
+			key.WithKeys("ctrl+l"),
+			key.WithHelp("ctrl+l", "find previous"),
+		),
+		Delete: key.NewBinding(
+			key.WithKeys("backspace"),
+			key.WithHelp("backspace", "delete"),
+		),
+		ShiftLeft: key.NewBinding(
+			key.WithKeys("shift+left"),
+			key.WithHelp("shift+left", "select text left"),
+		),
+		ShiftRight: key.NewBinding(
+			key.WithKeys("shift+right"),
+			key.WithHelp("shift+right", "select text right"),
+		),
+		ShiftUp: key.NewBinding(
+			key.WithKeys("shift+up"),
+			key.WithHelp("shift+up", "select text up"),
+		),
+		ShiftDown: key.NewBinding(
+			key.WithKeys("shift+down"),
+			key.WithHelp("shift+down", "select text down"),
+		),
+		AltLeft: key.NewBinding(
+			key.WithKeys("alt+left"),
+			key.WithHelp("alt+left", "select previous word"),
+		),
+		AltRight: key.NewBinding(
+			key.WithKeys("alt+right"),
+			key.WithHelp("alt+right", "select next word"),
+		),
+		ReloadConfig: key.NewBinding(
+			key.WithKeys("ctrl+r"),
+			key.WithHelp("ctrl+r", "reload config"),
+		),
+		CommandPalette: key.NewBinding(
+			key.WithKeys("ctrl+p"),
+			key.WithHelp("ctrl+p", "command palette"),
+		),
+		CommandLine: key.NewBinding(
+			key.WithKeys("ctrl+e"),
+			key.WithHelp("ctrl+e", "command line"),
+		),
+	}
+}
+
+// keymapPresets override the default bindings to mimic other editors. Actions
+// not listed keep their default keys.
+var keymapPresets = map[string]map[string][]string{
+	"nano": {
+		"save":      {"ctrl+o"},
+		"quit":      {"ctrl+x"},
+		"help":      {"ctrl+g", "f1"},
+		"find":      {"ctrl+w"},
+		"findNext":  {"alt+w"},
+		"findPrev":  {"alt+q"},
+		"goto":      {"ctrl+_"},
+		"cut":       {"ctrl+k"},
+		"paste":     {"ctrl+u"},
+		"copy":      {"alt+6"},
+		"undo":      {"alt+u"},
+		"redo":      {"alt+e"},
+		"selectAll": {"alt+a"},
+		"reload":    {"alt+r"},
+	},
+	"emacs": {
+		"save":      {"ctrl+x ctrl+s"},
+		"quit":      {"ctrl+x ctrl+c"},
+		"selectAll": {"ctrl+x h"},
+		"find":      {"ctrl+s"},
+		"findNext":  {"alt+n"},
+		"findPrev":  {"ctrl+r"},
+		"goto":      {"alt+g"},
+		"copy":      {"alt+w"},
+		"cut":       {"ctrl+w"},
+		"paste":     {"ctrl+y"},
+		"undo":      {"ctrl+_"},
+		"redo":      {"alt+_"},
+		"reload":    {"alt+r"},
+		"palette":   {"alt+x"},
+	},
+	// Terminals send ctrl+shift+letter as plain ctrl+letter and ctrl+/ as
+	// ctrl+_, so those chords use the nearest keys that arrive intact.
+	"vscode": {
+		"palette":           {"f1", "alt+P"},
+		"help":              {"ctrl+k ctrl+s"},
+		"findNext":          {"f3", "ctrl+n"},
+		"toggleComment":     {"ctrl+_"},
+		"deleteLines":       {"alt+K"},
+		"duplicateLines":    {"alt+shift+down", "alt+shift+up"},
+		"indentLines":       {"ctrl+]"},
+		"addCursorAbove":    {"ctrl+shift+up"},
+		"addCursorBelow":    {"ctrl+shift+down"},
+		"addNextOccurrence": {"ctrl+d"},
+		"moveLinesUp":       {"alt+up"},
+		"moveLinesDown":     {"alt+down"},
+		"blockUp":           {"alt+ctrl+up"},
+		"blockDown":         {"alt+ctrl+down"},
+		"blockLeft":         {"alt+ctrl+left"},
+		"blockRight":        {"alt+ctrl+right"},
+	},
+}
+
+// ambiguousTerminalKeys are chords that many terminals cannot tell apart from
+// another key, so a binding that relies on them alone may never fire.
+var ambiguousTerminalKeys = map[string]string{
+	"ctrl+h": "backspace",
+	"ctrl+i": "tab",
+	"ctrl+m": "enter",
+	"ctrl+[": "escape",
+}
+
+// KeyList is a list of keys for one action. Config files may give a single
+// string or an array of strings; an empty list unbinds the action.
+type KeyList []string
+
+func (k *KeyList) UnmarshalTOML(v any) error {
+	switch val := v.(type) {
+	case string:
+		*k = KeyList{val}
+	case []any:
+		list := make(KeyList, 0, len(val))
+		for _, item := range val {
+			s, ok := item.(string)
+			if !ok {
+				return fmt.Errorf("key must be a string, got %T", item)
+			}
+			list = append(list, s)
+		}
+		*k = list
+	default:
+		return fmt.Errorf("keys must be a string or array, got %T", v)
+	}
+	return nil
+}
+
+func (k *KeyList) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*k = KeyList{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return fmt.Errorf("keys must be a string or array: %w", err)
+	}
+	*k = list
+	return nil
+}
+
+// buildKeyMap starts from the defaults, applies the named preset and then the
+// per-action overrides. Problems are returned as human-readable warnings
+// rather than errors so a bad binding never prevents the editor from starting.
+func buildKeyMap(preset string, overrides map[string]KeyList) (KeyMap, []string) {
+	km := defaultKeyMap()
+	var warnings []string
+
+	for _, cmd := range commands.All() {
+		if len(cmd.Keys) > 0 && km.binding(cmd.Name) == nil {
+			setBindingKeys(km.commandBinding(cmd.Name), cmd.Keys)
+		}
+	}
+
+	if preset != "" && preset != "default" {
+		if bindings, ok := keymapPresets[preset]; ok {
+			for name, ks := range bindings {
+				setBindingKeys(km.commandBinding(name), ks)
+			}
+		} else {
+			warnings = append(warnings, fmt.Sprintf("unknown keymap preset %q", preset))
+		}
+	}
+
+	names := make([]string, 0, len(overrides))
+	for name := range overrides {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		b := km.commandBinding(name)
+		if b == nil {
+			warnings = append(warnings, fmt.Sprintf("unknown action %q in keybindings", name))
+			continue
+		}
+		setBindingKeys(b, overrides[name])
+	}
+
+	warnings = append(warnings, km.conflicts()...)
+	return km, warnings
+}
+
+// setBindingKeys rebinds b and keeps its help text in sync with the new keys.
+func setBindingKeys(b *key.Binding, ks []string) {
+	desc := b.Help().Desc
+	if len(ks) == 0 {
+		b.SetKeys()
+		b.SetEnabled(false)
+		return
+	}
+	b.SetKeys(ks...)
+	b.SetEnabled(true)
+	b.SetHelp(strings.Join(ks, "/"), desc)
+}
+
+// conflicts reports keys bound to more than one action, bindings that make a
+// longer sequence unreachable, and actions that can only be triggered by keys
+// terminals commonly misreport.
+func (k *KeyMap) conflicts() []string {
+	owners := make(map[string][]string)
+	var warnings []string
+
+	for _, a := range k.actions() {
+		if !a.binding.Enabled() {
+			continue
+		}
+		ambiguous := true
+		for _, ks := range a.binding.Keys() {
+			owners[ks] = append(owners[ks], a.name)
+			first, _, _ := strings.Cut(ks, " ")
+			if _, ok := ambiguousTerminalKeys[first]; !ok {
+				ambiguous = false
+			}
+		}
+		if ambiguous {
+			first, _, _ := strings.Cut(a.binding.Keys()[0], " ")
+			warnings = append(warnings, fmt.Sprintf("%s: %s is sent as %s by many terminals", a.name, first, ambiguousTerminalKeys[first]))
+		}
+	}
+
+	bound := make([]string, 0, len(owners))
+	for ks := range owners {
+		bound = append(bound, ks)
+	}
+	sort.Strings(bound)
+	for _, ks := range bound {
+		if names := owners[ks]; len(names) > 1 {
+			warnings = append(warnings, fmt.Sprintf("%s is bound to %s", ks, strings.Join(names, " and ")))
+		}
+		for _, longer := range bound {
+			if strings.HasPrefix(longer, ks+" ") {
+				warnings = append(warnings, fmt.Sprintf("%s (%s) hides %s (%s)",
+					ks, strings.Join(owners[ks], ", "), longer, strings.Join(owners[longer], ", ")))
+			}
+		}
+	}
+	return warnings
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"slices"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestVSCodePreset(t *testing.T) {
+	km, warnings := buildKeyMap("vscode", nil)
+	if len(warnings) > 0 {
+		t.Errorf("warnings: %q", warnings)
+	}
+	tests := []struct {
+		action, key string
+	}{
+		{"palette", "f1"},
+		{"toggleComment", "ctrl+_"},
+		{"deleteLines", "alt+K"},
+		{"addNextOccurrence", "ctrl+d"},
+		{"moveLinesUp", "alt+up"},
+		{"moveLinesDown", "alt+down"},
+		{"duplicateLines", "alt+shift+down"},
+		{"addCursorAbove", "ctrl+shift+up"},
+		{"blockUp", "alt+ctrl+up"},
+		{"goto", "ctrl+g"},
+	}
+	for _, tt := range tests {
+		b := km.binding(tt.action)
+		if b == nil || !slices.Contains(b.Keys(), tt.key) {
+			t.Errorf("%s is not bound to %s", tt.action, tt.key)
+		}
+	}
+}
+
+func TestHelpChord(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Keymap = "vscode"
+	t.Cleanup(func() { keys, _ = buildKeyMap(DefaultConfig().Keymap, nil) })
+	chord := []tea.KeyMsg{{Type: tea.KeyCtrlK}, {Type: tea.KeyCtrlS}}
+
+	m := pressKeys(newTestModel(t, "", cfg), chord...)
+	if !m.showHelp {
+		t.Fatal("the chord did not open help")
+	}
+	if m = pressKeys(m, chord...); m.showHelp {
+		t.Fatal("the chord did not close help")
+	}
+
+	m.openPrompt(Prompt{Label: "Go to line: "}, "")
+	if m = pressKeys(m, chord...); !m.showHelp {
+		t.Fatal("the chord did not open help from a prompt")
+	}
+
+	m = newTestModel(t, "", cfg)
+	m.openPrompt(passphrasePrompt(), "")
+	if m = pressKeys(m, chord...); m.showHelp {
+		t.Fatal("the chord opened help over a passphrase prompt")
+	}
+}
@@ -0,0 +1,438 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+const (
+	killRingFileName    = "killring.json"
+	defaultKillRingSize = 30
+)
+
+// KillEntry is one copied or cut text.
+type KillEntry struct {
+	Text string `json:"text"`
+	// Linewise entries hold whole lines, which vim puts above or below the
+	// cursor line.
+	Linewise bool `json:"linewise,omitempty"`
+	// Block entries come from a block selection and paste as a rectangle.
+	Block bool `json:"block,omitempty"`
+	// Sensitive entries come from sensitive buffers and are never saved.
+	Sensitive bool `json:"-"`
+}
+
+// KillRing keeps the most recent copies and cuts, newest first, and the named
+// registers. Like the prompt history it is shared by every copy of the model,
+// and it survives :e.
+type KillRing struct {
+	path      string // set while the ring persists across sessions
+	size      int
+	system    string               // system clipboard text as Gecko last copied or pasted it
+	Entries   []KillEntry          `json:"entries"`
+	Registers map[string]KillEntry `json:"registers"`
+}
+
+func newKillRing() *KillRing {
+	return &KillRing{size: defaultKillRingSize, Registers: make(map[string]KillEntry)}
+}
+
+// configure sets the ring size and turns persistence on or off. Turning it on
+// loads the saved ring behind the entries of this session.
+func (r *KillRing) configure(size int, persist bool) {
+	r.size = size
+	defer r.trim()
+	if !persist {
+		r.path = ""
+		return
+	}
+	if r.path != "" {
+		return
+	}
+	dir, err := configDir()
+	if err != nil {
+		slog.Warn("kill ring not persisted", "error", err)
+		return
+	}
+	r.path = filepath.Join(dir, killRingFileName)
+
+	data, err := os.ReadFile(r.path)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			slog.Warn("ignoring unreadable kill ring", "path", r.path, "error", err)
+		}
+		return
+	}
+	var saved KillRing
+	if err := json.Unmarshal(data, &saved); err != nil {
+		slog.Warn("ignoring unreadable kill ring", "path", r.path, "error", err)
+		return
+	}
+	r.Entries = append(r.Entries, saved.Entries...)
+	for name, e := range saved.Registers {
+		if _, ok := r.Registers[name]; !ok {
+			r.Registers[name] = e
+		}
+	}
+}
+
+// push adds e as the newest entry, moving an identical older entry to the
+// front, and saves the ring.
+func (r *KillRing) push(e KillEntry) {
+	if e.Text == "" {
+		return
+	}
+	r.Entries = append([]KillEntry{e}, r.Entries...)
+	r.trim()
+	r.save()
+}
+
+// trim drops duplicate texts, keeping the newest, and entries beyond the
+// ring size.
+func (r *KillRing) trim() {
+	seen := make(map[string]bool, len(r.Entries))
+	kept := r.Entries[:0]
+	for _, e := range r.Entries {
+		if !seen[e.Text] {
+			seen[e.Text] = true
+			kept = append(kept, e)
+		}
+	}
+	r.Entries = kept[:min(len(kept), max(r.size, 1))]
+}
+
+// current returns the newest entry, which paste inserts.
+func (r *KillRing) current() (KillEntry, bool) {
+	if len(r.Entries) == 0 {
+		return KillEntry{}, false
+	}
+	return r.Entries[0], true
+}
+
+// promote moves entry i to the front, so the next paste inserts it again.
+func (r *KillRing) promote(i int) {
+	e := r.Entries[i]
+	r.Entries = append(r.Entries[:i:i], r.Entries[i+1:]...)
+	r.push(e)
+}
+
+func (r *KillRing) setRegister(name string, e KillEntry) {
+	r.Registers[name] = e
+	r.save()
+}
+
+func (r *KillRing) registerNames() []string {
+	names := make([]string, 0, len(r.Registers))
+	for name := range r.Registers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// save writes the ring without its sensitive entries when persistence is on.
+func (r *KillRing) save() {
+	if r.path == "" {
+		return
+	}
+	saved := KillRing{Registers: make(map[string]KillEntry)}
+	for _, e := range r.Entries {
+		if !e.Sensitive {
+			saved.Entries = append(saved.Entries, e)
+		}
+	}
+	for name, e := range r.Registers {
+		if !e.Sensitive {
+			saved.Registers[name] = e
+		}
+	}
+	data, err := json.MarshalIndent(saved, "", "  ")
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(r.path), 0755)
+	}
+	if err == nil {
+		err = os.WriteFile(r.path, data, 0600)
+	}
+	if err != nil {
+		slog.Warn("saving kill ring failed", "path", r.path, "error", err)
+	}
+}
+
+// yankState remembers the text the last paste inserted so yank-pop can
+// replace it with an older entry.
+type yankState struct {
+	start, end Position
+	index      int
+	editSeq    int // the edit the paste made; any later edit ends the yank
+}
+
+// kill records copied or cut text in the kill ring without mirroring it to
+// the system clipboard.
+func (m *Model) kill(text string, linewise bool) {
+	m.killRing.push(KillEntry{Text: text, Linewise: linewise, Sensitive: m.sensitive})
+	m.noteSystemClipboard()
+}
+
+// yank inserts text at the cursor, replacing the selection, and remembers
+// where it went for yank-pop.
+func (m *Model) yank(text string, index int) error {
+	start := m.textBuffer.GetCursor()
+	if m.textBuffer.HasSelection() {
+		start, _ = m.textBuffer.GetSelection().Normalize()
+	}
+	if err := m.textBuffer.InsertText(text); err != nil {
+		return err
+	}
+	m.updateModified()
+	m.yankState = yankState{start: start, end: m.textBuffer.GetCursor(), index: index, editSeq: m.editSeq}
+	return nil
+}
+
+// handleYankPop replaces the text just pasted with the next older kill ring
+// entry, wrapping around at the oldest.
+func handleYankPop(m Model, _ tea.KeyMsg) (tea.Model, tea.Cmd) {
+	y := m.yankState
+	if y.editSeq == 0 || y.editSeq != m.editSeq || m.textBuffer.GetCursor() != y.end {
+		m.notify(MessageWarning, "Yank-pop only works right after a paste")
+		return m, nil
+	}
+	if len(m.killRing.Entries) < 2 {
+		m.setMessage("No older clipboard entries")
+		return m, nil
+	}
+	index := (y.index + 1) % len(m.killRing.Entries)
+	m.textBuffer.SetSelection(&Selection{Start: y.start, End: y.end})
+	if err := m.yank(m.killRing.Entries[index].Text, index); err != nil {
+		slog.Warn("yank-pop failed", "error", err)
+		m.notify(MessageError, "Error pasting text")
+		return m, nil
+	}
+	m.ensureCursorVisible()
+	m.hint(fmt.Sprintf("Clipboard entry %d of %d", index+1, len(m.killRing.Entries)))
+	return m, nil
+}
+
+// handleCopyToRegister asks for a register name and stores the selection
+// in it.
+func handleCopyToRegister(m Model, _ tea.KeyMsg) (tea.Model, tea.Cmd) {
+	text := m.textBuffer.GetSelectedText()
+	m.openPrompt(Prompt{
+		ID:       "register",
+		Label:    "Copy to register: ",
+		Validate: validateRegisterName,
+		Complete: completeRegisters,
+		Submit: func(m Model, name string) (tea.Model, tea.Cmd) {
+			m.killRing.setRegister(name, KillEntry{Text: text, Sensitive: m.sensitive})
+			m.notifyf(MessageSuccess, "Copied to register %q", name)
+			return m, nil
+		},
+	}, "")
+	return m, nil
+}
+
+// handleInsertRegister asks for a register name and inserts its text.
+func handleInsertRegister(m Model, _ tea.KeyMsg) (tea.Model, tea.Cmd) {
+	if len(m.killRing.Registers) == 0 {
+		m.setMessage("No registers set")
+		return m, nil
+	}
+	m.openPrompt(Prompt{
+		ID:    "register",
+		Label: "Insert register: ",
+		Validate: func(m Model, name string) error {
+			if _, ok := m.killRing.Registers[name]; !ok {
+				return fmt.Errorf("Register %q is empty", name)
+			}
+			return nil
+		},
+		Complete: completeRegisters,
+		Submit: func(m Model, name string) (tea.Model, tea.Cmd) {
+			return m.pasteEntry(m.killRing.Registers[name], -1, "register "+name)
+		},
+	}, "")
+	return m, nil
+}
+
+func validateRegisterName(_ Model, name string) error {
+	if name == "" || strings.ContainsAny(name, " \t") {
+		return errors.New("Register names are single words")
+	}
+	return nil
+}
+
+func completeRegisters(m Model, input string) (string, []string) {
+	var matches []string
+	for _, name := range m.killRing.registerNames() {
+		if strings.HasPrefix(name, input) {
+			matches = append(matches, name)
+		}
+	}
+	return completeFrom(input, matches)
+}
+
+// pasteEntry inserts e and reports where it came from. index is the entry's
+// position in the ring, or -1 for a register.
+func (m Model) pasteEntry(e KillEntry, index int, source string) (tea.Model, tea.Cmd) {
+	if err := m.yank(e.Text, max(index, 0)); err != nil {
+		slog.Warn("paste failed", "source", source, "error", err)
+		m.notify(MessageError, "Error pasting text")
+		return m, nil
+	}
+	if index < 0 {
+		m.yankState = yankState{}
+	}
+	m.ensureCursorVisible()
+	m.setMessage("Pasted from " + source)
+	return m, nil
+}
+
+// clipboardItem is a row of the clipboard history picker: a ring entry or a
+// named register.
+type clipboardItem struct {
+	label string
+	entry KillEntry
+	index int // position in the ring, -1 for registers
+}
+
+func handleClipboardHistory(m Model, _ tea.KeyMsg) (tea.Model, tea.Cmd) {
+	if len(m.killRing.Entries) == 0 && len(m.killRing.Registers) == 0 {
+		m.setMessage("Clipboard history is empty")
+		return m, nil
+	}
+	m.minibufferType = MinibufferClipboardHistory
+	m.minibufferInput = ""
+	m.minibufferCursorPos = 0
+	m.paletteIndex = 0
+	m.paletteOffset = 0
+	return m, nil
+}
+
+// clipboardItems lists the ring entries, newest first, then the registers,
+// filtered by the picker input. Sensitive entries match only by label so the
+// filter cannot be used to probe their text.
+func (m Model) clipboardItems() []clipboardItem {
+	var items []clipboardItem
+	for i, e := range m.killRing.Entries {
+		items = append(items, clipboardItem{label: fmt.Sprint(i + 1), entry: e, index: i})
+	}
+	for _, name := range m.killRing.registerNames() {
+		items = append(items, clipboardItem{label: `"` + name, entry: m.killRing.Registers[name], index: -1})
+	}
+
+	if m.minibufferInput == "" {
+		return items
+	}
+	var matches []clipboardItem
+	query := strings.ToLower(m.minibufferInput)
+	for _, item := range items {
+		if (!item.entry.Sensitive && strings.Contains(strings.ToLower(item.entry.Text), query)) || strings.Contains(item.label, m.minibufferInput) {
+			matches = append(matches, item)
+		}
+	}
+	return matches
+}
+
+// handleClipboardHistoryInput filters the picker as the user types. Enter
+// pastes the highlighted entry; a ring entry also moves to the front.
+func (m Model) handleClipboardHistoryInput(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.Type {
+	case tea.KeyEscape:
+		m.closeMinibuffer()
+		return m, nil
+	case tea.KeyEnter:
+		items := m.clipboardItems()
+		m.closeMinibuffer()
+		if m.paletteIndex >= len(items) {
+			return m, nil
+		}
+		item := items[m.paletteIndex]
+		if item.index < 0 {
+			return m.pasteEntry(item.entry, -1, "register "+strings.TrimPrefix(item.label, `"`))
+		}
+		m.killRing.promote(item.index)
+		return m.pasteEntry(item.entry, 0, "clipboard history")
+	case tea.KeyUp:
+		m.movePickerSelection(-1)
+	case tea.KeyDown:
+		m.movePickerSelection(1)
+	case tea.KeyRunes, tea.KeySpace:
+		next, _ := handleTextInput(m, msg)
+		m = next.(Model)
+		m.paletteIndex, m.paletteOffset = 0, 0
+	default:
+		next, _ := handleEditingKeys(m, msg)
+		m = next.(Model)
+		m.paletteIndex, m.paletteOffset = 0, 0
+	}
+	return m, nil
+}
+
+func (m *Model) closeMinibuffer() {
+	m.minibufferType = MinibufferNone
+	m.minibufferInput = ""
+	m.minibufferCursorPos = 0
+}
+
+func (m Model) getClipboardHistoryHeight() int {
+	rows := min(len(m.clipboardItems()), m.maxResultsDisplay)
+	return 1 + max(rows, 1)
+}
+
+func (m Model) renderClipboardHistoryMinibuffer() string {
+	var lines []string
+
+	input := renderMinibufferInput(m.minibufferInput, m.minibufferCursorPos)
+	lines = append(lines, minibufferPromptStyle.Render("Clipboard: ")+minibufferInputStyle.Render(input))
+
+	items := m.clipboardItems()
+	if len(items) == 0 {
+		lines = append(lines, helpStyle.Render("  No matching entries"))
+	}
+
+	previewWidth := max(m.width-40, 10)
+	end := min(m.paletteOffset+m.maxResultsDisplay, len(items))
+	for i := m.paletteOffset; i < end; i++ {
+		item := items[i]
+		row := "  " + lipgloss.NewStyle().Width(12).Render(item.label) +
+			lipgloss.NewStyle().Width(previewWidth).Render(clipboardPreview(item.entry, previewWidth)) +
+			"  " + clipboardSize(item.entry.Text)
+		if i == m.paletteIndex {
+			row = searchResultSelectedStyle.Render(row)
+		} else {
+			row = searchResultNormalStyle.Render(row)
+		}
+		lines = append(lines, row)
+	}
+
+	return minibufferStyle.Width(m.width - 2).Render(strings.Join(lines, "\n"))
+}
+
+// clipboardPreview shows an entry on one line, marking line breaks and tabs.
+// Sensitive entries are masked.
+func clipboardPreview(e KillEntry, width int) string {
+	if e.Sensitive {
+		return "•••••• (sensitive)"
+	}
+	preview := strings.NewReplacer("\n", "↵", "\t", "→").Replace(e.Text)
+	if utf8.RuneCountInString(preview) > width {
+		preview = string([]rune(preview)[:width-1]) + "…"
+	}
+	return preview
+}
+
+func clipboardSize(text string) string {
+	if n := strings.Count(text, "\n"); n > 0 {
+		return fmt.Sprintf("%d lines", n+1)
+	}
+	return fmt.Sprintf("%d chars", utf8.RuneCountInString(text))
+}
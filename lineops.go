@@ -0,0 +1,167 @@
+package main
+
+import (
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// lineRange returns the lines a line command works on: those the selection
+// touches, or the cursor line.
+func (m Model) lineRange() (int, int) {
+	if first, last, ok := m.selectionLines(); ok {
+		return first, last
+	}
+	line := m.textBuffer.GetCursor().Line
+	return line, line
+}
+
+// shiftSelection moves the cursor and the selection, if any, down by delta
+// lines, as after the lines under them moved.
+func (m *Model) shiftSelection(cursor Position, sel *Selection, delta int) {
+	if sel != nil {
+		m.textBuffer.SetSelection(&Selection{
+			Start: Position{Line: sel.Start.Line + delta, Column: sel.Start.Column},
+			End:   Position{Line: sel.End.Line + delta, Column: sel.End.Column},
+		})
+	}
+	m.textBuffer.SetCursor(Position{Line: cursor.Line + delta, Column: cursor.Column})
+}
+
+func handleMoveLinesUp(m Model, _ tea.KeyMsg) (tea.Model, tea.Cmd) {
+	return m.moveLines(-1)
+}
+
+func handleMoveLinesDown(m Model, _ tea.KeyMsg) (tea.Model, tea.Cmd) {
+	return m.moveLines(1)
+}
+
+// moveLines moves the selected lines, or the cursor line, one line up or
+// down past their neighbour.
+func (m Model) moveLines(dir int) (tea.Model, tea.Cmd) {
+	first, last := m.lineRange()
+	if first+dir < 0 || last+dir >= m.textBuffer.GetLineCount() {
+		return m, nil
+	}
+	cursor, sel := m.textBuffer.GetCursor(), m.textBuffer.GetSelection()
+	block := m.rangeLines(exRange{start: first, end: last})
+	if dir < 0 {
+		m.replaceRange(exRange{start: first - 1, end: last}, append(block, m.textBuffer.GetLine(first-1)))
+	} else {
+		m.replaceRange(exRange{start: first, end: last + 1}, append([]string{m.textBuffer.GetLine(last + 1)}, block...))
+	}
+	m.shiftSelection(cursor, sel, dir)
+	m.postMovementUpdate()
+	return m, nil
+}
+
+// handleDuplicateLines copies the selected lines, or the cursor line, below
+// themselves and moves the selection onto the copy.
+func handleDuplicateLines(m Model, _ tea.KeyMsg) (tea.Model, tea.Cmd) {
+	first, last := m.lineRange()
+	cursor, sel := m.textBuffer.GetCursor(), m.textBuffer.GetSelection()
+	block := m.rangeLines(exRange{start: first, end: last})
+	m.replaceRange(exRange{start: first, end: last}, append(block, block...))
+	m.shiftSelection(cursor, sel, last-first+1)
+	m.postMovementUpdate()
+	return m, nil
+}
+
+// handleDeleteLines removes the selected lines, or the cursor line, keeping
+// the cursor column on the line that takes their place.
+func handleDeleteLines(m Model, _ tea.KeyMsg) (tea.Model, tea.Cmd) {
+	first, last := m.lineRange()
+	column := m.textBuffer.GetCursor().Column
+	m.replaceRange(exRange{start: first, end: last}, nil)
+	line := min(first, m.textBuffer.GetLineCount()-1)
+	m.textBuffer.SetCursor(Position{Line: line, Column: column})
+	m.postMovementUpdate()
+	return m, nil
+}
+
+// handleJoinLines joins the selected lines, or the cursor line and the next
+// one. Indentation of the joined lines and trailing whitespace before each
+// join collapse to one space, and no space is added next to an empty line or
+// before a closing bracket. The cursor ends at the last join.
+func handleJoinLines(m Model, _ tea.KeyMsg) (tea.Model, tea.Cmd) {
+	first, last := m.lineRange()
+	if first == last {
+		last++
+	}
+	if last >= m.textBuffer.GetLineCount() {
+		return m, nil
+	}
+	lines := m.rangeLines(exRange{start: first, end: last})
+	joined := lines[0]
+	var column int
+	for _, next := range lines[1:] {
+		joined = strings.TrimRight(joined, " \t")
+		next = strings.TrimLeft(next, " \t")
+		column = len(joined)
+		if joined != "" && next != "" && !strings.ContainsAny(next[:1], ")]}") {
+			joined += " "
+		}
+		joined += next
+	}
+	m.replaceRange(exRange{start: first, end: last}, []string{joined})
+	m.textBuffer.SetCursor(Position{Line: first, Column: column})
+	m.postMovementUpdate()
+	return m, nil
+}
+
+func handleInsertLineAbove(m Model, _ tea.KeyMsg) (tea.Model, tea.Cmd) {
+	return m.insertLine(0)
+}
+
+func handleInsertLineBelow(m Model, _ tea.KeyMsg) (tea.Model, tea.Cmd) {
+	return m.insertLine(1)
+}
+
+// insertLine opens an empty line above (offset 0) or below (offset 1) the
+// cursor line with the same indentation and puts the cursor on it.
+func (m Model) insertLine(offset int) (tea.Model, tea.Cmd) {
+	line := m.textBuffer.GetCursor().Line
+	text := m.textBuffer.GetLine(line)
+	indent := text[:firstNonBlank(text)]
+	lines := []string{indent, text}
+	if offset > 0 {
+		lines = []string{text, indent}
+	}
+	m.replaceRange(exRange{start: line, end: line}, lines)
+	m.textBuffer.SetCursor(Position{Line: line + offset, Column: len(indent)})
+	if m.vim.enabled {
+		m.vim.mode = VimInsert
+	}
+	m.postMovementUpdate()
+	return m, nil
+}
+
+// handleTransposeLines swaps the cursor line with the line above and moves
+// the cursor down, so repeating it drags a line towards the end of the file.
+func handleTransposeLines(m Model, _ tea.KeyMsg) (tea.Model, tea.Cmd) {
+	cursor := m.textBuffer.GetCursor()
+	if cursor.Line == 0 {
+		m.setMessage("No line above to transpose with")
+		return m, nil
+	}
+	prev, cur := m.textBuffer.GetLine(cursor.Line-1), m.textBuffer.GetLine(cursor.Line)
+	m.replaceRange(exRange{start: cursor.Line - 1, end: cursor.Line}, []string{cur, prev})
+	m.textBuffer.SetCursor(Position{Line: min(cursor.Line+1, m.textBuffer.GetLineCount()-1), Column: cursor.Column})
+	m.postMovementUpdate()
+	return m, nil
+}
+
+// handleSortLines sorts the selected lines, like :sort over the selection,
+// and selects the sorted lines.
+func handleSortLines(m Model, _ tea.KeyMsg) (tea.Model, tea.Cmd) {
+	first, last := m.lineRange()
+	if _, err := exSort(&m, exCommand{rng: exRange{start: first, end: last, given: true}}); err != nil {
+		m.notify(MessageError, err.Error())
+		return m, nil
+	}
+	end := Position{Line: last, Column: len(m.textBuffer.GetLine(last))}
+	m.textBuffer.SetSelection(&Selection{Start: Position{Line: first}, End: end})
+	m.textBuffer.SetCursor(end)
+	m.postMovementUpdate()
+	return m, nil
+}
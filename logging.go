@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+const (
+	logFileName   = "gecko.log"
+	maxLogSize    = 1 << 20 // bytes before the log rotates
+	maxLogBackups = 3
+)
+
+// logPath is the file slog writes to, or "" when logging is off. The program
+// owns the terminal while it runs, so logs never go to stderr.
+var logPath string
+
+// setupLogging routes slog to a rotating file. With neither debug nor a
+// path, log records are discarded. The returned closer flushes the file.
+func setupLogging(path string, debug bool) (io.Closer, error) {
+	if path == "" && !debug {
+		slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+		return io.NopCloser(nil), nil
+	}
+
+	if path == "" {
+		dir, err := configDir()
+		if err != nil {
+			return nil, err
+		}
+		path = filepath.Join(dir, logFileName)
+	}
+	w, err := openRotatingFile(path, maxLogSize, maxLogBackups)
+	if err != nil {
+		return nil, err
+	}
+
+	level := slog.LevelInfo
+	if debug {
+		level = slog.LevelDebug
+	}
+	slog.SetDefault(slog.New(slog.NewTextHandler(w, &slog.HandlerOptions{Level: level})))
+	logPath = path
+	return w, nil
+}
+
+// logIgnored records an error the editor recovers from without telling the
+// user, such as a cursor move past the end of the buffer. It logs at Warn so
+// that a log file written without --debug still shows it.
+func logIgnored(err error, msg string, args ...any) {
+	if err != nil {
+		slog.Warn(msg, append(args, "error", err)...)
+	}
+}
+
+// rotatingFile is an append-only log that renames itself to path.1 once it
+// reaches maxSize, keeping up to backups old files.
+type rotatingFile struct {
+	mu      sync.Mutex
+	path    string
+	maxSize int64
+	backups int
+	file    *os.File
+	size    int64
+}
+
+func openRotatingFile(path string, maxSize int64, backups int) (*rotatingFile, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	r := &rotatingFile{path: path, maxSize: maxSize, backups: backups}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *rotatingFile) open() error {
+	f, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	r.file = f
+	r.size = info.Size()
+	return nil
+}
+
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.size+int64(len(p)) > r.maxSize && r.size > 0 {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+// rotate shifts path.N-1 to path.N down to path to path.1 and starts a new
+// file.
+func (r *rotatingFile) rotate() error {
+	if err := r.file.Close(); err != nil {
+		return err
+	}
+	for i := r.backups; i > 0; i-- {
+		src := r.path
+		if i > 1 {
+			src = fmt.Sprintf("%s.%d", r.path, i-1)
+		}
+		if err := os.Rename(src, fmt.Sprintf("%s.%d", r.path, i)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if r.backups == 0 {
+		if err := os.Remove(r.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return r.open()
+}
+
+func (r *rotatingFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.file.Close()
+}
+
+// handleShowLog opens the current log file read-only, scrolled to the end.
+func handleShowLog(m Model, _ tea.KeyMsg) (tea.Model, tea.Cmd) {
+	if logPath == "" {
+		m.notify(MessageWarning, "Logging is off; start gecko with --debug or --log-file")
+		return m, nil
+	}
+	data, err := os.ReadFile(logPath)
+	if err != nil {
+		m.notifyf(MessageError, "Cannot read log: %v", err)
+		return m, nil
+	}
+	lines := strings.Split(strings.TrimRight(normalizeLineEndings(string(data)), "\n"), "\n")
+	m.openViewer(logPath, lines)
+	m.viewer.scrollToEnd(m.viewerPageSize())
+	return m, nil
+}
@@ -0,0 +1,376 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+const (
+	macroFileName  = "macros.json"
+	maxMacroRepeat = 10000
+)
+
+// macroState records keyboard macros. Keys are captured in Update after
+// handleKey, so the key that starts recording is never part of the macro.
+type macroState struct {
+	recording bool
+	replaying bool
+	keys      []tea.KeyMsg
+	// mark is the length of keys after the last key that completed a
+	// command. Stopping from the palette, the command line or a chord drops
+	// the keys typed after it.
+	mark int
+	last []tea.KeyMsg
+}
+
+// typingSecrets reports whether keys typed now may be secret: in a sensitive
+// buffer or at a masked prompt such as a passphrase. Such keys are never
+// recorded, like the sensitive entries the kill ring never saves.
+func (m Model) typingSecrets() bool {
+	return m.sensitive || (m.minibufferType == MinibufferPrompt && m.prompt.Masked)
+}
+
+// recordKey appends a key handled while recording. next is the model after
+// the key was handled. Recording stops, keeping the previous macro, as soon
+// as a key could be secret.
+func (m Model) recordKey(next Model, msg tea.KeyMsg) Model {
+	if !m.macro.recording || !next.macro.recording || next.macro.replaying {
+		return next
+	}
+	if m.typingSecrets() || next.typingSecrets() {
+		next.macro = macroState{last: next.macro.last}
+		next.notify(MessageWarning, "Stopped recording: keys in sensitive buffers and passphrase prompts are not recorded")
+		return next
+	}
+	next.macro.keys = append(next.macro.keys, msg)
+	if next.minibufferType == MinibufferNone && len(next.pendingKeys) == 0 {
+		next.macro.mark = len(next.macro.keys)
+	}
+	return next
+}
+
+// handleMacroRecord starts recording, or stops and keeps the recorded keys
+// as the macro to replay.
+func handleMacroRecord(m Model, _ tea.KeyMsg) (tea.Model, tea.Cmd) {
+	if m.macro.replaying {
+		return m, nil
+	}
+	if !m.macro.recording {
+		if m.typingSecrets() {
+			m.notify(MessageWarning, "Macros cannot be recorded in a sensitive buffer")
+			return m, nil
+		}
+		m.macro = macroState{recording: true, last: m.macro.last}
+		m.setMessage("Recording macro")
+		return m, nil
+	}
+
+	keys := m.macro.keys[:m.macro.mark]
+	m.macro = macroState{last: m.macro.last}
+	if len(keys) == 0 {
+		m.setMessage("Macro is empty; kept the previous one")
+		return m, nil
+	}
+	m.macro.last = keys
+	m.notifyf(MessageSuccess, "Recorded macro of %d keys", len(keys))
+	return m, nil
+}
+
+// playMacro replays keys count times as a single undo step.
+func (m Model) playMacro(keys []tea.KeyMsg, count int) (tea.Model, tea.Cmd) {
+	if m.macro.recording || m.macro.replaying {
+		m.notify(MessageWarning, "Cannot replay a macro while recording or replaying one")
+		return m, nil
+	}
+	if len(keys) == 0 {
+		m.setMessage("No macro recorded")
+		return m, nil
+	}
+
+	m.textBuffer.BeginUndoGroup()
+	defer m.textBuffer.EndUndoGroup()
+	m.macro.replaying = true
+	for range count {
+		m = m.replayKeys(keys)
+	}
+	m.macro.replaying = false
+	return m, nil
+}
+
+func (m Model) replayKeys(keys []tea.KeyMsg) Model {
+	var next tea.Model = m
+	for _, k := range keys {
+		next, _ = next.(Model).handleKey(k)
+	}
+	return next.(Model)
+}
+
+func handleMacroPlay(m Model, _ tea.KeyMsg) (tea.Model, tea.Cmd) {
+	return m.playMacro(m.macro.last, 1)
+}
+
+// handleMacroPlayCount asks how many times to replay the macro.
+func handleMacroPlayCount(m Model, _ tea.KeyMsg) (tea.Model, tea.Cmd) {
+	if len(m.macro.last) == 0 {
+		m.setMessage("No macro recorded")
+		return m, nil
+	}
+	m.openPrompt(Prompt{
+		Label:    "Replay macro how many times: ",
+		Validate: validateMacroCount,
+		Submit: func(m Model, input string) (tea.Model, tea.Cmd) {
+			n, _ := strconv.Atoi(strings.TrimSpace(input))
+			return m.playMacro(m.macro.last, n)
+		},
+	}, "")
+	return m, nil
+}
+
+func validateMacroCount(_ Model, input string) error {
+	n, err := strconv.Atoi(strings.TrimSpace(input))
+	if err != nil || n < 1 || n > maxMacroRepeat {
+		return fmt.Errorf("Enter a count from 1 to %d", maxMacroRepeat)
+	}
+	return nil
+}
+
+// handleMacroPlayLines replays the macro once at the start of each line of
+// the selection, top to bottom. Lines the macro adds or removes shift the
+// lines still to come.
+func handleMacroPlayLines(m Model, _ tea.KeyMsg) (tea.Model, tea.Cmd) {
+	if len(m.macro.last) == 0 {
+		m.setMessage("No macro recorded")
+		return m, nil
+	}
+	if m.macro.recording || m.macro.replaying {
+		m.notify(MessageWarning, "Cannot replay a macro while recording or replaying one")
+		return m, nil
+	}
+	start, end := m.textBuffer.GetSelection().Normalize()
+	if end.Column == 0 && end.Line > start.Line {
+		end.Line--
+	}
+	if m.vim.enabled {
+		m.vimEnterNormal()
+	}
+	m.textBuffer.ClearSelection()
+
+	m.textBuffer.BeginUndoGroup()
+	defer m.textBuffer.EndUndoGroup()
+	m.macro.replaying = true
+	line, last := start.Line, end.Line
+	for line <= last && line < m.textBuffer.GetLineCount() {
+		before := m.textBuffer.GetLineCount()
+		m.textBuffer.SetCursor(Position{Line: line})
+		m = m.replayKeys(m.macro.last)
+		shift := m.textBuffer.GetLineCount() - before
+		line += 1 + shift
+		last += shift
+	}
+	m.macro.replaying = false
+	m.postMovementUpdate()
+	m.setMessage(fmt.Sprintf("Macro applied to %d lines", end.Line-start.Line+1))
+	return m, nil
+}
+
+// handleMacroSave names the last macro and saves it to macros.json. Nothing
+// is saved from a sensitive buffer.
+func handleMacroSave(m Model, _ tea.KeyMsg) (tea.Model, tea.Cmd) {
+	if m.typingSecrets() {
+		m.notify(MessageWarning, "Macros cannot be saved from a sensitive buffer")
+		return m, nil
+	}
+	if len(m.macro.last) == 0 {
+		m.setMessage("No macro recorded")
+		return m, nil
+	}
+	keys := m.macro.last
+	m.openPrompt(Prompt{
+		ID:       "macro",
+		Label:    "Save macro as: ",
+		Validate: validateMacroName,
+		Complete: completeMacroNames,
+		Submit: func(m Model, name string) (tea.Model, tea.Cmd) {
+			macros, err := loadMacros()
+			if err != nil {
+				m.notifyf(MessageError, "Cannot read macros: %v", err)
+				return m, nil
+			}
+			macros[name] = encodeKeys(keys)
+			if err := saveMacros(macros); err != nil {
+				m.notifyf(MessageError, "Cannot save macro: %v", err)
+				return m, nil
+			}
+			m.notifyf(MessageSuccess, "Saved macro %q", name)
+			return m, nil
+		},
+	}, "")
+	return m, nil
+}
+
+// handleMacroRun loads a saved macro, makes it the one to replay and runs
+// it once.
+func handleMacroRun(m Model, _ tea.KeyMsg) (tea.Model, tea.Cmd) {
+	m.openPrompt(Prompt{
+		ID:       "macro",
+		Label:    "Run macro: ",
+		Complete: completeMacroNames,
+		Validate: func(_ Model, name string) error {
+			macros, err := loadMacros()
+			if err != nil {
+				return err
+			}
+			if _, ok := macros[name]; !ok {
+				return fmt.Errorf("No macro named %q", name)
+			}
+			return nil
+		},
+		Submit: func(m Model, name string) (tea.Model, tea.Cmd) {
+			macros, _ := loadMacros()
+			keys, err := decodeKeys(macros[name])
+			if err != nil {
+				m.notifyf(MessageError, "Macro %q: %v", name, err)
+				return m, nil
+			}
+			m.macro.last = keys
+			return m.playMacro(keys, 1)
+		},
+	}, "")
+	return m, nil
+}
+
+func validateMacroName(_ Model, name string) error {
+	if name == "" || strings.ContainsAny(name, " \t") {
+		return errors.New("Macro names are single words")
+	}
+	return nil
+}
+
+func completeMacroNames(_ Model, input string) (string, []string) {
+	macros, err := loadMacros()
+	if err != nil {
+		return input, nil
+	}
+	var matches []string
+	for name := range macros {
+		if strings.HasPrefix(name, input) {
+			matches = append(matches, name)
+		}
+	}
+	sort.Strings(matches)
+	return completeFrom(input, matches)
+}
+
+func macrosPath() (string, error) {
+	dir, err := configDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, macroFileName), nil
+}
+
+// loadMacros reads the saved macros, each a list of key names as written in
+// keybindings. A missing file holds no macros.
+func loadMacros() (map[string][]string, error) {
+	macros := make(map[string][]string)
+	path, err := macrosPath()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return macros, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &macros); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", macroFileName, err)
+	}
+	return macros, nil
+}
+
+func saveMacros(macros map[string][]string) error {
+	path, err := macrosPath()
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(macros, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	slog.Debug("saving macros", "path", path, "count", len(macros))
+	return os.WriteFile(path, data, 0600)
+}
+
+// keyTypesByName maps key names such as "ctrl+a" or "enter" back to their
+// key types.
+var keyTypesByName = func() map[string]tea.KeyType {
+	names := make(map[string]tea.KeyType)
+	for t := tea.KeyType(-100); t < 128; t++ {
+		if name := t.String(); name != "" && t != tea.KeyRunes {
+			if _, ok := names[name]; !ok {
+				names[name] = t
+			}
+		}
+	}
+	return names
+}()
+
+// encodeKeys writes keys as names. Typed text is split into single
+// characters so it cannot be mistaken for a key name; pasted text is kept
+// whole in brackets, as tea prints it.
+func encodeKeys(keys []tea.KeyMsg) []string {
+	var names []string
+	for _, k := range keys {
+		if k.Type == tea.KeyRunes && !k.Paste && len(k.Runes) > 1 {
+			for _, r := range k.Runes {
+				names = append(names, tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{r}, Alt: k.Alt}.String())
+			}
+			continue
+		}
+		names = append(names, k.String())
+	}
+	return names
+}
+
+func decodeKeys(names []string) ([]tea.KeyMsg, error) {
+	keys := make([]tea.KeyMsg, 0, len(names))
+	for _, name := range names {
+		k, err := decodeKey(name)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	return keys, nil
+}
+
+func decodeKey(name string) (tea.KeyMsg, error) {
+	if t, ok := keyTypesByName[name]; ok {
+		return tea.KeyMsg{Type: t}, nil
+	}
+	if len(name) > 2 && strings.HasPrefix(name, "[") && strings.HasSuffix(name, "]") {
+		return tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(name[1 : len(name)-1]), Paste: true}, nil
+	}
+	if rest, ok := strings.CutPrefix(name, "alt+"); ok && rest != "" {
+		k, err := decodeKey(rest)
+		k.Alt = true
+		return k, err
+	}
+	if name == "" {
+		return tea.KeyMsg{}, errors.New("empty key name")
+	}
+	return tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(name)}, nil
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// pressKeys sends each key through Update, as typing would.
+func pressKeys(m Model, keys ...tea.KeyMsg) Model {
+	for _, k := range keys {
+		next, _ := m.Update(k)
+		m = next.(Model)
+	}
+	return m
+}
+
+func TestMacroSkipsSecrets(t *testing.T) {
+	record := tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("m"), Alt: true}
+	x := tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("x")}
+
+	m := newTestModel(t, "", nil)
+	m.sensitive = true
+	m = pressKeys(m, record)
+	if m.macro.recording {
+		t.Fatal("recording started in a sensitive buffer")
+	}
+	next, _ := handleMacroSave(m, tea.KeyMsg{})
+	if next.(Model).minibufferType == MinibufferPrompt {
+		t.Fatal("save prompt opened in a sensitive buffer")
+	}
+
+	m = newTestModel(t, "", nil)
+	m = pressKeys(m, record, x)
+	if !m.macro.recording {
+		t.Fatal("recording did not start")
+	}
+	m.openPrompt(newPassphrasePrompt(), "")
+	m = pressKeys(m, tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("secret")})
+	if m.macro.recording {
+		t.Fatal("recording continued at a passphrase prompt")
+	}
+	for _, k := range m.macro.last {
+		if string(k.Runes) == "secret" {
+			t.Fatal("passphrase was recorded")
+		}
+	}
+}
@@ -1,43 +1,76 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"os"
+	"strings"
 	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
 )
 
-
 type Model struct {
-	textBuffer          *TextBuffer
-	filename            string
-	modified            bool
-	originalText        string
-	width               int
-	height              int
-	viewportY           int // Current viewport position for lazy highlighting
-	showHelp            bool
-	lastSaved           time.Time
-	message             string
-	messageTime         time.Time
-	clipboard           string
-	scrollOffset        int
-	horizontalOffset    int
-	minibufferType      MinibufferType
-	minibufferInput     string
-	minibufferCursorPos int
-	findResults         []Position
-	findIndex           int
-	lastSearchQuery     string
-	searchResultsOffset int
-	maxResultsDisplay   int
-	highlighter         *Highlighter
-	highlightedLines    []string // Lazy highlighted lines
-	currentWordStart    int
-	currentWordEnd      int
-	cursorVisible       bool
+	textBuffer           *TextBuffer
+	filename             string
+	modified             bool
+	originalText         string
+	width                int
+	height               int
+	viewportY            int // Current viewport position for lazy highlighting
+	showHelp             bool
+	helpFilter           string
+	helpScroll           int
+	lastSaved            time.Time
+	notification         Notification
+	pendingError         Notification   // shown until dismissed, under newer messages
+	messages             []Notification // session history, oldest first
+	viewer               *Viewer
+	killRing             *KillRing // internal clipboard, newest entry first
+	yankState            yankState
+	clipboardProvider    ClipboardProvider
+	scrollOffset         int
+	horizontalOffset     int
+	minibufferType       MinibufferType
+	minibufferInput      string
+	minibufferCursorPos  int
+	findResults          []Position
+	findIndex            int
+	lastSearchQuery      string
+	searchResultsOffset  int
+	maxResultsDisplay    int
+	highlighter          *Highlighter
+	highlightedLines     []string // Lazy highlighted lines
+	currentWordStart     int
+	currentWordEnd       int
+	cursorVisible        bool
 	lastWordBoundsCursor Position
+	// Encrypted buffers are decrypted into memory only. Sensitive buffers never
+	// mirror to the system clipboard, and are excluded from swap and backups.
+	encrypted         bool
+	sensitive         bool
+	passphrase        []byte
+	encryptedData     []byte
+	pendingPassphrase string
+	config            *Config
+	configPath        string
+	settings          EditorSettings
+	editorConfig      EditorConfig
+	editSeq           int // incremented on every edit, used to debounce auto-save
+	pendingKeys       []string
+	pendingKeysSeq    int // invalidates chord timers when the prefix changes
+	showWhichKey      bool
+	vim               vimState
+	paletteIndex      int // selected row in the palette or theme picker
+	paletteOffset     int
+	theme             Theme
+	mouse             mouseState
+	macro             macroState
+	themeBefore       Theme // restored when the theme picker is cancelled
+	prompt            Prompt
+	history           *PromptHistory
+	promptHistoryPos  int
+	promptDraft       string // input being typed before browsing history
 }
 
 type SelectionInfo struct {
@@ -46,69 +79,131 @@ type SelectionInfo struct {
 	endCol       int
 }
 
-func NewModel(filename string) Model {
+func NewModel(filename string, cfg *Config) Model {
 	var content string
 	var originalText string
 
+	var encryptedData []byte
+	var encrypted bool
+
 	if filename != "" {
 		if data, err := os.ReadFile(filename); err == nil {
-			content = normalizeLineEndings(string(data))
-			originalText = content
+			if isEncryptedContainer(data) {
+				encryptedData = data
+				encrypted = true
+			} else {
+				content = normalizeLineEndings(decodeFile(filename, data))
+				originalText = content
+			}
+		} else if os.IsNotExist(err) && isEncryptedFilename(filename) {
+			encrypted = true
 		}
 	}
 
 	textBuffer := NewTextBuffer(content)
-    model := Model{
-        scrollOffset:      0,
-        horizontalOffset:  0,
-        textBuffer:        textBuffer,
-        filename:          filename,
-        originalText:      originalText,
-        modified:          false,
-        findResults:       []Position{},
-        findIndex:         -1,
-        maxResultsDisplay: 8,
-        highlighter:       NewHighlighter(filename),
-        currentWordStart:  -1,
-        currentWordEnd:    -1,
-        lastWordBoundsCursor: Position{Line: -1, Column: -1},
-    }
-
-    model.applySyntaxHighlighting()
-    model.ensureCursorVisible()
-    model.updateWordBounds()
-    return model
+	model := Model{
+		scrollOffset:         0,
+		horizontalOffset:     0,
+		textBuffer:           textBuffer,
+		filename:             filename,
+		originalText:         originalText,
+		modified:             false,
+		findResults:          []Position{},
+		findIndex:            -1,
+		currentWordStart:     -1,
+		currentWordEnd:       -1,
+		lastWordBoundsCursor: Position{Line: -1, Column: -1},
+		encrypted:            encrypted,
+		sensitive:            encrypted,
+		encryptedData:        encryptedData,
+		history:              loadPromptHistory(),
+		killRing:             newKillRing(),
+	}
+
+	if encryptedData != nil {
+		model.openPrompt(passphrasePrompt(), "")
+	} else if encrypted {
+		model.openPrompt(newPassphrasePrompt(), "")
+	}
+
+	if warnings := model.applyConfig(cfg); len(warnings) > 0 {
+		model.notify(MessageWarning, strings.Join(warnings, "; "))
+	}
+	model.ensureCursorVisible()
+	model.updateWordBounds()
+	return model
 }
 
 type blinkMsg time.Time
 
-func blinkTick() tea.Cmd {
-	return tea.Tick(500 * time.Millisecond, func(t time.Time) tea.Msg {
+func blinkTick(interval time.Duration) tea.Cmd {
+	return tea.Tick(interval, func(t time.Time) tea.Msg {
 		return blinkMsg(t)
 	})
 }
 
 func (m Model) Init() tea.Cmd {
-	return blinkTick()
+	return blinkTick(m.config.BlinkInterval())
 }
 
 func main() {
 	// Initialize Windows terminal compatibility
 	enableWindowsANSI()
 	ensureUTF8Output()
-	
-	var filename string
-	if len(os.Args) > 1 {
-		filename = os.Args[1]
+
+	configPath := flag.String("config", "", "path to a config.toml or config.json file")
+	printKeys := flag.Bool("keys", false, "print the key bindings as Markdown and exit")
+	debug := flag.Bool("debug", false, "write debug logs to gecko.log in the config directory")
+	logFile := flag.String("log-file", "", "write logs to this file (rotated at 1 MiB)")
+	color := flag.String("color", "auto", "color mode: auto, none, 16, 256 or truecolor")
+	flag.Parse()
+
+	if err := setupColors(*color); err != nil {
+		fmt.Fprintf(os.Stderr, "gecko: %v\n", err)
+		os.Exit(2)
 	}
 
-	model := NewModel(filename)
+	logCloser, err := setupLogging(*logFile, *debug)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "gecko: cannot open log: %v\n", err)
+		os.Exit(1)
+	}
+	defer logCloser.Close()
 
-	p := tea.NewProgram(model, tea.WithAltScreen())
+	if *printKeys {
+		if err := printKeyTable(*configPath); err != nil {
+			fmt.Fprintf(os.Stderr, "gecko: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	filename := flag.Arg(0)
+
+	cfg, cfgErr := LoadConfig(*configPath)
+	model := NewModel(filename, cfg)
+	model.configPath = *configPath
+	if cfgErr != nil {
+		model.notify(MessageError, cfgErr.Error())
+	}
+
+	p := tea.NewProgram(model, tea.WithAltScreen(), tea.WithMouseCellMotion(), tea.WithOutput(programOutput))
 	if _, err := p.Run(); err != nil {
 		fmt.Printf("Error running program: %v\n", err)
 		os.Exit(1)
 	}
 
 	fmt.Print("\033[2J\033[H")
-}
\ No newline at end of file
+}
+
+// printKeyTable writes the bindings from the given config, or the defaults,
+// to stdout as Markdown.
+func printKeyTable(configPath string) error {
+	cfg, err := LoadConfig(configPath)
+	if err != nil {
+		return err
+	}
+	registerConfigCommands(cfg.Commands)
+	keys, _ = buildKeyMap(cfg.Keymap, cfg.Keybindings)
+	return writeKeysMarkdown(os.Stdout)
+}
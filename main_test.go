@@ -0,0 +1,17 @@
+package main
+
+import "testing"
+
+// newTestModel opens filename, or an empty buffer, in an 80x24 editor. A nil
+// cfg means the defaults. The config directory is a fresh temporary one, so
+// tests never read or write the user's history, kill ring or macros.
+func newTestModel(t *testing.T, filename string, cfg *Config) Model {
+	t.Helper()
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	if cfg == nil {
+		cfg = DefaultConfig()
+	}
+	m := NewModel(filename, cfg)
+	m.width, m.height = 80, 24
+	return m
+}
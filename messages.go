@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+const (
+	messageTimeout = 3 * time.Second
+	maxMessages    = 500
+)
+
+// MessageLevel is the severity of a notification.
+type MessageLevel int
+
+const (
+	MessageInfo MessageLevel = iota
+	MessageSuccess
+	MessageWarning
+	MessageError
+)
+
+func (l MessageLevel) String() string {
+	switch l {
+	case MessageSuccess:
+		return "success"
+	case MessageWarning:
+		return "warning"
+	case MessageError:
+		return "error"
+	}
+	return "info"
+}
+
+func (l MessageLevel) style() lipgloss.Style {
+	switch l {
+	case MessageSuccess:
+		return flashSuccessStyle
+	case MessageWarning:
+		return flashWarningStyle
+	case MessageError:
+		return flashErrorStyle
+	}
+	return lipgloss.NewStyle()
+}
+
+// Notification is a message shown in the status bar. Every notification is
+// kept in the session's message history.
+type Notification struct {
+	Level MessageLevel
+	Text  string
+	Time  time.Time
+}
+
+// notify shows a message and records it in the history. Other levels fade,
+// but an error stays until dismissed with Esc: a newer message covers it only
+// while that message is showing.
+func (m *Model) notify(level MessageLevel, text string) {
+	n := Notification{Level: level, Text: text, Time: time.Now()}
+	m.notification = n
+	if level == MessageError {
+		m.pendingError = n
+	}
+	m.messages = append(m.messages, n)
+	if len(m.messages) > maxMessages {
+		m.messages = m.messages[len(m.messages)-maxMessages:]
+	}
+}
+
+func (m *Model) notifyf(level MessageLevel, format string, args ...any) {
+	m.notify(level, fmt.Sprintf(format, args...))
+}
+
+// setMessage shows an informational message.
+func (m *Model) setMessage(msg string) {
+	m.notify(MessageInfo, msg)
+}
+
+// hint shows a transient message, such as completion candidates, that is not
+// worth keeping in the history.
+func (m *Model) hint(msg string) {
+	m.notification = Notification{Level: MessageInfo, Text: msg, Time: time.Now()}
+}
+
+// activeMessage returns the styled notification to show, if any. The
+// pending error comes back once a newer message has faded.
+func (m Model) activeMessage() (string, bool) {
+	n := m.notification
+	if n.Text == "" || (n.Level != MessageError && time.Since(n.Time) >= messageTimeout) {
+		n = m.pendingError
+	}
+	if n.Text == "" {
+		return "", false
+	}
+	return n.Level.style().Render(n.Text), true
+}
+
+// dismissMessage clears the current notification and the pending error,
+// reporting whether there was one on screen.
+func (m *Model) dismissMessage() bool {
+	_, shown := m.activeMessage()
+	m.notification = Notification{}
+	m.pendingError = Notification{}
+	return shown
+}
+
+func handleDismissMessage(m Model, _ tea.KeyMsg) (tea.Model, tea.Cmd) {
+	m.dismissMessage()
+	return m, nil
+}
+
+// handleShowMessages opens the session's message history, newest last.
+func handleShowMessages(m Model, _ tea.KeyMsg) (tea.Model, tea.Cmd) {
+	lines := make([]string, 0, len(m.messages))
+	for _, n := range m.messages {
+		label := fmt.Sprintf("%-7s", n.Level)
+		for i, text := range strings.Split(n.Text, "\n") {
+			prefix := n.Time.Format("15:04:05") + " " + label + " "
+			if i > 0 {
+				prefix = strings.Repeat(" ", len(prefix))
+			}
+			lines = append(lines, prefix+n.Level.style().Render(text))
+		}
+	}
+	if len(lines) == 0 {
+		lines = append(lines, helpStyle.Render("No messages yet"))
+	}
+	m.openViewer("Messages", lines)
+	m.viewer.scrollToEnd(m.viewerPageSize())
+	return m, nil
+}
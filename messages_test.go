@@ -0,0 +1,39 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestErrorStaysUntilDismissed(t *testing.T) {
+	tests := []struct {
+		name  string
+		after func(m *Model)
+	}{
+		{"hint", func(m *Model) { m.hint("Selected 3 characters") }},
+		{"info", func(m *Model) { m.setMessage("Copied") }},
+		{"warning", func(m *Model) { m.notify(MessageWarning, "Nothing to undo") }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTestModel(t, "", nil)
+			m.notify(MessageError, "Error saving file")
+			tt.after(&m)
+			if shown, _ := m.activeMessage(); strings.Contains(shown, "Error saving file") {
+				t.Fatal("the newer message should show first")
+			}
+
+			m.notification.Time = time.Now().Add(-messageTimeout)
+			if shown, ok := m.activeMessage(); !ok || !strings.Contains(shown, "Error saving file") {
+				t.Fatalf("got %q after the newer message faded, want the error", shown)
+			}
+			if !m.dismissMessage() {
+				t.Fatal("dismiss found nothing on screen")
+			}
+			if shown, ok := m.activeMessage(); ok {
+				t.Fatalf("got %q after dismissing", shown)
+			}
+		})
+	}
+}
@@ -4,26 +4,32 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"unicode/utf8"
 
 	tea "github.com/charmbracelet/bubbletea"
 )
 
-
 type MinibufferType int
 
 const (
 	MinibufferNone MinibufferType = iota
-	MinibufferGoToLine
-	MinibufferFind
+	MinibufferPrompt
 	MinibufferFindResults
+	MinibufferCommandPalette
+	MinibufferThemePicker
+	MinibufferClipboardHistory
 )
 
 func (m Model) getMinibufferHeight() int {
 	switch m.minibufferType {
-	case MinibufferNone:
-		return 1
-	case MinibufferGoToLine, MinibufferFind:
+	case MinibufferNone, MinibufferPrompt:
 		return 1
+	case MinibufferCommandPalette:
+		return m.getPaletteHeight()
+	case MinibufferThemePicker:
+		return m.getThemePickerHeight()
+	case MinibufferClipboardHistory:
+		return m.getClipboardHistoryHeight()
 	case MinibufferFindResults:
 		resultsCount := len(m.findResults)
 		if resultsCount > m.maxResultsDisplay {
@@ -36,6 +42,15 @@ func (m Model) getMinibufferHeight() int {
 }
 
 func (m Model) handleMinibufferInput(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch m.minibufferType {
+	case MinibufferPrompt:
+		return m.handlePromptInput(msg)
+	case MinibufferThemePicker:
+		return m.handleThemePickerInput(msg)
+	case MinibufferClipboardHistory:
+		return m.handleClipboardHistoryInput(msg)
+	}
+
 	switch msg.Type {
 	case tea.KeyEscape:
 		return handleEscapeKey(m)
@@ -45,7 +60,7 @@ func (m Model) handleMinibufferInput(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		return handleNavigationKeys(m, msg)
 	case tea.KeyBackspace, tea.KeyDelete, tea.KeyLeft, tea.KeyRight, tea.KeyHome, tea.KeyEnd:
 		return handleEditingKeys(m, msg)
-	case tea.KeyRunes:
+	case tea.KeyRunes, tea.KeySpace:
 		return handleTextInput(m, msg)
 	}
 
@@ -63,53 +78,135 @@ func handleEscapeKey(m Model) (tea.Model, tea.Cmd) {
 
 func handleEnterKey(m Model) (tea.Model, tea.Cmd) {
 	switch m.minibufferType {
-	case MinibufferGoToLine:
-		return handleGoToLineEnter(m)
-	case MinibufferFind:
-		return handleFindEnter(m)
 	case MinibufferFindResults:
 		return handleFindResultsEnter(m)
+	case MinibufferCommandPalette:
+		return handlePaletteEnter(m)
 	}
 	return m, nil
 }
 
-func handleGoToLineEnter(m Model) (tea.Model, tea.Cmd) {
-	if line, err := strconv.Atoi(m.minibufferInput); err == nil && line > 0 {
-		totalLines := len(m.textBuffer.GetLines())
-		if line <= totalLines {
-			m.textBuffer.GoToLine(line - 1)
-			m.ensureCursorVisible()
-		} else {
-			m.setMessage(fmt.Sprintf("Line %d is beyond end of file (total: %d lines)", line, totalLines))
-		}
-	} else {
-		m.setMessage("Invalid line number")
+// acceptsTextInput reports whether the active minibuffer has an editable input line.
+func (m Model) acceptsTextInput() bool {
+	return (m.minibufferType == MinibufferPrompt && !m.prompt.Confirm) ||
+		m.minibufferType == MinibufferCommandPalette ||
+		m.minibufferType == MinibufferThemePicker ||
+		m.minibufferType == MinibufferClipboardHistory
+}
+
+// passphrasePrompt asks for the passphrase of an encrypted file. A locked
+// buffer cannot be edited, and saving it would clobber the container, so
+// cancelling exits the editor.
+func passphrasePrompt() Prompt {
+	return Prompt{
+		Label:  "Passphrase: ",
+		Masked: true,
+		Submit: submitPassphrase,
+		Cancel: quitEditor,
 	}
-	m.minibufferType = MinibufferNone
-	m.minibufferInput = ""
-	m.minibufferCursorPos = 0
+}
+
+// newPassphrasePrompt asks for the passphrase of a new encrypted file.
+func newPassphrasePrompt() Prompt {
+	return Prompt{
+		Label:  "New passphrase: ",
+		Masked: true,
+		Validate: func(_ Model, input string) error {
+			if input == "" {
+				return fmt.Errorf("Passphrase cannot be empty")
+			}
+			return nil
+		},
+		Submit: func(m Model, input string) (tea.Model, tea.Cmd) {
+			m.pendingPassphrase = input
+			m.openPrompt(confirmPassphrasePrompt(), "")
+			return m, nil
+		},
+		Cancel: quitEditor,
+	}
+}
+
+func confirmPassphrasePrompt() Prompt {
+	return Prompt{
+		Label:  "Confirm passphrase: ",
+		Masked: true,
+		Submit: submitConfirmPassphrase,
+		Cancel: quitEditor,
+	}
+}
+
+func quitEditor(m Model) (tea.Model, tea.Cmd) {
+	return m, tea.Quit
+}
+
+func submitPassphrase(m Model, input string) (tea.Model, tea.Cmd) {
+	if err := m.unlockBuffer(input); err != nil {
+		m.openPrompt(passphrasePrompt(), "")
+		m.notifyf(MessageError, "Cannot decrypt: %v", err)
+		return m, nil
+	}
+	m.notify(MessageSuccess, "Decrypted into memory")
 	return m, nil
 }
 
-func handleFindEnter(m Model) (tea.Model, tea.Cmd) {
-	if m.minibufferInput != "" {
-		m.lastSearchQuery = m.minibufferInput
-		m.findResults = m.textBuffer.FindText(m.minibufferInput, false)
-		if len(m.findResults) > 0 {
-			m.findIndex = 0
-			m.searchResultsOffset = 0
-			m.minibufferType = MinibufferFindResults
-			m.jumpToCurrentResult()
-		} else {
-			m.setMessage("No matches found")
-			m.minibufferType = MinibufferNone
-			m.minibufferInput = ""
-			m.minibufferCursorPos = 0
-		}
+func submitConfirmPassphrase(m Model, input string) (tea.Model, tea.Cmd) {
+	if input != m.pendingPassphrase {
+		m.pendingPassphrase = ""
+		m.openPrompt(newPassphrasePrompt(), "")
+		m.notify(MessageError, "Passphrases do not match")
+		return m, nil
+	}
+	m.passphrase = []byte(m.pendingPassphrase)
+	m.pendingPassphrase = ""
+	m.notify(MessageSuccess, "New encrypted file")
+	return m, nil
+}
+
+func goToLinePrompt() Prompt {
+	return Prompt{
+		ID:    "goto",
+		Label: "Go to line: ",
+		Validate: func(m Model, input string) error {
+			line, err := strconv.Atoi(strings.TrimSpace(input))
+			if err != nil || line <= 0 {
+				return fmt.Errorf("Invalid line number")
+			}
+			if total := m.textBuffer.GetLineCount(); line > total {
+				return fmt.Errorf("Line %d is beyond end of file (total: %d lines)", line, total)
+			}
+			return nil
+		},
+		Submit: func(m Model, input string) (tea.Model, tea.Cmd) {
+			line, _ := strconv.Atoi(strings.TrimSpace(input))
+			m.textBuffer.GoToLine(line - 1)
+			m.postMovementUpdate()
+			return m, nil
+		},
+	}
+}
+
+func findPrompt() Prompt {
+	return Prompt{
+		ID:       "find",
+		Label:    "Find: ",
+		Complete: completeBufferWords,
+		Submit:   submitFind,
+	}
+}
+
+func submitFind(m Model, query string) (tea.Model, tea.Cmd) {
+	if query == "" {
+		return m, nil
+	}
+	m.lastSearchQuery = query
+	m.findResults = m.textBuffer.FindText(query, false)
+	if len(m.findResults) > 0 {
+		m.findIndex = 0
+		m.searchResultsOffset = 0
+		m.minibufferType = MinibufferFindResults
+		m.jumpToCurrentResult()
 	} else {
-		m.minibufferType = MinibufferNone
-		m.minibufferInput = ""
-		m.minibufferCursorPos = 0
+		m.setMessage("No matches found")
 	}
 	return m, nil
 }
@@ -140,32 +237,42 @@ func handleNavigationKeys(m Model, msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		}
 		m.adjustResultsOffset()
 		m.jumpToCurrentResult()
+	} else if m.minibufferType == MinibufferCommandPalette {
+		if msg.Type == tea.KeyUp {
+			m.movePaletteSelection(-1)
+		} else {
+			m.movePaletteSelection(1)
+		}
 	}
 	return m, nil
 }
 
 func handleEditingKeys(m Model, msg tea.KeyMsg) (tea.Model, tea.Cmd) {
-	if m.minibufferType != MinibufferFind && m.minibufferType != MinibufferGoToLine {
+	if !m.acceptsTextInput() {
 		return m, nil
 	}
 
 	switch msg.Type {
 	case tea.KeyBackspace:
 		if m.minibufferCursorPos > 0 {
-			m.minibufferInput = m.minibufferInput[:m.minibufferCursorPos-1] + m.minibufferInput[m.minibufferCursorPos:]
-			m.minibufferCursorPos--
+			_, size := utf8.DecodeLastRuneInString(m.minibufferInput[:m.minibufferCursorPos])
+			m.minibufferInput = m.minibufferInput[:m.minibufferCursorPos-size] + m.minibufferInput[m.minibufferCursorPos:]
+			m.minibufferCursorPos -= size
 		}
 	case tea.KeyDelete:
 		if m.minibufferCursorPos < len(m.minibufferInput) {
-			m.minibufferInput = m.minibufferInput[:m.minibufferCursorPos] + m.minibufferInput[m.minibufferCursorPos+1:]
+			_, size := utf8.DecodeRuneInString(m.minibufferInput[m.minibufferCursorPos:])
+			m.minibufferInput = m.minibufferInput[:m.minibufferCursorPos] + m.minibufferInput[m.minibufferCursorPos+size:]
 		}
 	case tea.KeyLeft:
 		if m.minibufferCursorPos > 0 {
-			m.minibufferCursorPos--
+			_, size := utf8.DecodeLastRuneInString(m.minibufferInput[:m.minibufferCursorPos])
+			m.minibufferCursorPos -= size
 		}
 	case tea.KeyRight:
 		if m.minibufferCursorPos < len(m.minibufferInput) {
-			m.minibufferCursorPos++
+			_, size := utf8.DecodeRuneInString(m.minibufferInput[m.minibufferCursorPos:])
+			m.minibufferCursorPos += size
 		}
 	case tea.KeyHome:
 		m.minibufferCursorPos = 0
@@ -173,84 +280,53 @@ func handleEditingKeys(m Model, msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		m.minibufferCursorPos = len(m.minibufferInput)
 	}
 
+	m.resetPaletteSelection()
 	return m, nil
 }
 
 func handleTextInput(m Model, msg tea.KeyMsg) (tea.Model, tea.Cmd) {
-	if (m.minibufferType == MinibufferFind || m.minibufferType == MinibufferGoToLine) && len(msg.Runes) > 0 {
+	if m.acceptsTextInput() && len(msg.Runes) > 0 {
 		char := string(msg.Runes)
 		m.minibufferInput = m.minibufferInput[:m.minibufferCursorPos] + char + m.minibufferInput[m.minibufferCursorPos:]
-		m.minibufferCursorPos++
+		m.minibufferCursorPos += len(char)
+		m.resetPaletteSelection()
 	}
 	return m, nil
 }
 
-func (m Model) renderMinibuffer() string {
-	switch m.minibufferType {
-	case MinibufferGoToLine:
-		return m.renderGoToLineMinibuffer()
-	case MinibufferFind:
-		return m.renderFindMinibuffer()
-	case MinibufferFindResults:
-		return m.renderFindResultsMinibuffer()
+// renderMinibufferInput shows input with the cursor over the rune at byte
+// offset pos, or after the text when pos is at the end.
+func renderMinibufferInput(input string, pos int) string {
+	if pos >= len(input) {
+		return input + minibufferCursorStyle.Render(" ")
 	}
-	return ""
+	_, size := utf8.DecodeRuneInString(input[pos:])
+	return input[:pos] + minibufferCursorStyle.Render(input[pos:pos+size]) + input[pos+size:]
 }
 
-func (m Model) renderGoToLineMinibuffer() string {
-	prompt := "Go to line: "
-
-	var inputDisplay strings.Builder
-	for i, char := range m.minibufferInput {
-		if i == m.minibufferCursorPos {
-			inputDisplay.WriteString(minibufferCursorStyle.Render(string(char)))
-		} else {
-			inputDisplay.WriteString(string(char))
-		}
-	}
-
-	if m.minibufferCursorPos >= len(m.minibufferInput) {
-		inputDisplay.WriteString(minibufferCursorStyle.Render(" "))
+// resetPaletteSelection moves the palette back to the best match after the
+// filter changes.
+func (m *Model) resetPaletteSelection() {
+	if m.minibufferType == MinibufferCommandPalette {
+		m.paletteIndex = 0
+		m.paletteOffset = 0
 	}
-
-	content := minibufferPromptStyle.Render(prompt) + minibufferInputStyle.Render(inputDisplay.String())
-
-	minibufferWidth := m.width - 4
-	currentLen := len(prompt) + len(m.minibufferInput)
-	if currentLen < minibufferWidth {
-		padding := strings.Repeat(" ", minibufferWidth-currentLen)
-		content += padding
-	}
-
-	return minibufferStyle.Width(m.width - 2).Render(content)
 }
 
-func (m Model) renderFindMinibuffer() string {
-	prompt := "Find: "
-
-	var inputDisplay strings.Builder
-	for i, char := range m.minibufferInput {
-		if i == m.minibufferCursorPos {
-			inputDisplay.WriteString(minibufferCursorStyle.Render(string(char)))
-		} else {
-			inputDisplay.WriteString(string(char))
-		}
-	}
-
-	if m.minibufferCursorPos >= len(m.minibufferInput) {
-		inputDisplay.WriteString(minibufferCursorStyle.Render(" "))
-	}
-
-	content := minibufferPromptStyle.Render(prompt) + minibufferInputStyle.Render(inputDisplay.String())
-
-	minibufferWidth := m.width - 4
-	currentLen := len(prompt) + len(m.minibufferInput)
-	if currentLen < minibufferWidth {
-		padding := strings.Repeat(" ", minibufferWidth-currentLen)
-		content += padding
+func (m Model) renderMinibuffer() string {
+	switch m.minibufferType {
+	case MinibufferPrompt:
+		return m.renderPromptMinibuffer()
+	case MinibufferCommandPalette:
+		return m.renderPaletteMinibuffer()
+	case MinibufferThemePicker:
+		return m.renderThemePickerMinibuffer()
+	case MinibufferClipboardHistory:
+		return m.renderClipboardHistoryMinibuffer()
+	case MinibufferFindResults:
+		return m.renderFindResultsMinibuffer()
 	}
-
-	return minibufferStyle.Width(m.width - 2).Render(content)
+	return ""
 }
 
 func (m Model) renderFindResultsMinibuffer() string {
@@ -316,4 +392,4 @@ func (m Model) renderFindResultsMinibuffer() string {
 	return minibufferStyle.
 		Width(m.width - 2).
 		Render(content)
-}
\ No newline at end of file
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestMinibufferEditsRunes(t *testing.T) {
+	key := func(k tea.KeyType) tea.KeyMsg { return tea.KeyMsg{Type: k} }
+	tests := []struct {
+		name string
+		keys []tea.KeyMsg
+		want string
+		pos  int
+	}{
+		{"backspace", []tea.KeyMsg{key(tea.KeyBackspace)}, "naïve café", len("naïve café")},
+		{"left and backspace", []tea.KeyMsg{key(tea.KeyLeft), key(tea.KeyBackspace)}, "naïve caf!", len("naïve caf")},
+		{"left twice and delete", []tea.KeyMsg{key(tea.KeyLeft), key(tea.KeyLeft), key(tea.KeyDelete)}, "naïve caf!", len("naïve caf")},
+		{"home, right, right, delete", []tea.KeyMsg{key(tea.KeyHome), key(tea.KeyRight), key(tea.KeyRight), key(tea.KeyDelete)}, "nave café!", len("na")},
+	}
+	for _, tt := range tests {
+		for _, mode := range []MinibufferType{MinibufferPrompt, MinibufferCommandPalette, MinibufferThemePicker, MinibufferClipboardHistory} {
+			m := newTestModel(t, "", nil)
+			if mode == MinibufferPrompt {
+				m.openPrompt(Prompt{Label: "Text: ", Masked: true}, "")
+			}
+			m.minibufferType = mode
+			m.minibufferInput = "naïve café!"
+			m.minibufferCursorPos = len(m.minibufferInput)
+			for _, k := range tt.keys {
+				next, _ := handleEditingKeys(m, k)
+				m = next.(Model)
+			}
+			if m.minibufferInput != tt.want || m.minibufferCursorPos != tt.pos {
+				t.Errorf("%s in mode %d: got %q at %d, want %q at %d", tt.name, mode, m.minibufferInput, m.minibufferCursorPos, tt.want, tt.pos)
+			}
+			m.renderMinibuffer()
+		}
+	}
+}
@@ -2,38 +2,16 @@ package main
 
 import (
 	"fmt"
+	"log/slog"
 	"strings"
-	"time"
 	"unicode"
 
-	"github.com/charmbracelet/bubbles/key"
 	tea "github.com/charmbracelet/bubbletea"
 )
 
+// keyHandler runs a command in response to a key press or palette selection.
 type keyHandler func(m Model, msg tea.KeyMsg) (tea.Model, tea.Cmd)
 
-var keyHandlers = map[string]keyHandler{
-	"quit":       handleQuit,
-	"save":       handleSave,
-	"help":       handleHelp,
-	"goto":       handleGoToLine,
-	"find":       handleFind,
-	"findNext":   handleFindNext,
-	"findPrev":   handleFindPrev,
-	"copy":       handleCopy,
-	"cut":        handleCut,
-	"paste":      handlePaste,
-	"undo":       handleUndo,
-	"redo":       handleRedo,
-	"selectAll":  handleSelectAll,
-	"shiftLeft":  handleShiftLeft,
-	"shiftRight": handleShiftRight,
-	"shiftUp":    handleShiftUp,
-	"shiftDown":  handleShiftDown,
-	"altLeft":    handleAltLeft,
-	"altRight":   handleAltRight,
-}
-
 func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch msg := msg.(type) {
 	case tea.WindowSizeMsg:
@@ -44,93 +22,102 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		return m, nil
 
 	case tea.KeyMsg:
-		if m.minibufferType != MinibufferNone {
-			return m.handleMinibufferInput(msg)
-		}
-
-		if handler := matchKeyHandler(msg); handler != nil {
-			return handler(m, msg)
+		next, cmd := m.handleKey(msg)
+		if nm, ok := next.(Model); ok {
+			if nm.editSeq != m.editSeq {
+				cmd = tea.Batch(cmd, nm.autoSaveCmd())
+			}
+			next = m.recordKey(nm, msg)
 		}
-
-		return handleSpecialKeys(m, msg)
+		return next, cmd
+	case tea.MouseMsg:
+		return m.handleMouse(msg)
 	case blinkMsg:
 		m.cursorVisible = !m.cursorVisible
-		return m, blinkTick()
+		return m, blinkTick(m.config.BlinkInterval())
+	case autoSaveMsg:
+		if msg.seq == m.editSeq && m.modified && !m.isLocked() {
+			return m.save(false)
+		}
+		return m, nil
+	case whichKeyMsg:
+		if msg.seq == m.pendingKeysSeq && len(m.pendingKeys) > 0 {
+			m.showWhichKey = true
+			m.ensureCursorVisible()
+		}
+		return m, nil
+	case chordTimeoutMsg:
+		if msg.seq == m.pendingKeysSeq {
+			m.clearPendingKeys()
+		}
+		return m, nil
 	}
 
 	return m, nil
 }
 
-func matchKeyHandler(msg tea.KeyMsg) keyHandler {
-	if key.Matches(msg, keys.Quit) {
-		return keyHandlers["quit"]
-	}
-	if key.Matches(msg, keys.Save) {
-		return keyHandlers["save"]
-	}
-	if key.Matches(msg, keys.Help) {
-		return keyHandlers["help"]
-	}
-	if key.Matches(msg, keys.GoToLine) {
-		return keyHandlers["goto"]
+func (m Model) handleKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	if m.viewer != nil {
+		return m.handleViewerKey(msg)
 	}
-	if key.Matches(msg, keys.Find) {
-		return keyHandlers["find"]
-	}
-	if key.Matches(msg, keys.FindNext) {
-		return keyHandlers["findNext"]
-	}
-	if key.Matches(msg, keys.FindPrev) {
-		return keyHandlers["findPrev"]
-	}
-	if key.Matches(msg, keys.Copy) {
-		return keyHandlers["copy"]
-	}
-	if key.Matches(msg, keys.Cut) {
-		return keyHandlers["cut"]
-	}
-	if key.Matches(msg, keys.Paste) {
-		return keyHandlers["paste"]
-	}
-	if key.Matches(msg, keys.Undo) {
-		return keyHandlers["undo"]
-	}
-	if key.Matches(msg, keys.Redo) {
-		return keyHandlers["redo"]
-	}
-	if key.Matches(msg, keys.SelectAll) {
-		return keyHandlers["selectAll"]
-	}
-	if key.Matches(msg, keys.ShiftLeft) {
-		return keyHandlers["shiftLeft"]
-	}
-	if key.Matches(msg, keys.ShiftRight) {
-		return keyHandlers["shiftRight"]
+
+	// Esc dismisses a lingering error as well as doing its usual job
+	if msg.Type == tea.KeyEscape {
+		m.dismissMessage()
 	}
-	if key.Matches(msg, keys.ShiftUp) {
-		return keyHandlers["shiftUp"]
+
+	if m.showHelp {
+		return m.handleHelpKey(msg)
 	}
-	if key.Matches(msg, keys.ShiftDown) {
-		return keyHandlers["shiftDown"]
+
+	if m.minibufferType != MinibufferNone {
+		// Help stays reachable from prompts so it can describe them, except
+		// from a masked one, where every key belongs to the passphrase
+		if m.minibufferType != MinibufferPrompt || !m.prompt.Masked {
+			next, cmd, matched, held := m.matchBindingKeys(msg, keys.Help)
+			if matched {
+				next.showHelp = true
+				return next, nil
+			}
+			if held {
+				return next, cmd
+			}
+			m = next
+		}
+		return m.handleMinibufferInput(msg)
 	}
-	if key.Matches(msg, keys.AltLeft) {
-		return keyHandlers["altLeft"]
+
+	if m.vim.enabled {
+		next, cmd, handled := m.handleVimKey(msg)
+		if handled {
+			return next, cmd
+		}
+		m = next.(Model)
 	}
-	if key.Matches(msg, keys.AltRight) {
-		return keyHandlers["altRight"]
+
+	if next, cmd, handled := m.handleKeySequence(msg); handled {
+		return next, cmd
 	}
 
-	return nil
+	return handleSpecialKeys(m, msg)
 }
 
 func handleSpecialKeys(m Model, msg tea.KeyMsg) (tea.Model, tea.Cmd) {
-	if msg.Type == tea.KeyCtrlLeft {
-		m.textBuffer.MoveToWordBoundary(false, false)
-		m.postMovementUpdate()
+	if b := m.textBuffer.GetBlock(); b != nil {
+		if next, cmd, handled := m.handleBlockKey(msg, *b); handled {
+			return next, cmd
+		}
+		m.textBuffer.ClearBlock()
+	}
+	if msg.Type == tea.KeyEscape && m.textBuffer.HasCarets() {
+		m.textBuffer.ClearCarets()
 		return m, nil
 	}
-	if msg.Type == tea.KeyCtrlRight {
-		m.textBuffer.MoveToWordBoundary(true, false)
+	if msg.Type == tea.KeyCtrlLeft || msg.Type == tea.KeyCtrlRight {
+		logIgnored(m.textBuffer.ForEachCaret(func() error {
+			m.textBuffer.MoveToWordBoundary(msg.Type == tea.KeyCtrlRight, false)
+			return nil
+		}), "word move failed")
 		m.postMovementUpdate()
 		return m, nil
 	}
@@ -139,22 +126,25 @@ func handleSpecialKeys(m Model, msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 }
 
 func handleArrowKeys(m Model, msg tea.KeyMsg) (tea.Model, tea.Cmd) {
-	var err error
+	var dLine, dCol int
 	switch msg.Type {
 	case tea.KeyLeft:
-		err = m.textBuffer.MoveCursorDelta(0, -1, false)
+		dCol = -1
 	case tea.KeyRight:
-		err = m.textBuffer.MoveCursorDelta(0, 1, false)
+		dCol = 1
 	case tea.KeyUp:
-		err = m.textBuffer.MoveCursorDelta(-1, 0, false)
+		dLine = -1
 	case tea.KeyDown:
-		err = m.textBuffer.MoveCursorDelta(1, 0, false)
+		dLine = 1
 	default:
 		return handleHomeEndKeys(m, msg)
 	}
 
+	err := m.textBuffer.ForEachCaret(func() error {
+		return m.textBuffer.MoveCursorDelta(dLine, dCol, false)
+	})
 	if err != nil {
-		// Silently handle errors to maintain UI responsiveness
+		logIgnored(err, "cursor move failed", "key", msg.String())
 		return m, nil
 	}
 
@@ -163,37 +153,38 @@ func handleArrowKeys(m Model, msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 }
 
 func handleHomeEndKeys(m Model, msg tea.KeyMsg) (tea.Model, tea.Cmd) {
-	switch msg.Type {
-	case tea.KeyHome:
-		cursor := m.textBuffer.GetCursor()
-		m.textBuffer.SetCursor(Position{Line: cursor.Line, Column: 0})
-	case tea.KeyEnd:
-		cursor := m.textBuffer.GetCursor()
-		lines := m.textBuffer.GetLines()
-		if cursor.Line < len(lines) {
-			m.textBuffer.SetCursor(Position{Line: cursor.Line, Column: len(lines[cursor.Line])})
-		}
-	default:
+	if msg.Type != tea.KeyHome && msg.Type != tea.KeyEnd {
 		return handlePageKeys(m, msg)
 	}
+	logIgnored(m.textBuffer.ForEachCaret(func() error {
+		cursor := m.textBuffer.GetCursor()
+		column := 0
+		if msg.Type == tea.KeyEnd {
+			column = len(m.textBuffer.GetLine(cursor.Line))
+		}
+		m.textBuffer.SetCursor(Position{Line: cursor.Line, Column: column})
+		return nil
+	}), "cursor move failed", "key", msg.String())
 	m.postMovementUpdate()
 	return m, nil
 }
 
 func handlePageKeys(m Model, msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	visible := m.getVisibleLines()
-	var err error
 	switch msg.Type {
 	case tea.KeyPgUp:
-		err = m.textBuffer.MoveCursorDelta(-visible, 0, false)
+		visible = -visible
 	case tea.KeyPgDown:
-		err = m.textBuffer.MoveCursorDelta(visible, 0, false)
 	default:
 		return handleTextModification(m, msg)
 	}
 
+	err := m.textBuffer.ForEachCaret(func() error {
+		return m.textBuffer.MoveCursorDelta(visible, 0, false)
+	})
+
 	if err != nil {
-		// Silently handle errors to maintain UI responsiveness
+		logIgnored(err, "cursor move failed", "key", msg.String())
 		return m, nil
 	}
 
@@ -220,38 +211,50 @@ func (m *Model) recalculateLayout() {
 }
 
 func handleTextModification(m Model, msg tea.KeyMsg) (tea.Model, tea.Cmd) {
-	var err error
+	var edit func() error
 	switch msg.Type {
 	case tea.KeyEnter:
-		err = m.textBuffer.InsertText("\n")
+		edit = m.insertNewline
 	case tea.KeyBackspace:
-		err = m.textBuffer.DeleteChar(true)
+		edit = m.backspace
 	case tea.KeyDelete:
-		err = m.textBuffer.DeleteChar(false)
+		edit = func() error { return m.textBuffer.DeleteChar(false) }
 	case tea.KeyTab:
-		err = m.textBuffer.InsertText("\t")
+		if m.spansLines() {
+			m.shiftIndent(1)
+			return m, nil
+		}
+		edit = m.insertTab
+	case tea.KeyShiftTab:
+		m.shiftIndent(-1)
+		return m, nil
 	case tea.KeySpace:
-		err = m.textBuffer.InsertText(" ")
+		edit = func() error { return m.textBuffer.InsertText(" ") }
 	case tea.KeyRunes:
-		if len(msg.Runes) > 0 {
-			var b strings.Builder
-			for _, r := range msg.Runes {
-				if unicode.IsPrint(r) && r != '\u0000' {
-					b.WriteRune(r)
-				}
-			}
-			if b.Len() > 0 {
-				err = m.textBuffer.InsertText(b.String())
+		var b strings.Builder
+		for _, r := range msg.Runes {
+			if unicode.IsPrint(r) && r != '\u0000' {
+				b.WriteRune(r)
 			}
 		}
+		if b.Len() == 0 {
+			return m, nil
+		}
+		text := b.String()
+		edit = func() error { return m.textBuffer.InsertText(text) }
+		if len(text) == 1 && isPairKey(text[0]) && !msg.Paste {
+			edit = func() error { return m.typePair(text[0]) }
+		}
 	default:
 		return m, nil
 	}
 
+	// Every cursor gets the same edit
+	err := m.textBuffer.ForEachCaret(edit)
+
 	// Handle any errors from TextBuffer operations
 	if err != nil {
-		// For now, we'll silently ignore errors to maintain UI responsiveness
-		// In a production system, you might want to log these or show user feedback
+		slog.Warn("edit failed", "key", msg.String(), "cursor", m.textBuffer.GetCursor(), "error", err)
 		return m, nil
 	}
 
@@ -264,6 +267,10 @@ func handleTextModification(m Model, msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 }
 
 func handleQuit(m Model, _ tea.KeyMsg) (tea.Model, tea.Cmd) {
+	if m.modified {
+		m.confirm("Discard unsaved changes and quit?", quitEditor)
+		return m, nil
+	}
 	return m, tea.Quit
 }
 
@@ -272,21 +279,20 @@ func handleSave(m Model, _ tea.KeyMsg) (tea.Model, tea.Cmd) {
 }
 
 func handleHelp(m Model, _ tea.KeyMsg) (tea.Model, tea.Cmd) {
-	m.showHelp = !m.showHelp
+	if m.showHelp {
+		return m.closeHelp(), nil
+	}
+	m.showHelp = true
 	return m, nil
 }
 
 func handleGoToLine(m Model, _ tea.KeyMsg) (tea.Model, tea.Cmd) {
-	m.minibufferType = MinibufferGoToLine
-	m.minibufferInput = ""
-	m.minibufferCursorPos = 0
+	m.openPrompt(goToLinePrompt(), "")
 	return m, nil
 }
 
 func handleFind(m Model, _ tea.KeyMsg) (tea.Model, tea.Cmd) {
-	m.minibufferType = MinibufferFind
-	m.minibufferInput = ""
-	m.minibufferCursorPos = 0
+	m.openPrompt(findPrompt(), "")
 	return m, nil
 }
 
@@ -322,6 +328,10 @@ func handleSelectAll(m Model, _ tea.KeyMsg) (tea.Model, tea.Cmd) {
 	return m.handleSelectAll()
 }
 
+func handleReloadConfig(m Model, _ tea.KeyMsg) (tea.Model, tea.Cmd) {
+	return m.handleReloadConfig()
+}
+
 func (m *Model) updateWordBounds() {
 	// Only update word bounds if cursor position has changed
 	currentPos := m.textBuffer.GetCursor()
@@ -332,57 +342,75 @@ func (m *Model) updateWordBounds() {
 }
 
 func handleShiftLeft(m Model, _ tea.KeyMsg) (tea.Model, tea.Cmd) {
-	if err := m.textBuffer.MoveCursorDelta(0, -1, true); err != nil {
+	err := m.textBuffer.ForEachCaret(func() error {
+		return m.textBuffer.MoveCursorDelta(0, -1, true)
+	})
+	if err != nil {
+		logIgnored(err, "selection move failed", "direction", "left")
 		return m, nil
 	}
 	m.postMovementUpdate()
 	selText := m.textBuffer.GetSelectedText()
-	m.message = fmt.Sprintf("Selected %d characters", len(selText))
-	m.messageTime = time.Now()
+	m.hint(fmt.Sprintf("Selected %d characters", len(selText)))
 	return m, nil
 }
 
 func handleShiftRight(m Model, _ tea.KeyMsg) (tea.Model, tea.Cmd) {
-	if err := m.textBuffer.MoveCursorDelta(0, 1, true); err != nil {
+	err := m.textBuffer.ForEachCaret(func() error {
+		return m.textBuffer.MoveCursorDelta(0, 1, true)
+	})
+	if err != nil {
+		logIgnored(err, "selection move failed", "direction", "right")
 		return m, nil
 	}
 	m.postMovementUpdate()
 	selText := m.textBuffer.GetSelectedText()
-	m.message = fmt.Sprintf("Selected %d characters", len(selText))
-	m.messageTime = time.Now()
+	m.hint(fmt.Sprintf("Selected %d characters", len(selText)))
 	return m, nil
 }
 
 func handleShiftUp(m Model, _ tea.KeyMsg) (tea.Model, tea.Cmd) {
-	if err := m.textBuffer.MoveCursorDelta(-1, 0, true); err != nil {
+	err := m.textBuffer.ForEachCaret(func() error {
+		return m.textBuffer.MoveCursorDelta(-1, 0, true)
+	})
+	if err != nil {
+		logIgnored(err, "selection move failed", "direction", "up")
 		return m, nil
 	}
 	m.postMovementUpdate()
 	selText := m.textBuffer.GetSelectedText()
-	m.message = fmt.Sprintf("Selected %d characters", len(selText))
-	m.messageTime = time.Now()
+	m.hint(fmt.Sprintf("Selected %d characters", len(selText)))
 	return m, nil
 }
 
 func handleShiftDown(m Model, _ tea.KeyMsg) (tea.Model, tea.Cmd) {
-	if err := m.textBuffer.MoveCursorDelta(1, 0, true); err != nil {
+	err := m.textBuffer.ForEachCaret(func() error {
+		return m.textBuffer.MoveCursorDelta(1, 0, true)
+	})
+	if err != nil {
+		logIgnored(err, "selection move failed", "direction", "down")
 		return m, nil
 	}
 	m.postMovementUpdate()
 	selText := m.textBuffer.GetSelectedText()
-	m.message = fmt.Sprintf("Selected %d characters", len(selText))
-	m.messageTime = time.Now()
+	m.hint(fmt.Sprintf("Selected %d characters", len(selText)))
 	return m, nil
 }
 
 func handleAltLeft(m Model, _ tea.KeyMsg) (tea.Model, tea.Cmd) {
-	m.textBuffer.MoveToWordBoundary(false, true)
+	logIgnored(m.textBuffer.ForEachCaret(func() error {
+		m.textBuffer.MoveToWordBoundary(false, true)
+		return nil
+	}), "word selection failed")
 	m.postMovementUpdate()
 	return m, nil
 }
 
 func handleAltRight(m Model, _ tea.KeyMsg) (tea.Model, tea.Cmd) {
-	m.textBuffer.MoveToWordBoundary(true, true)
+	logIgnored(m.textBuffer.ForEachCaret(func() error {
+		m.textBuffer.MoveToWordBoundary(true, true)
+		return nil
+	}), "word selection failed")
 	m.postMovementUpdate()
 	return m, nil
 }
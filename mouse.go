@@ -0,0 +1,222 @@
+package main
+
+import (
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+const (
+	multiClickInterval = 400 * time.Millisecond
+	wheelScrollLines   = 3
+	// editorTextColumn is the screen column of buffer text: the border, the
+	// padding, the four-digit line number and the space after it.
+	editorTextColumn = 1 + 1 + 4 + 1
+	// editorTextRow is the screen row of the first visible line, below the
+	// top border.
+	editorTextRow = 1
+)
+
+// mouseState tracks presses to tell drags and double or triple clicks apart.
+type mouseState struct {
+	dragging   bool
+	block      bool // the drag, started with Alt, makes a block selection
+	anchor     Position
+	lastClick  time.Time
+	lastPos    Position
+	clickCount int
+}
+
+func (m Model) handleMouse(msg tea.MouseMsg) (tea.Model, tea.Cmd) {
+	if m.viewer != nil {
+		v := *m.viewer
+		switch msg.Button {
+		case tea.MouseButtonWheelUp:
+			v.scrollBy(-wheelScrollLines, m.viewerPageSize())
+		case tea.MouseButtonWheelDown:
+			v.scrollBy(wheelScrollLines, m.viewerPageSize())
+		}
+		m.viewer = &v
+		return m, nil
+	}
+	if m.showHelp {
+		switch msg.Button {
+		case tea.MouseButtonWheelUp:
+			m.helpScroll -= wheelScrollLines
+		case tea.MouseButtonWheelDown:
+			m.helpScroll += wheelScrollLines
+		}
+		m.clampHelpScroll()
+		return m, nil
+	}
+
+	switch msg.Button {
+	case tea.MouseButtonWheelUp:
+		m.scrollView(-wheelScrollLines)
+		return m, nil
+	case tea.MouseButtonWheelDown:
+		m.scrollView(wheelScrollLines)
+		return m, nil
+	case tea.MouseButtonLeft:
+	default:
+		return m, nil
+	}
+
+	if msg.Action == tea.MouseActionRelease {
+		m.mouse.dragging = false
+		return m, nil
+	}
+
+	if msg.Y >= m.minibufferTop() {
+		if msg.Action == tea.MouseActionPress && m.minibufferType == MinibufferFindResults {
+			return m.clickFindResult(msg.Y)
+		}
+		return m, nil
+	}
+
+	pos, ok := m.screenToBuffer(msg.X, msg.Y)
+	if !ok {
+		return m, nil
+	}
+
+	if msg.Action == tea.MouseActionMotion {
+		if m.mouse.dragging && m.mouse.block {
+			m.dragBlockTo(msg.X, pos)
+		} else if m.mouse.dragging {
+			m.dragTo(pos)
+		}
+		return m, nil
+	}
+
+	// A click in the text closes search results or the palette, as Esc
+	// would. Prompts and the theme picker must be answered first.
+	switch m.minibufferType {
+	case MinibufferPrompt, MinibufferThemePicker:
+		return m, nil
+	case MinibufferFindResults, MinibufferCommandPalette, MinibufferClipboardHistory:
+		next, _ := handleEscapeKey(m)
+		m = next.(Model)
+	}
+	next, cmd := m.clickAt(pos)
+	m = next.(Model)
+	m.mouse.block = msg.Alt && m.mouse.dragging
+	return m, cmd
+}
+
+// screenToBuffer maps a screen cell in the editor area to a buffer position,
+// accounting for the gutter, the scroll offsets and wide characters.
+func (m Model) screenToBuffer(x, y int) (Position, bool) {
+	row := y - editorTextRow
+	if row < 0 || row >= m.getVisibleLines() {
+		return Position{}, false
+	}
+	lineCount := m.textBuffer.GetLineCount()
+	line := min(m.scrollOffset+row, lineCount-1)
+	text := m.textBuffer.GetLine(line)
+
+	cells := x - editorTextColumn
+	col := min(m.horizontalOffset, len(text))
+	for _, r := range text[col:] {
+		if cells <= 0 {
+			break
+		}
+		w := cellWidth(r)
+		if cells < w {
+			break
+		}
+		cells -= w
+		col += len(string(r))
+	}
+	return Position{Line: line, Column: col}, true
+}
+
+func (m Model) clickAt(pos Position) (tea.Model, tea.Cmd) {
+	now := time.Now()
+	if pos == m.mouse.lastPos && now.Sub(m.mouse.lastClick) < multiClickInterval {
+		m.mouse.clickCount = m.mouse.clickCount%3 + 1
+	} else {
+		m.mouse.clickCount = 1
+	}
+	m.mouse.lastClick = now
+	m.mouse.lastPos = pos
+
+	if m.vim.enabled && m.vim.mode != VimInsert {
+		m.vimEnterNormal()
+	}
+	m.textBuffer.ClearSelection()
+	m.textBuffer.ClearCarets()
+	m.textBuffer.SetCursor(pos)
+
+	switch m.mouse.clickCount {
+	case 1:
+		m.mouse.dragging = true
+		m.mouse.anchor = m.textBuffer.GetCursor()
+		if m.vim.enabled {
+			m.vimClampCursor()
+		}
+	case 2:
+		m.textBuffer.SelectWord()
+	case 3:
+		m.textBuffer.SelectLine()
+	}
+	m.postMovementUpdate()
+	return m, nil
+}
+
+// dragTo extends the selection from the press position to pos. In vim mode
+// the drag enters visual mode so operators apply to it.
+func (m *Model) dragTo(pos Position) {
+	m.textBuffer.SetCursor(pos)
+	if m.vim.enabled {
+		if m.vim.mode != VimVisual {
+			m.vim.mode = VimVisual
+			m.vim.anchor = m.mouse.anchor
+		}
+		m.vimUpdateVisualSelection()
+	} else if pos != m.mouse.anchor {
+		m.textBuffer.SetSelection(&Selection{Start: m.mouse.anchor, End: m.textBuffer.GetCursor()})
+	} else {
+		m.textBuffer.ClearSelection()
+	}
+	m.postMovementUpdate()
+}
+
+// dragBlockTo stretches a block selection from the press position to the
+// screen column x on pos's line, which may lie past the end of the line.
+func (m *Model) dragBlockTo(x int, pos Position) {
+	line := m.textBuffer.GetLine(pos.Line)
+	offset := m.horizontalOffset
+	column := displayColumn(line, offset) + max(offset-len(line), 0) + max(x-editorTextColumn, 0)
+	anchor := m.mouse.anchor
+	m.textBuffer.SetBlock(&Block{
+		Anchor: Position{Line: anchor.Line, Column: displayColumn(m.textBuffer.GetLine(anchor.Line), anchor.Column)},
+		Head:   Position{Line: pos.Line, Column: column},
+	})
+	m.postMovementUpdate()
+}
+
+// scrollView moves the viewport without moving the cursor. The next cursor
+// movement scrolls back to it.
+func (m *Model) scrollView(delta int) {
+	maxOffset := max(m.textBuffer.GetLineCount()-m.getVisibleLines(), 0)
+	m.scrollOffset = clamp(m.scrollOffset+delta, 0, maxOffset)
+	m.viewportY = m.scrollOffset
+	m.applySyntaxHighlighting()
+}
+
+// minibufferTop is the screen row where the minibuffer or status bar starts.
+func (m Model) minibufferTop() int {
+	return m.getVisibleLines() + 2 + m.getWhichKeyHeight()
+}
+
+// clickFindResult jumps to the search result on the clicked row. The first
+// minibuffer row is the results header.
+func (m Model) clickFindResult(y int) (tea.Model, tea.Cmd) {
+	row := y - m.minibufferTop() - 1
+	shown := min(len(m.findResults)-m.searchResultsOffset, m.maxResultsDisplay)
+	if row < 0 || row >= shown {
+		return m, nil
+	}
+	m.findIndex = m.searchResultsOffset + row
+	return handleFindResultsEnter(m)
+}
@@ -0,0 +1,363 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// Caret is a secondary cursor. Like the primary cursor it may carry a
+// selection, which ends at Pos.
+type Caret struct {
+	Pos       Position
+	Selection *Selection
+}
+
+// start is where the caret's edit begins: the start of its selection, or
+// the cursor.
+func (c Caret) start() Position {
+	if c.Selection != nil {
+		start, _ := c.Selection.Normalize()
+		return start
+	}
+	return c.Pos
+}
+
+func positionBefore(a, b Position) bool {
+	return a.Line < b.Line || (a.Line == b.Line && a.Column < b.Column)
+}
+
+// HasCarets reports whether there are cursors besides the primary one.
+func (tb *TextBuffer) HasCarets() bool {
+	tb.mu.RLock()
+	defer tb.mu.RUnlock()
+	return len(tb.carets) > 0
+}
+
+// Carets returns the secondary cursors.
+func (tb *TextBuffer) Carets() []Caret {
+	tb.mu.RLock()
+	defer tb.mu.RUnlock()
+	return slices.Clone(tb.carets)
+}
+
+func (tb *TextBuffer) ClearCarets() {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	tb.carets = nil
+}
+
+// SetCarets replaces the secondary cursors.
+func (tb *TextBuffer) SetCarets(carets []Caret) {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	tb.carets = tb.carets[:0]
+	for _, c := range carets {
+		c.Pos = tb.clampPosition(c.Pos)
+		tb.carets = append(tb.carets, c)
+	}
+	tb.dedupeCarets()
+}
+
+// PushCaret makes pos, with an optional selection, the primary cursor and
+// keeps the previous primary cursor as a secondary one.
+func (tb *TextBuffer) PushCaret(pos Position, selection *Selection) {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	pos = tb.clampPosition(pos)
+	if pos == tb.cursor {
+		return
+	}
+	tb.carets = append(tb.carets, Caret{Pos: tb.cursor, Selection: tb.selection})
+	tb.cursor = pos
+	tb.selection = selection
+	tb.selectAllOriginalCursor = nil
+	tb.dedupeCarets()
+}
+
+// dedupeCarets drops secondary cursors that coincide with the primary
+// cursor or with each other.
+func (tb *TextBuffer) dedupeCarets() {
+	seen := map[Position]bool{tb.cursor: true}
+	kept := tb.carets[:0]
+	for _, c := range tb.carets {
+		if !seen[c.Pos] {
+			seen[c.Pos] = true
+			kept = append(kept, c)
+		}
+	}
+	tb.carets = kept
+}
+
+// offset converts a position to a byte offset in the content, counting one
+// byte per line break.
+func (tb *TextBuffer) offset(pos Position) int {
+	off := 0
+	for i := 0; i < pos.Line && i < len(tb.lines); i++ {
+		off += len(tb.lines[i]) + 1
+	}
+	return off + pos.Column
+}
+
+func (tb *TextBuffer) positionAt(off int) Position {
+	for i, line := range tb.lines {
+		if off <= len(line) || i == len(tb.lines)-1 {
+			return tb.clampPosition(Position{Line: i, Column: max(off, 0)})
+		}
+		off -= len(line) + 1
+	}
+	return Position{}
+}
+
+func (tb *TextBuffer) length() int {
+	n := max(len(tb.lines)-1, 0)
+	for _, line := range tb.lines {
+		n += len(line)
+	}
+	return n
+}
+
+// caretOffsets is a cursor and its selection as byte offsets, which stay
+// meaningful while other cursors edit the buffer.
+type caretOffsets struct {
+	pos, anchor, head int
+	selected          bool
+}
+
+func (c *caretOffsets) shift(delta int) {
+	c.pos += delta
+	c.anchor += delta
+	c.head += delta
+}
+
+// ForEachCaret runs fn once per cursor with that cursor and its selection
+// made current. Cursors are visited from the end of the buffer backwards, so
+// an edit never moves a cursor still to be visited; cursors already visited
+// shift by the change in length. The edits form a single undo step. Without
+// secondary cursors fn simply runs once.
+func (tb *TextBuffer) ForEachCaret(fn func() error) error {
+	tb.mu.Lock()
+	if len(tb.carets) == 0 {
+		tb.mu.Unlock()
+		return fn()
+	}
+	carets := append([]Caret{{Pos: tb.cursor, Selection: tb.selection}}, tb.carets...)
+	tb.carets = nil
+	tb.mu.Unlock()
+
+	tb.BeginUndoGroup()
+	defer tb.EndUndoGroup()
+
+	order := make([]int, len(carets))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return positionBefore(carets[order[b]].start(), carets[order[a]].start())
+	})
+
+	done := make([]caretOffsets, len(carets))
+	var firstErr error
+	for k, i := range order {
+		c := carets[i]
+		tb.SetCursor(c.Pos)
+		if c.Selection != nil {
+			selection := *c.Selection
+			tb.SetSelection(&selection)
+		} else {
+			tb.ClearSelection()
+		}
+
+		tb.mu.RLock()
+		before := tb.length()
+		tb.mu.RUnlock()
+		if err := fn(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+
+		tb.mu.RLock()
+		delta := tb.length() - before
+		done[i] = caretOffsets{pos: tb.offset(tb.cursor)}
+		if tb.selection != nil {
+			done[i].selected = true
+			done[i].anchor = tb.offset(tb.selection.Start)
+			done[i].head = tb.offset(tb.selection.End)
+		}
+		tb.mu.RUnlock()
+		for _, j := range order[:k] {
+			done[j].shift(delta)
+		}
+	}
+
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	for i, d := range done {
+		c := Caret{Pos: tb.positionAt(d.pos)}
+		if d.selected {
+			c.Selection = &Selection{Start: tb.positionAt(d.anchor), End: tb.positionAt(d.head)}
+		}
+		if i == 0 {
+			tb.cursor, tb.selection = c.Pos, c.Selection
+		} else {
+			tb.carets = append(tb.carets, c)
+		}
+	}
+	tb.dedupeCarets()
+	return firstErr
+}
+
+// handleAddCursorAbove adds a cursor on the line above the topmost cursor.
+func handleAddCursorAbove(m Model, _ tea.KeyMsg) (tea.Model, tea.Cmd) {
+	return m.addCursorVertical(-1)
+}
+
+// handleAddCursorBelow adds a cursor on the line below the bottommost cursor.
+func handleAddCursorBelow(m Model, _ tea.KeyMsg) (tea.Model, tea.Cmd) {
+	return m.addCursorVertical(1)
+}
+
+func (m Model) addCursorVertical(dir int) (tea.Model, tea.Cmd) {
+	edge := m.textBuffer.GetCursor()
+	for _, c := range m.textBuffer.Carets() {
+		if (dir < 0 && c.Pos.Line < edge.Line) || (dir > 0 && c.Pos.Line > edge.Line) {
+			edge = c.Pos
+		}
+	}
+	line := edge.Line + dir
+	if line < 0 || line >= m.textBuffer.GetLineCount() {
+		return m, nil
+	}
+	m.textBuffer.ClearSelection()
+	m.textBuffer.PushCaret(Position{Line: line, Column: edge.Column}, nil)
+	m.postMovementUpdate()
+	m.hintCursorCount()
+	return m, nil
+}
+
+// handleAddNextOccurrence selects the word under the cursor, or, with a
+// selection, adds a cursor at the next occurrence of the selected text,
+// wrapping at the end of the buffer.
+func handleAddNextOccurrence(m Model, _ tea.KeyMsg) (tea.Model, tea.Cmd) {
+	cursor := m.textBuffer.GetCursor()
+	if !m.textBuffer.HasSelection() {
+		start, end := m.textBuffer.GetWordBoundsAtCursor()
+		if start < 0 || end <= start {
+			m.setMessage("No word under the cursor")
+			return m, nil
+		}
+		m.textBuffer.SetSelection(&Selection{Start: Position{Line: cursor.Line, Column: start}, End: Position{Line: cursor.Line, Column: end}})
+		m.textBuffer.SetCursor(Position{Line: cursor.Line, Column: end})
+		m.postMovementUpdate()
+		return m, nil
+	}
+
+	query := m.textBuffer.GetSelectedText()
+	taken := map[Position]bool{}
+	for _, c := range append(m.textBuffer.Carets(), Caret{Pos: cursor, Selection: m.textBuffer.GetSelection()}) {
+		taken[c.start()] = true
+	}
+	matches := m.textBuffer.FindText(query, true)
+	var next *Position
+	for i := range matches {
+		if !taken[matches[i]] && positionBefore(cursor, matches[i]) {
+			next = &matches[i]
+			break
+		}
+	}
+	if next == nil {
+		for i := range matches {
+			if !taken[matches[i]] {
+				next = &matches[i]
+				break
+			}
+		}
+	}
+	if next == nil {
+		m.setMessage("No more occurrences")
+		return m, nil
+	}
+
+	end := m.endOfMatch(*next, query)
+	m.textBuffer.PushCaret(end, &Selection{Start: *next, End: end})
+	m.postMovementUpdate()
+	m.hintCursorCount()
+	return m, nil
+}
+
+// handleCursorsFromFind puts a cursor on every search result, selecting the
+// match.
+func handleCursorsFromFind(m Model, _ tea.KeyMsg) (tea.Model, tea.Cmd) {
+	results := m.findResults
+	if len(results) == 0 && m.lastSearchQuery != "" {
+		results = m.textBuffer.FindText(m.lastSearchQuery, false)
+	}
+	if len(results) == 0 {
+		m.setMessage("No search results")
+		return m, nil
+	}
+	if m.minibufferType == MinibufferFindResults {
+		m.closeMinibuffer()
+	}
+	m.textBuffer.ClearCarets()
+	for i, start := range results {
+		end := m.endOfMatch(start, m.lastSearchQuery)
+		if i == 0 {
+			m.textBuffer.SetCursor(end)
+			m.textBuffer.SetSelection(&Selection{Start: start, End: end})
+			continue
+		}
+		m.textBuffer.PushCaret(end, &Selection{Start: start, End: end})
+	}
+	m.postMovementUpdate()
+	m.hintCursorCount()
+	return m, nil
+}
+
+// endOfMatch is the position just past a match of query starting at start.
+func (m Model) endOfMatch(start Position, query string) Position {
+	lines := strings.Split(query, "\n")
+	if len(lines) == 1 {
+		return Position{Line: start.Line, Column: start.Column + len(query)}
+	}
+	return Position{Line: start.Line + len(lines) - 1, Column: len(lines[len(lines)-1])}
+}
+
+func (m *Model) hintCursorCount() {
+	if n := len(m.textBuffer.Carets()); n > 0 {
+		m.hint(fmt.Sprintf("%d cursors", n+1))
+	}
+}
+
+// selectedTexts returns the selected text of every cursor in buffer order.
+func (m Model) selectedTexts() []string {
+	var parts []string
+	logIgnored(m.textBuffer.ForEachCaret(func() error {
+		if text := m.textBuffer.GetSelectedText(); text != "" {
+			parts = append(parts, text)
+		}
+		return nil
+	}), "collecting selections failed")
+	slices.Reverse(parts)
+	return parts
+}
+
+// insertAtCarets inserts text at every cursor. When text has one line per
+// cursor, each cursor gets its own line, as when pasting text copied from
+// the same number of cursors.
+func (m *Model) insertAtCarets(text string) error {
+	count := len(m.textBuffer.Carets()) + 1
+	lines := strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+	k := 0
+	return m.textBuffer.ForEachCaret(func() error {
+		piece := text
+		if len(lines) == count {
+			// Cursors are visited last to first
+			piece = lines[count-1-k]
+		}
+		k++
+		return m.textBuffer.InsertText(piece)
+	})
+}
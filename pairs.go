@@ -0,0 +1,191 @@
+package main
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/alecthomas/chroma/v2"
+)
+
+// autoPairs maps each character that opens a pair to the one that closes it.
+var autoPairs = map[byte]byte{'(': ')', '[': ']', '{': '}', '"': '"', '\'': '\'', '`': '`'}
+
+// pairContextLines is how far back inStringOrComment lexes from the cursor.
+const pairContextLines = 500
+
+// tagLexers are the languages where typing > on an open tag closes it.
+var tagLexers = []string{"HTML", "XML", "react", "vue", "Svelte"}
+
+// voidElements are the HTML elements that never have a closing tag.
+var voidElements = []string{"area", "base", "br", "col", "embed", "hr", "img", "input", "link", "meta", "source", "track", "wbr"}
+
+// isPairKey reports whether typing c goes through typePair.
+func isPairKey(c byte) bool {
+	_, opens := autoPairs[c]
+	_, closes := closingBrackets[c]
+	return opens || closes || c == '>'
+}
+
+// typePair types one character with bracket and quote pairing: an opener
+// wraps the selection or inserts its closer too, a closer steps over the same
+// character after the cursor, and > closes an open tag. Pairing is left out
+// inside strings and comments.
+func (m Model) typePair(c byte) error {
+	if m.textBuffer.HasSelection() {
+		if closer, ok := autoPairs[c]; ok {
+			return m.wrapSelection(c, closer)
+		}
+	}
+	cursor := m.textBuffer.GetCursor()
+	line := m.textBuffer.GetLine(cursor.Line)
+	before, after := line[:min(cursor.Column, len(line))], line[min(cursor.Column, len(line)):]
+
+	_, isCloser := closingBrackets[c]
+	if !m.textBuffer.HasSelection() && after != "" && after[0] == c && (isCloser || autoPairs[c] == c) {
+		m.textBuffer.SetCursor(Position{Line: cursor.Line, Column: cursor.Column + 1})
+		return nil
+	}
+	if isCloser {
+		return m.insertClosingBracket(c)
+	}
+	if m.textBuffer.HasSelection() || m.inStringOrComment(cursor) {
+		return m.textBuffer.InsertText(string(c))
+	}
+	if c == '>' {
+		return m.closeTag(cursor, before, after)
+	}
+
+	closer := autoPairs[c]
+	if !pairsBefore(after) || (c == closer && before != "" && (isWordByte(before[len(before)-1]) || before[len(before)-1] == c)) {
+		return m.textBuffer.InsertText(string(c))
+	}
+	if err := m.textBuffer.InsertText(string(c) + string(closer)); err != nil {
+		return err
+	}
+	m.textBuffer.SetCursor(Position{Line: cursor.Line, Column: cursor.Column + 1})
+	return nil
+}
+
+// pairsBefore reports whether a pair may be inserted in front of after: at
+// the end of the line, or before whitespace, a closer or punctuation that
+// ends an expression.
+func pairsBefore(after string) bool {
+	return after == "" || strings.ContainsAny(after[:1], " \t)]},;:")
+}
+
+// wrapSelection puts opener and closer around the selection and keeps the
+// wrapped text selected.
+func (m Model) wrapSelection(opener, closer byte) error {
+	start, end := m.textBuffer.GetSelection().Normalize()
+	text := m.textBuffer.GetSelectedText()
+	if err := m.textBuffer.InsertText(string(opener) + text + string(closer)); err != nil {
+		return err
+	}
+	start.Column++
+	if end.Line == start.Line {
+		end.Column++
+	}
+	m.textBuffer.SetSelection(&Selection{Start: start, End: end})
+	m.textBuffer.SetCursor(end)
+	return nil
+}
+
+// closeTag types > and, when it ends an open tag such as <div class="x">,
+// inserts the matching closing tag after the cursor.
+func (m Model) closeTag(cursor Position, before, after string) error {
+	name := openTagName(before)
+	if name == "" || !m.closesTags() || strings.HasPrefix(after, "</"+name+">") ||
+		(m.highlighter.LexerName() == "HTML" && slices.Contains(voidElements, strings.ToLower(name))) {
+		return m.textBuffer.InsertText(">")
+	}
+	if err := m.textBuffer.InsertText("></" + name + ">"); err != nil {
+		return err
+	}
+	m.textBuffer.SetCursor(Position{Line: cursor.Line, Column: cursor.Column + 1})
+	return nil
+}
+
+// closesTags reports whether the buffer's language has tags, counting
+// TypeScript only in .tsx files.
+func (m Model) closesTags() bool {
+	name := m.highlighter.LexerName()
+	return slices.Contains(tagLexers, name) ||
+		(name == "TypeScript" && strings.HasSuffix(plainFilename(m.filename), ".tsx"))
+}
+
+// openTagName returns the name of the tag that before ends inside of, or ""
+// when that is a closing, self-closing or special tag such as <!-- or <?xml.
+func openTagName(before string) string {
+	lt := strings.LastIndexByte(before, '<')
+	if lt < 0 {
+		return ""
+	}
+	tag := before[lt+1:]
+	if tag == "" || strings.ContainsAny(tag, "<>") || strings.HasSuffix(tag, "/") {
+		return ""
+	}
+	c := tag[0]
+	if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z') {
+		return ""
+	}
+	end := strings.IndexFunc(tag, func(r rune) bool {
+		return !(isWordByte(byte(r)) && r < 0x80 || r == '-' || r == ':' || r == '.')
+	})
+	if end < 0 {
+		return tag
+	}
+	return tag[:end]
+}
+
+// inStringOrComment reports whether text typed at pos would land in a string
+// or comment. It lexes the lines before pos with a probe character at pos and
+// checks the probe's token.
+func (m Model) inStringOrComment(pos Position) bool {
+	first := max(pos.Line-pairContextLines, 0)
+	var b strings.Builder
+	for l := first; l < pos.Line; l++ {
+		b.WriteString(m.textBuffer.GetLine(l))
+		b.WriteByte('\n')
+	}
+	line := m.textBuffer.GetLine(pos.Line)
+	col := min(pos.Column, len(line))
+	offset := b.Len() + col
+	b.WriteString(line[:col] + "x" + line[col:] + "\n")
+
+	tokenType, ok := m.highlighter.tokenTypeAt(b.String(), offset)
+	return ok && (tokenType.InCategory(chroma.Comment) || tokenType.InSubCategory(chroma.LiteralString))
+}
+
+// tokenTypeAt lexes text and returns the type of the token holding the byte
+// at offset.
+func (h *Highlighter) tokenTypeAt(text string, offset int) (chroma.TokenType, bool) {
+	iterator, err := h.lexer.Tokenise(nil, text)
+	if err != nil {
+		logIgnored(err, "tokenise failed", "lexer", h.LexerName())
+		return 0, false
+	}
+	pos := 0
+	for token := iterator(); token != chroma.EOF; token = iterator() {
+		pos += len(token.Value)
+		if pos > offset {
+			return token.Type, true
+		}
+	}
+	return 0, false
+}
+
+// deletePair deletes an empty pair around the cursor, such as (|), and
+// reports whether there was one.
+func (m Model) deletePair() (bool, error) {
+	cursor := m.textBuffer.GetCursor()
+	line := m.textBuffer.GetLine(cursor.Line)
+	col := cursor.Column
+	if m.textBuffer.HasSelection() || col == 0 || col >= len(line) {
+		return false, nil
+	}
+	if closer, ok := autoPairs[line[col-1]]; !ok || line[col] != closer {
+		return false, nil
+	}
+	m.textBuffer.SetSelection(&Selection{Start: Position{Line: cursor.Line, Column: col - 1}, End: Position{Line: cursor.Line, Column: col + 1}})
+	return true, m.textBuffer.DeleteChar(true)
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// paletteMatch is a command that matched the palette filter.
+type paletteMatch struct {
+	cmd   *Command
+	score int
+}
+
+func handleCommandPalette(m Model, _ tea.KeyMsg) (tea.Model, tea.Cmd) {
+	m.minibufferType = MinibufferCommandPalette
+	m.minibufferInput = ""
+	m.minibufferCursorPos = 0
+	m.paletteIndex = 0
+	m.paletteOffset = 0
+	return m, nil
+}
+
+// fuzzyScore reports whether every character of pattern appears in text in
+// order, ignoring case. Consecutive matches and matches at the start of a
+// word score higher.
+func fuzzyScore(pattern, text string) (int, bool) {
+	if pattern == "" {
+		return 0, true
+	}
+	p := []rune(strings.ToLower(pattern))
+	t := []rune(text)
+
+	score, pi, last := 0, 0, -1
+	for ti := 0; ti < len(t) && pi < len(p); ti++ {
+		if unicode.ToLower(t[ti]) != p[pi] {
+			continue
+		}
+		score++
+		if last == ti-1 {
+			score += 5
+		}
+		if ti == 0 || !unicode.IsLetter(t[ti-1]) || (unicode.IsUpper(t[ti]) && unicode.IsLower(t[ti-1])) {
+			score += 3
+		}
+		if last >= 0 {
+			score -= min(ti-last-1, 3)
+		}
+		last = ti
+		pi++
+	}
+	return score, pi == len(p)
+}
+
+// paletteMatches filters the registry by the palette input, best match first.
+func (m Model) paletteMatches() []paletteMatch {
+	var matches []paletteMatch
+	for _, cmd := range commands.All() {
+		nameScore, nameOK := fuzzyScore(m.minibufferInput, cmd.Name)
+		descScore, descOK := fuzzyScore(m.minibufferInput, cmd.Description)
+		if !nameOK && !descOK {
+			continue
+		}
+		score := nameScore
+		if !nameOK || (descOK && descScore > score) {
+			score = descScore
+		}
+		matches = append(matches, paletteMatch{cmd: cmd, score: score})
+	}
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].score > matches[j].score })
+	return matches
+}
+
+func handlePaletteEnter(m Model) (tea.Model, tea.Cmd) {
+	matches := m.paletteMatches()
+	m.minibufferType = MinibufferNone
+	m.minibufferInput = ""
+	m.minibufferCursorPos = 0
+	if m.paletteIndex >= len(matches) {
+		return m, nil
+	}
+	return m.runCommand(matches[m.paletteIndex].cmd, tea.KeyMsg{})
+}
+
+func (m *Model) movePaletteSelection(delta int) {
+	count := len(m.paletteMatches())
+	if count == 0 {
+		return
+	}
+	m.paletteIndex = (m.paletteIndex + delta + count) % count
+	if m.paletteIndex < m.paletteOffset {
+		m.paletteOffset = m.paletteIndex
+	} else if m.paletteIndex >= m.paletteOffset+m.maxResultsDisplay {
+		m.paletteOffset = m.paletteIndex - m.maxResultsDisplay + 1
+	}
+}
+
+func (m Model) getPaletteHeight() int {
+	rows := min(len(m.paletteMatches()), m.maxResultsDisplay)
+	return 1 + max(rows, 1)
+}
+
+func (m Model) renderPaletteMinibuffer() string {
+	var lines []string
+
+	input := renderMinibufferInput(m.minibufferInput, m.minibufferCursorPos)
+	lines = append(lines, minibufferPromptStyle.Render("> ")+minibufferInputStyle.Render(input))
+
+	matches := m.paletteMatches()
+	if len(matches) == 0 {
+		lines = append(lines, helpStyle.Render("  No matching commands"))
+	}
+
+	descWidth := max(m.width-40, 20)
+	end := min(m.paletteOffset+m.maxResultsDisplay, len(matches))
+	for i := m.paletteOffset; i < end; i++ {
+		cmd := matches[i].cmd
+		binding := ""
+		if b := keys.binding(cmd.Name); b != nil && b.Enabled() {
+			binding = b.Help().Key
+		}
+
+		desc := cmd.Description
+		reason := cmd.disabledReason(m)
+		if reason != "" {
+			desc = fmt.Sprintf("%s (%s)", desc, reason)
+		}
+		row := "  " + lipgloss.NewStyle().Width(descWidth).MaxWidth(descWidth).Render(desc) +
+			lipgloss.NewStyle().Width(16).Render(binding)
+
+		switch {
+		case i == m.paletteIndex:
+			row = searchResultSelectedStyle.Render(row)
+		case reason != "":
+			row = helpStyle.Render(row)
+		default:
+			row = searchResultNormalStyle.Render(row)
+		}
+		lines = append(lines, row)
+	}
+
+	return minibufferStyle.Width(m.width - 2).Render(strings.Join(lines, "\n"))
+}
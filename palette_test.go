@@ -0,0 +1,41 @@
+package main
+
+import "testing"
+
+func TestFuzzyScore(t *testing.T) {
+	matches := []struct {
+		pattern, text string
+		want          bool
+	}{
+		{"", "save", true},
+		{"sv", "save", true},
+		{"SAVE", "save", true},
+		{"mlu", "moveLinesUp", true},
+		{"évé", "Événement", true},
+		{"vs", "save", false},
+		{"saves", "save", false},
+	}
+	for _, tt := range matches {
+		if _, ok := fuzzyScore(tt.pattern, tt.text); ok != tt.want {
+			t.Errorf("fuzzyScore(%q, %q) matched %v, want %v", tt.pattern, tt.text, ok, tt.want)
+		}
+	}
+
+	// Each pattern should rank better against the first text than the second
+	ranking := []struct {
+		pattern, better, worse string
+	}{
+		{"copy", "copy", "clipboardHistory copy"},
+		{"find", "findNext", "selectAll find"},
+		{"mlu", "moveLinesUp", "multicursor"},
+		{"dup", "duplicateLines", "addCursorUp"},
+		{"ln", "lineNumbers", "selection"},
+	}
+	for _, tt := range ranking {
+		better, _ := fuzzyScore(tt.pattern, tt.better)
+		worse, _ := fuzzyScore(tt.pattern, tt.worse)
+		if better <= worse {
+			t.Errorf("%q: %q scored %d, not above %q at %d", tt.pattern, tt.better, better, tt.worse, worse)
+		}
+	}
+}
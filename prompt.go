@@ -0,0 +1,339 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+const (
+	historyFileName  = "history.json"
+	maxPromptHistory = 100
+)
+
+// Prompt is a single-line input shown in the minibuffer. Find, go to line,
+// passphrases, the command line and confirmations are all prompts.
+type Prompt struct {
+	// ID names the prompt's history. Prompts without an ID keep none.
+	ID    string
+	Label string
+	// Masked hides the input, for passphrases.
+	Masked bool
+	// Confirm turns the prompt into a yes/no question answered with y or n.
+	// Submit receives "y" or "n".
+	Confirm bool
+	// Validate rejects input on Enter, keeping the prompt open with the error.
+	Validate func(m Model, input string) error
+	// Complete is consulted on Tab.
+	Complete CompletionSource
+	Submit   func(m Model, input string) (tea.Model, tea.Cmd)
+	// Cancel runs on Escape. When nil the prompt simply closes.
+	Cancel func(m Model) (tea.Model, tea.Cmd)
+}
+
+// CompletionSource completes input, returning the new input and the
+// candidates when more than one remains.
+type CompletionSource func(m Model, input string) (string, []string)
+
+func (m *Model) openPrompt(p Prompt, initial string) {
+	m.prompt = p
+	m.minibufferType = MinibufferPrompt
+	m.minibufferInput = initial
+	m.minibufferCursorPos = len(initial)
+	m.promptHistoryPos = len(m.history.entries(p.ID))
+	m.promptDraft = ""
+}
+
+func (m *Model) closePrompt() {
+	m.prompt = Prompt{}
+	m.minibufferType = MinibufferNone
+	m.minibufferInput = ""
+	m.minibufferCursorPos = 0
+}
+
+// confirm asks a yes/no question and runs onYes if the answer is yes.
+func (m *Model) confirm(question string, onYes func(m Model) (tea.Model, tea.Cmd)) {
+	m.openPrompt(Prompt{
+		Label:   question,
+		Confirm: true,
+		Submit: func(m Model, answer string) (tea.Model, tea.Cmd) {
+			if answer == "y" {
+				return onYes(m)
+			}
+			return m, nil
+		},
+	}, "")
+}
+
+func (m Model) handlePromptInput(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	if m.prompt.Confirm {
+		switch strings.ToLower(msg.String()) {
+		case "y", "n":
+			m.minibufferInput = strings.ToLower(msg.String())
+			return m.submitPrompt()
+		case "esc":
+			return m.cancelPrompt()
+		}
+		return m, nil
+	}
+
+	switch msg.Type {
+	case tea.KeyEscape:
+		return m.cancelPrompt()
+	case tea.KeyEnter:
+		return m.submitPrompt()
+	case tea.KeyUp:
+		m.browsePromptHistory(-1)
+	case tea.KeyDown:
+		m.browsePromptHistory(1)
+	case tea.KeyTab:
+		if m.prompt.Complete != nil {
+			completed, candidates := m.prompt.Complete(m, m.minibufferInput)
+			m.minibufferInput = completed
+			m.minibufferCursorPos = len(completed)
+			if len(candidates) > 0 {
+				m.hint(strings.Join(candidates, "  "))
+			}
+		}
+	case tea.KeyRunes, tea.KeySpace:
+		return handleTextInput(m, msg)
+	default:
+		return handleEditingKeys(m, msg)
+	}
+	return m, nil
+}
+
+func (m Model) submitPrompt() (tea.Model, tea.Cmd) {
+	p := m.prompt
+	input := m.minibufferInput
+	if p.Validate != nil {
+		if err := p.Validate(m, input); err != nil {
+			m.notify(MessageWarning, err.Error())
+			return m, nil
+		}
+	}
+
+	m.closePrompt()
+	// Sensitive buffers keep search terms and commands off the disk
+	if !m.sensitive {
+		m.history.add(p.ID, input)
+	}
+	if p.Submit == nil {
+		return m, nil
+	}
+	return p.Submit(m, input)
+}
+
+func (m Model) cancelPrompt() (tea.Model, tea.Cmd) {
+	cancel := m.prompt.Cancel
+	m.closePrompt()
+	m.textBuffer.ClearSelection()
+	if cancel != nil {
+		return cancel(m)
+	}
+	return m, nil
+}
+
+// browsePromptHistory steps through earlier entries for the open prompt,
+// keeping the partially typed input to return to.
+func (m *Model) browsePromptHistory(delta int) {
+	entries := m.history.entries(m.prompt.ID)
+	pos := m.promptHistoryPos + delta
+	if pos < 0 || pos > len(entries) {
+		return
+	}
+	if m.promptHistoryPos == len(entries) {
+		m.promptDraft = m.minibufferInput
+	}
+	m.promptHistoryPos = pos
+	if pos == len(entries) {
+		m.minibufferInput = m.promptDraft
+	} else {
+		m.minibufferInput = entries[pos]
+	}
+	m.minibufferCursorPos = len(m.minibufferInput)
+}
+
+func (m Model) renderPromptMinibuffer() string {
+	label := m.prompt.Label
+	if m.prompt.Confirm {
+		label += " (y/n) "
+	}
+
+	input, pos := m.minibufferInput, m.minibufferCursorPos
+	if m.prompt.Masked {
+		input = strings.Repeat("*", utf8.RuneCountInString(input))
+		pos = utf8.RuneCountInString(m.minibufferInput[:pos])
+	}
+
+	var inputDisplay string
+	if !m.prompt.Confirm {
+		inputDisplay = renderMinibufferInput(input, pos)
+	}
+
+	content := minibufferPromptStyle.Render(label) + minibufferInputStyle.Render(inputDisplay)
+	if message, ok := m.activeMessage(); ok {
+		content += "  " + message
+	}
+	return minibufferStyle.Width(m.width - 2).Render(content)
+}
+
+// PromptHistory is the per-prompt input history, persisted as JSON in the
+// config directory. A nil history records nothing.
+type PromptHistory struct {
+	path    string
+	Prompts map[string][]string `json:"prompts"`
+}
+
+func loadPromptHistory() *PromptHistory {
+	h := &PromptHistory{Prompts: make(map[string][]string)}
+	dir, err := configDir()
+	if err != nil {
+		return h
+	}
+	h.path = filepath.Join(dir, historyFileName)
+	if data, err := os.ReadFile(h.path); err == nil {
+		if err := json.Unmarshal(data, h); err != nil {
+			slog.Warn("ignoring unreadable prompt history", "path", h.path, "error", err)
+		}
+		if h.Prompts == nil {
+			h.Prompts = make(map[string][]string)
+		}
+	}
+	return h
+}
+
+func (h *PromptHistory) entries(id string) []string {
+	if h == nil || id == "" {
+		return nil
+	}
+	return h.Prompts[id]
+}
+
+// add appends entry to the prompt's history, moving an identical earlier
+// entry to the end, and saves the history.
+func (h *PromptHistory) add(id, entry string) {
+	if h == nil || id == "" || strings.TrimSpace(entry) == "" {
+		return
+	}
+	list := h.Prompts[id]
+	kept := make([]string, 0, len(list)+1)
+	for _, e := range list {
+		if e != entry {
+			kept = append(kept, e)
+		}
+	}
+	kept = append(kept, entry)
+	if len(kept) > maxPromptHistory {
+		kept = kept[len(kept)-maxPromptHistory:]
+	}
+	h.Prompts[id] = kept
+	if err := h.save(); err != nil {
+		slog.Warn("saving prompt history failed", "path", h.path, "error", err)
+	}
+}
+
+func (h *PromptHistory) save() error {
+	if h.path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(h, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(h.path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(h.path, data, 0600)
+}
+
+// completePaths completes the input as a file path.
+func completePaths(_ Model, input string) (string, []string) {
+	return completePath(input)
+}
+
+// completePath completes a file path against the directory it names.
+func completePath(partial string) (string, []string) {
+	dir, base := filepath.Split(partial)
+	entries, err := os.ReadDir(filepath.Clean(dir + "."))
+	if err != nil {
+		return partial, nil
+	}
+	var matches []string
+	for _, e := range entries {
+		name := e.Name()
+		if !strings.HasPrefix(name, base) || (strings.HasPrefix(name, ".") && !strings.HasPrefix(base, ".")) {
+			continue
+		}
+		if e.IsDir() {
+			name += string(filepath.Separator)
+		}
+		matches = append(matches, name)
+	}
+	completed, candidates := completeFrom(base, matches)
+	return dir + completed, candidates
+}
+
+// completeBufferWords completes the last word of the input from the words
+// in the buffer.
+func completeBufferWords(m Model, input string) (string, []string) {
+	start := strings.LastIndexFunc(input, func(r rune) bool { return !isWordRune(r) }) + 1
+	prefix := input[start:]
+	if prefix == "" {
+		return input, nil
+	}
+
+	seen := make(map[string]bool)
+	var matches []string
+	for _, line := range m.textBuffer.GetLines() {
+		for _, word := range strings.FieldsFunc(line, func(r rune) bool { return !isWordRune(r) }) {
+			if len(word) > len(prefix) && strings.HasPrefix(word, prefix) && !seen[word] {
+				seen[word] = true
+				matches = append(matches, word)
+			}
+		}
+	}
+	sort.Strings(matches)
+	completed, candidates := completeFrom(prefix, matches)
+	return input[:start] + completed, candidates
+}
+
+// completeCommandNames completes the input as a registered command name.
+func completeCommandNames(_ Model, input string) (string, []string) {
+	var matches []string
+	for _, cmd := range commands.All() {
+		if strings.HasPrefix(cmd.Name, input) {
+			matches = append(matches, cmd.Name)
+		}
+	}
+	return completeFrom(input, matches)
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
+
+// completeFrom extends typed to the longest common prefix of matches and
+// returns the matches when more than one remains.
+func completeFrom(typed string, matches []string) (string, []string) {
+	if len(matches) == 0 {
+		return typed, nil
+	}
+	common := matches[0]
+	for _, m := range matches[1:] {
+		for !strings.HasPrefix(m, common) {
+			common = common[:len(common)-1]
+		}
+	}
+	if len(matches) == 1 {
+		return common, nil
+	}
+	return common, matches
+}
@@ -1,8 +1,15 @@
 package main
 
-import "github.com/charmbracelet/lipgloss"
+import (
+	"fmt"
+	"sort"
+	"strings"
 
-// Centralized Lipgloss styles. Keeping them in one place simplifies future theming.
+	"github.com/charmbracelet/lipgloss"
+)
+
+// Centralized Lipgloss styles. These are the built-in "gecko" theme; other
+// themes recolor them through colorSetters.
 var (
 	// Global UI elements
 	statusBarStyle = lipgloss.NewStyle().
@@ -96,4 +103,134 @@ var (
 
 	flashWarningStyle = lipgloss.NewStyle().
 				Foreground(lipgloss.Color("#e3e094"))
+
+	rulerStyle = lipgloss.NewStyle().
+			Background(lipgloss.Color("#3b3f51"))
+
+	vimModeStyle = lipgloss.NewStyle().
+			Bold(true)
 )
+
+// styleSet snapshots every configurable style so a config reload can start
+// from the built-in defaults.
+type styleSet struct {
+	statusBar, editor, lineNumber, selectedText, cursorLine lipgloss.Style
+	wordHighlight, cursor, helpBox, minibuffer              lipgloss.Style
+	minibufferPrompt, minibufferInput, ruler, modified      lipgloss.Style
+	helpTitle, helpKey, helpDesc, help                      lipgloss.Style
+	searchSelected, searchNormal                            lipgloss.Style
+	flashSuccess, flashError, flashWarning                  lipgloss.Style
+	minibufferCursor                                        lipgloss.Style
+}
+
+var defaultStyles = captureStyles()
+
+func captureStyles() styleSet {
+	return styleSet{
+		statusBar:        statusBarStyle,
+		editor:           editorStyle,
+		lineNumber:       lineNumberStyle,
+		selectedText:     selectedTextStyle,
+		cursorLine:       cursorLineStyle,
+		wordHighlight:    wordHighlightStyle,
+		cursor:           cursorStyle,
+		helpBox:          helpBoxStyle,
+		minibuffer:       minibufferStyle,
+		minibufferPrompt: minibufferPromptStyle,
+		minibufferInput:  minibufferInputStyle,
+		ruler:            rulerStyle,
+		modified:         modifiedStyle,
+		helpTitle:        helpTitleStyle,
+		helpKey:          helpKeyStyle,
+		helpDesc:         helpDescStyle,
+		help:             helpStyle,
+		searchSelected:   searchResultSelectedStyle,
+		searchNormal:     searchResultNormalStyle,
+		flashSuccess:     flashSuccessStyle,
+		flashError:       flashErrorStyle,
+		flashWarning:     flashWarningStyle,
+		minibufferCursor: minibufferCursorStyle,
+	}
+}
+
+// resetStyles restores the built-in styles.
+func resetStyles() {
+	s := defaultStyles
+	statusBarStyle = s.statusBar
+	editorStyle = s.editor
+	lineNumberStyle = s.lineNumber
+	selectedTextStyle = s.selectedText
+	cursorLineStyle = s.cursorLine
+	wordHighlightStyle = s.wordHighlight
+	cursorStyle = s.cursor
+	helpBoxStyle = s.helpBox
+	minibufferStyle = s.minibuffer
+	minibufferPromptStyle = s.minibufferPrompt
+	minibufferInputStyle = s.minibufferInput
+	rulerStyle = s.ruler
+	modifiedStyle = s.modified
+	helpTitleStyle = s.helpTitle
+	helpKeyStyle = s.helpKey
+	helpDescStyle = s.helpDesc
+	helpStyle = s.help
+	searchResultSelectedStyle = s.searchSelected
+	searchResultNormalStyle = s.searchNormal
+	flashSuccessStyle = s.flashSuccess
+	flashErrorStyle = s.flashError
+	flashWarningStyle = s.flashWarning
+	minibufferCursorStyle = s.minibufferCursor
+}
+
+// colorSetters maps the keys accepted in the config [colors] table to the
+// style attribute they recolor.
+var colorSetters = map[string]func(c lipgloss.Color){
+	"status_bar":      func(c lipgloss.Color) { statusBarStyle = statusBarStyle.Background(c) },
+	"status_bar_text": func(c lipgloss.Color) { statusBarStyle = statusBarStyle.Foreground(c) },
+	"border": func(c lipgloss.Color) {
+		editorStyle = editorStyle.BorderForeground(c)
+		helpBoxStyle = helpBoxStyle.BorderForeground(c)
+	},
+	"line_number":    func(c lipgloss.Color) { lineNumberStyle = lineNumberStyle.Foreground(c) },
+	"selection":      func(c lipgloss.Color) { selectedTextStyle = selectedTextStyle.Background(c) },
+	"selection_text": func(c lipgloss.Color) { selectedTextStyle = selectedTextStyle.Foreground(c) },
+	"cursor_line":    func(c lipgloss.Color) { cursorLineStyle = cursorLineStyle.Background(c) },
+	"word_highlight": func(c lipgloss.Color) { wordHighlightStyle = wordHighlightStyle.Background(c) },
+	"cursor":         func(c lipgloss.Color) { cursorStyle = cursorStyle.Background(c) },
+	"minibuffer":     func(c lipgloss.Color) { minibufferStyle = minibufferStyle.Background(c) },
+	"minibuffer_text": func(c lipgloss.Color) {
+		minibufferStyle = minibufferStyle.Foreground(c)
+		minibufferInputStyle = minibufferInputStyle.Foreground(c)
+		minibufferCursorStyle = minibufferCursorStyle.Background(c)
+	},
+	"prompt":                 func(c lipgloss.Color) { minibufferPromptStyle = minibufferPromptStyle.Foreground(c) },
+	"ruler":                  func(c lipgloss.Color) { rulerStyle = rulerStyle.Background(c) },
+	"modified":               func(c lipgloss.Color) { modifiedStyle = modifiedStyle.Foreground(c) },
+	"help_title":             func(c lipgloss.Color) { helpTitleStyle = helpTitleStyle.Foreground(c) },
+	"help_key":               func(c lipgloss.Color) { helpKeyStyle = helpKeyStyle.Foreground(c) },
+	"help_text":              func(c lipgloss.Color) { helpDescStyle = helpDescStyle.Foreground(c) },
+	"dim_text":               func(c lipgloss.Color) { helpStyle = helpStyle.Foreground(c) },
+	"search_result":          func(c lipgloss.Color) { searchResultNormalStyle = searchResultNormalStyle.Foreground(c) },
+	"search_result_selected": func(c lipgloss.Color) { searchResultSelectedStyle = searchResultSelectedStyle.Background(c) },
+	"flash_success":          func(c lipgloss.Color) { flashSuccessStyle = flashSuccessStyle.Foreground(c) },
+	"flash_error":            func(c lipgloss.Color) { flashErrorStyle = flashErrorStyle.Foreground(c) },
+	"flash_warning":          func(c lipgloss.Color) { flashWarningStyle = flashWarningStyle.Foreground(c) },
+}
+
+// applyColorOverrides recolors styles from the config [colors] table. Unknown
+// keys are reported but do not stop the remaining overrides from applying.
+func applyColorOverrides(colors map[string]string) error {
+	var unknown []string
+	for name, value := range colors {
+		setter, ok := colorSetters[name]
+		if !ok {
+			unknown = append(unknown, name)
+			continue
+		}
+		setter(lipgloss.Color(value))
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return fmt.Errorf("unknown color keys: %s", strings.Join(unknown, ", "))
+	}
+	return nil
+}
@@ -30,19 +30,19 @@ type Highlighter struct {
 	maxCache  int
 }
 
-func NewHighlighter(filename string) *Highlighter {
+func NewHighlighter(filename, styleName string) *Highlighter {
 	lexer := lexers.Match(filename)
 	if lexer == nil {
 		lexer = lexers.Fallback
 	}
 	lexer = chroma.Coalesce(lexer)
 
-	style := styles.Get("doom-one")
+	style := styles.Get(styleName)
 	if style == nil {
 		style = styles.Fallback
 	}
 
-	formatter := formatters.Get("terminal256")
+	formatter := formatters.Get(colorMode.chromaFormatter())
 	if formatter == nil {
 		formatter = formatters.Fallback
 	}
@@ -56,6 +56,11 @@ func NewHighlighter(filename string) *Highlighter {
 	}
 }
 
+// LexerName returns the name of the chroma lexer selected for the file
+func (h *Highlighter) LexerName() string {
+	return h.lexer.Config().Name
+}
+
 // Highlight highlights the entire content (legacy method for compatibility)
 func (h *Highlighter) Highlight(content string) (string, error) {
 	iterator, err := h.lexer.Tokenise(nil, content)
@@ -78,7 +83,7 @@ func (h *Highlighter) HighlightLines(ctx context.Context, lines []string, startL
 	if len(lines) == 0 {
 		return []string{}, nil
 	}
-	
+
 	// Clamp startLine to valid range
 	if startLine < 0 {
 		startLine = 0
@@ -86,7 +91,7 @@ func (h *Highlighter) HighlightLines(ctx context.Context, lines []string, startL
 	if startLine >= len(lines) {
 		startLine = len(lines) - 1
 	}
-	
+
 	// Clamp endLine to valid range
 	if endLine < 0 {
 		endLine = 0
@@ -94,7 +99,7 @@ func (h *Highlighter) HighlightLines(ctx context.Context, lines []string, startL
 	if endLine >= len(lines) {
 		endLine = len(lines) - 1
 	}
-	
+
 	// Ensure startLine <= endLine
 	if startLine > endLine {
 		startLine, endLine = endLine, startLine
@@ -102,7 +107,7 @@ func (h *Highlighter) HighlightLines(ctx context.Context, lines []string, startL
 
 	// Create cache key based on line range and content hash
 	cacheKey := h.createCacheKey(lines, startLine, endLine)
-	
+
 	h.mu.RLock()
 	if cached, exists := h.cache[cacheKey]; exists {
 		// Check if cache is still valid (within 5 seconds)
@@ -114,7 +119,7 @@ func (h *Highlighter) HighlightLines(ctx context.Context, lines []string, startL
 	h.mu.RUnlock()
 
 	// Extract the range of lines to highlight
-	lineRange := lines[startLine:endLine+1]
+	lineRange := lines[startLine : endLine+1]
 	content := strings.Join(lineRange, "\n")
 
 	// Highlight the content
@@ -161,7 +166,7 @@ func (h *Highlighter) createCacheKey(lines []string, startLine, endLine int) str
 	keyBuilder.WriteString("-")
 	keyBuilder.WriteString(strconv.Itoa(endLine))
 	keyBuilder.WriteString(":")
-	
+
 	// Add a hash of the content for cache invalidation
 	for i := startLine; i <= endLine && i < len(lines); i++ {
 		if i > startLine {
@@ -169,7 +174,7 @@ func (h *Highlighter) createCacheKey(lines []string, startLine, endLine int) str
 		}
 		keyBuilder.WriteString(lines[i])
 	}
-	
+
 	return keyBuilder.String()
 }
 
@@ -215,6 +220,19 @@ func (h *Highlighter) cleanOldEntries() {
 	}
 }
 
+// SetStyle switches the chroma style, keeping the lexer, and drops the lines
+// highlighted with the old one
+func (h *Highlighter) SetStyle(styleName string) {
+	style := styles.Get(styleName)
+	if style == nil {
+		style = styles.Fallback
+	}
+	h.mu.Lock()
+	h.style = style
+	h.mu.Unlock()
+	h.ClearCache()
+}
+
 // ClearCache clears the highlighting cache
 func (h *Highlighter) ClearCache() {
 	h.mu.Lock()
@@ -236,15 +254,15 @@ func (m *Model) applySyntaxHighlighting() {
 
 	// Calculate visible line range with buffer
 	visibleStart, visibleEnd := m.calculateVisibleRange()
-	
+
 	// Additional safety check to ensure bounds are valid
 	if visibleStart < 0 || visibleEnd >= len(lines) || visibleStart > visibleEnd {
 		slog.Warn("Invalid visible range calculated", "start", visibleStart, "end", visibleEnd, "totalLines", len(lines))
 		return
 	}
-	
+
 	// Use context with timeout to prevent hanging
-	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), m.config.HighlightTimeout())
 	defer cancel()
 
 	// Highlight only the visible range
@@ -266,12 +284,12 @@ func (m *Model) calculateVisibleRange() (start, end int) {
 	}
 
 	// Calculate visible area with buffer for smooth scrolling
-	bufferSize := 10 // Lines to highlight beyond visible area
+	bufferSize := 10               // Lines to highlight beyond visible area
 	viewportHeight := m.height - 2 // Account for status bar
-	
+
 	start = max(0, m.viewportY-bufferSize)
 	end = min(totalLines-1, m.viewportY+viewportHeight+bufferSize)
-	
+
 	// Ensure start <= end and both are within valid bounds
 	if start >= totalLines {
 		start = totalLines - 1
@@ -282,7 +300,7 @@ func (m *Model) calculateVisibleRange() (start, end int) {
 	if start > end {
 		start = end
 	}
-	
+
 	return start, end
 }
 
@@ -309,4 +327,4 @@ func (m *Model) invalidateHighlightCache() {
 	if m.highlighter != nil {
 		m.highlighter.ClearCache()
 	}
-}
\ No newline at end of file
+}
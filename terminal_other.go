@@ -0,0 +1,10 @@
+//go:build !windows
+
+package main
+
+// enableWindowsANSI is a no-op outside Windows, where terminals already
+// process ANSI escape sequences.
+func enableWindowsANSI() {}
+
+// ensureUTF8Output is a no-op outside Windows.
+func ensureUTF8Output() {}
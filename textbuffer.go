@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"log/slog"
 	"strings"
 	"sync"
 	"unicode"
@@ -68,7 +69,7 @@ func NewGapBuffer(content string) *GapBuffer {
 	gapSize := max(len(runes), 256) // Initial gap size
 	buffer := make([]rune, len(runes)+gapSize)
 	copy(buffer, runes)
-	
+
 	return &GapBuffer{
 		buffer:   buffer,
 		gapStart: len(runes),
@@ -97,12 +98,12 @@ func (gb *GapBuffer) moveGapTo(pos int) {
 func (gb *GapBuffer) Insert(pos int, text string) {
 	runes := []rune(text)
 	gb.moveGapTo(pos)
-	
+
 	// Expand gap if necessary
 	if len(runes) > gb.gapEnd-gb.gapStart {
 		gb.expandGap(len(runes))
 	}
-	
+
 	copy(gb.buffer[gb.gapStart:], runes)
 	gb.gapStart += len(runes)
 }
@@ -112,7 +113,7 @@ func (gb *GapBuffer) Delete(start, end int) {
 	if start > end {
 		start, end = end, start
 	}
-	
+
 	// Bounds checking
 	if start < 0 {
 		start = 0
@@ -123,10 +124,10 @@ func (gb *GapBuffer) Delete(start, end int) {
 	if start >= end {
 		return // Nothing to delete
 	}
-	
+
 	// Move gap to start position
 	gb.moveGapTo(start)
-	
+
 	// Expand the gap to include the deleted range
 	gb.gapEnd += end - start
 }
@@ -135,13 +136,13 @@ func (gb *GapBuffer) Delete(start, end int) {
 func (gb *GapBuffer) expandGap(minSize int) {
 	newGapSize := max(minSize*2, 256)
 	newBuffer := make([]rune, len(gb.buffer)+newGapSize)
-	
+
 	// Copy text before gap
 	copy(newBuffer, gb.buffer[:gb.gapStart])
-	
+
 	// Copy text after gap
 	copy(newBuffer[gb.gapStart+newGapSize:], gb.buffer[gb.gapEnd:])
-	
+
 	gb.buffer = newBuffer
 	gb.gapEnd = gb.gapStart + newGapSize
 }
@@ -164,13 +165,20 @@ type TextBuffer struct {
 	lines                   []string
 	cursor                  Position
 	selection               *Selection
+	carets                  []Caret // secondary cursors, see ForEachCaret
+	block                   *Block
+	blockCursor             Position // where SetBlock put the cursor
 	history                 []TextState
-	historyIndex            int
+	historyIndex            int // the current state in history, len(history) after an edit
 	maxHistory              int
 	selectAllOriginalCursor *Position
+	// undoGroup counts open undo groups; while one is open only the first
+	// edit records an undo state, so the whole group undoes at once.
+	undoGroup      int
+	undoGroupSaved bool
 	// Performance optimization: cache frequently accessed data
-	lastLineCount           int
-	lastContentHash         uint64
+	lastLineCount   int
+	lastContentHash uint64
 }
 
 type TextState struct {
@@ -193,7 +201,6 @@ func NewTextBuffer(content string) *TextBuffer {
 
 	// Calculate content hash after initialization
 	tb.lastContentHash = tb.calculateContentHash(lines)
-	tb.saveState()
 	return tb
 }
 
@@ -204,7 +211,7 @@ func (tb *TextBuffer) calculateContentHash(lines []string) uint64 {
 		// Hash first 100, middle 100, and last 100 lines for large files
 		return tb.calculatePartialHash(lines)
 	}
-	
+
 	var hash uint64 = 5381
 	for _, line := range lines {
 		for _, char := range line {
@@ -219,7 +226,7 @@ func (tb *TextBuffer) calculateContentHash(lines []string) uint64 {
 func (tb *TextBuffer) calculatePartialHash(lines []string) uint64 {
 	var hash uint64 = 5381
 	totalLines := len(lines)
-	
+
 	// Hash first 100 lines
 	for i := 0; i < min(100, totalLines); i++ {
 		for _, char := range lines[i] {
@@ -227,7 +234,7 @@ func (tb *TextBuffer) calculatePartialHash(lines []string) uint64 {
 		}
 		hash = ((hash << 5) + hash) + uint64('\n')
 	}
-	
+
 	// Hash middle 100 lines
 	midStart := max(100, totalLines/2-50)
 	midEnd := min(totalLines, midStart+100)
@@ -237,7 +244,7 @@ func (tb *TextBuffer) calculatePartialHash(lines []string) uint64 {
 		}
 		hash = ((hash << 5) + hash) + uint64('\n')
 	}
-	
+
 	// Hash last 100 lines
 	lastStart := max(midEnd, totalLines-100)
 	for i := lastStart; i < totalLines; i++ {
@@ -246,7 +253,7 @@ func (tb *TextBuffer) calculatePartialHash(lines []string) uint64 {
 		}
 		hash = ((hash << 5) + hash) + uint64('\n')
 	}
-	
+
 	// Include total line count in hash to detect structural changes
 	hash = ((hash << 5) + hash) + uint64(totalLines)
 	return hash
@@ -276,6 +283,69 @@ func (tb *TextBuffer) getLineLength(lineIdx int) int {
 	return len(tb.lines[lineIdx])
 }
 
+// SetMaxHistory sets how many undo states are kept, trimming older ones.
+func (tb *TextBuffer) SetMaxHistory(n int) {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	if n <= 0 {
+		return
+	}
+	tb.maxHistory = n
+	for len(tb.history) > tb.maxHistory {
+		tb.history = tb.history[1:]
+		tb.historyIndex--
+	}
+	if tb.historyIndex < 0 {
+		tb.historyIndex = 0
+	}
+}
+
+// SetContent replaces the whole buffer as a single undoable edit, keeping the
+// cursor as close as possible to where it was.
+func (tb *TextBuffer) SetContent(content string) {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+
+	tb.saveState()
+	tb.lines = strings.Split(content, "\n")
+	tb.selection = nil
+	tb.carets = nil
+	tb.block = nil
+	tb.selectAllOriginalCursor = nil
+	tb.cursor = tb.clampPosition(tb.cursor)
+
+	tb.lastLineCount = len(tb.lines)
+	tb.lastContentHash = tb.calculateContentHash(tb.lines)
+}
+
+// ReplaceLines replaces lines start through end (inclusive) with newLines as
+// a single undoable edit and moves the cursor to the start of the range.
+func (tb *TextBuffer) ReplaceLines(start, end int, newLines []string) {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+
+	start = tb.clampLine(start)
+	end = max(tb.clampLine(end), start)
+
+	tb.saveState()
+	lines := make([]string, 0, len(tb.lines)-(end-start+1)+len(newLines))
+	lines = append(lines, tb.lines[:start]...)
+	lines = append(lines, newLines...)
+	lines = append(lines, tb.lines[end+1:]...)
+	if len(lines) == 0 {
+		lines = []string{""}
+	}
+	tb.lines = lines
+	tb.selection = nil
+	tb.carets = nil
+	tb.block = nil
+	tb.selectAllOriginalCursor = nil
+	tb.cursor = tb.clampPosition(Position{Line: start})
+
+	tb.lastLineCount = len(tb.lines)
+	tb.lastContentHash = tb.calculateContentHash(tb.lines)
+}
+
 func (tb *TextBuffer) GetContent() string {
 	tb.mu.RLock()
 	defer tb.mu.RUnlock()
@@ -294,7 +364,7 @@ func (tb *TextBuffer) GetLines() []string {
 func (tb *TextBuffer) GetLinesRange(start, end int) []string {
 	tb.mu.RLock()
 	defer tb.mu.RUnlock()
-	
+
 	if start < 0 {
 		start = 0
 	}
@@ -304,7 +374,7 @@ func (tb *TextBuffer) GetLinesRange(start, end int) []string {
 	if start >= end {
 		return []string{}
 	}
-	
+
 	lines := make([]string, end-start)
 	copy(lines, tb.lines[start:end])
 	return lines
@@ -321,7 +391,7 @@ func (tb *TextBuffer) GetLineCount() int {
 func (tb *TextBuffer) GetLine(lineIdx int) string {
 	tb.mu.RLock()
 	defer tb.mu.RUnlock()
-	
+
 	if lineIdx < 0 || lineIdx >= len(tb.lines) {
 		return ""
 	}
@@ -524,7 +594,7 @@ func (tb *TextBuffer) SelectWord() {
 	if tb.cursor.Line >= len(tb.lines) {
 		return
 	}
-	start, end := tb.GetWordBoundsAtCursor()
+	start, end := tb.wordBoundsAtCursor()
 	if start == end {
 		return
 	}
@@ -672,25 +742,25 @@ func (tb *TextBuffer) insertLinesEfficient(insertAt int, newLines []string, suff
 	if len(newLines) == 0 {
 		return
 	}
-	
+
 	// Create new slice with enough capacity
 	totalLines := len(tb.lines) + len(newLines)
 	newSlice := make([]string, 0, totalLines)
-	
+
 	// Copy lines before insertion point
 	newSlice = append(newSlice, tb.lines[:insertAt]...)
-	
+
 	// Add new lines
 	newSlice = append(newSlice, newLines...)
-	
+
 	// Add suffix to the last inserted line
 	if len(newLines) > 0 {
 		newSlice[insertAt+len(newLines)-1] += suffix
 	}
-	
+
 	// Copy lines after insertion point
 	newSlice = append(newSlice, tb.lines[insertAt:]...)
-	
+
 	tb.lines = newSlice
 }
 
@@ -704,7 +774,7 @@ func (tb *TextBuffer) DeleteSelection() bool {
 	tb.saveState()
 	tb.selectAllOriginalCursor = nil
 	if err := tb.deleteSelection(); err != nil {
-		// Log error but don't fail the operation
+		slog.Warn("deleting selection failed", "error", err)
 		return false
 	}
 	return true
@@ -777,36 +847,54 @@ func (tb *TextBuffer) DeleteChar(backward bool) error {
 	return nil
 }
 
+// Undo restores the state before the last edit. The first Undo after an edit
+// records the current state so Redo can return to it.
 func (tb *TextBuffer) Undo() bool {
 	tb.mu.Lock()
 	defer tb.mu.Unlock()
-	if tb.historyIndex > 0 {
-		tb.historyIndex--
-		state := tb.history[tb.historyIndex]
-		tb.lines = make([]string, len(state.Lines))
-		copy(tb.lines, state.Lines)
-		tb.cursor = state.Cursor
-		tb.selection = nil
-		tb.selectAllOriginalCursor = nil
-		return true
+	if tb.historyIndex == 0 {
+		return false
+	}
+	if tb.historyIndex == len(tb.history) {
+		tb.history = append(tb.history, tb.snapshot())
 	}
-	return false
+	tb.historyIndex--
+	tb.restore(tb.history[tb.historyIndex])
+	return true
 }
 
 func (tb *TextBuffer) Redo() bool {
 	tb.mu.Lock()
 	defer tb.mu.Unlock()
-	if tb.historyIndex < len(tb.history)-1 {
-		tb.historyIndex++
-		state := tb.history[tb.historyIndex]
-		tb.lines = make([]string, len(state.Lines))
-		copy(tb.lines, state.Lines)
-		tb.cursor = state.Cursor
-		tb.selection = nil
-		tb.selectAllOriginalCursor = nil
-		return true
+	if tb.historyIndex >= len(tb.history)-1 {
+		return false
+	}
+	tb.historyIndex++
+	tb.restore(tb.history[tb.historyIndex])
+	return true
+}
+
+func (tb *TextBuffer) snapshot() TextState {
+	state := TextState{
+		Lines:  make([]string, len(tb.lines)),
+		Cursor: tb.cursor,
 	}
-	return false
+	copy(state.Lines, tb.lines)
+	return state
+}
+
+func (tb *TextBuffer) restore(state TextState) {
+	tb.lines = make([]string, len(state.Lines))
+	copy(tb.lines, state.Lines)
+	tb.cursor = state.Cursor
+	tb.selection = nil
+	tb.carets = nil
+	tb.block = nil
+	tb.selectAllOriginalCursor = nil
+	tb.lastLineCount = len(tb.lines)
+	tb.lastContentHash = tb.calculateContentHash(tb.lines)
+	// Edits after an undo inside an open group start a new step
+	tb.undoGroupSaved = false
 }
 
 func (tb *TextBuffer) GoToLine(line int) {
@@ -1010,6 +1098,11 @@ func (tb *TextBuffer) findPrevWordBoundary(pos Position) Position {
 func (tb *TextBuffer) GetWordBoundsAtCursor() (int, int) {
 	tb.mu.RLock()
 	defer tb.mu.RUnlock()
+	return tb.wordBoundsAtCursor()
+}
+
+// wordBoundsAtCursor is GetWordBoundsAtCursor for callers holding the lock.
+func (tb *TextBuffer) wordBoundsAtCursor() (int, int) {
 	if len(tb.lines) == 0 {
 		return -1, -1
 	}
@@ -1058,19 +1151,33 @@ func isWordBoundary(ch byte) bool {
 		ch == '^' || ch == '~' || ch == '`'
 }
 
-func (tb *TextBuffer) saveState() {
-	if tb.historyIndex < len(tb.history)-1 {
-		tb.history = tb.history[:tb.historyIndex+1]
+// BeginUndoGroup starts collecting edits into a single undo step. Groups
+// nest; the step ends with the outermost EndUndoGroup.
+func (tb *TextBuffer) BeginUndoGroup() {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	if tb.undoGroup == 0 {
+		tb.undoGroupSaved = false
 	}
+	tb.undoGroup++
+}
 
-	state := TextState{
-		Lines:  make([]string, len(tb.lines)),
-		Cursor: tb.cursor,
-	}
-	copy(state.Lines, tb.lines)
+func (tb *TextBuffer) EndUndoGroup() {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	tb.undoGroup = max(tb.undoGroup-1, 0)
+}
 
-	tb.history = append(tb.history, state)
-	tb.historyIndex = len(tb.history) - 1
+func (tb *TextBuffer) saveState() {
+	if tb.undoGroup > 0 {
+		if tb.undoGroupSaved {
+			return
+		}
+		tb.undoGroupSaved = true
+	}
+	// A new edit discards the states that could be redone
+	tb.history = append(tb.history[:tb.historyIndex], tb.snapshot())
+	tb.historyIndex = len(tb.history)
 
 	if len(tb.history) > tb.maxHistory {
 		tb.history = tb.history[1:]
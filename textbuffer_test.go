@@ -0,0 +1,66 @@
+package main
+
+import "testing"
+
+func TestUndoRedo(t *testing.T) {
+	tb := NewTextBuffer("a")
+	if tb.Undo() {
+		t.Fatal("Undo on a fresh buffer reported a change")
+	}
+	tb.SetCursor(Position{Column: 1})
+	for _, s := range []string{"b", "c"} {
+		if err := tb.InsertText(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	steps := []struct {
+		op   func() bool
+		ok   bool
+		want string
+	}{
+		{tb.Undo, true, "ab"},
+		{tb.Undo, true, "a"},
+		{tb.Undo, false, "a"},
+		{tb.Redo, true, "ab"},
+		{tb.Redo, true, "abc"},
+		{tb.Redo, false, "abc"},
+		{tb.Undo, true, "ab"},
+	}
+	for i, step := range steps {
+		if ok := step.op(); ok != step.ok || tb.GetContent() != step.want {
+			t.Fatalf("step %d: got %q (%v), want %q (%v)", i, tb.GetContent(), ok, step.want, step.ok)
+		}
+	}
+
+	// An edit after undoing discards the redo states
+	if err := tb.InsertText("d"); err != nil {
+		t.Fatal(err)
+	}
+	if tb.Redo() {
+		t.Fatal("Redo after a new edit reported a change")
+	}
+	if !tb.Undo() || tb.GetContent() != "ab" {
+		t.Fatalf("got %q, want %q", tb.GetContent(), "ab")
+	}
+}
+
+func TestUndoGroup(t *testing.T) {
+	tb := NewTextBuffer("")
+	if err := tb.InsertText("x"); err != nil {
+		t.Fatal(err)
+	}
+	tb.BeginUndoGroup()
+	for _, s := range []string{"1", "2", "3"} {
+		if err := tb.InsertText(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tb.EndUndoGroup()
+	if !tb.Undo() || tb.GetContent() != "x" {
+		t.Fatalf("got %q, want %q", tb.GetContent(), "x")
+	}
+	if !tb.Redo() || tb.GetContent() != "x123" {
+		t.Fatalf("got %q, want %q", tb.GetContent(), "x123")
+	}
+}
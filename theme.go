@@ -0,0 +1,327 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+const (
+	defaultTheme  = "gecko"
+	themesDirName = "themes"
+)
+
+// Theme pairs a UI palette with a chroma style so the editor chrome and the
+// code colors match. Colors use the same keys as the config [colors] table.
+type Theme struct {
+	Name   string            `json:"name" toml:"name"`
+	Syntax string            `json:"syntax" toml:"syntax"`
+	Colors map[string]string `json:"colors" toml:"colors"`
+
+	// path is the file a user theme was loaded from, empty for built-ins.
+	path string
+}
+
+// builtinThemes are always available. The gecko theme is the default look
+// defined in styles.go.
+var builtinThemes = []Theme{
+	{Name: "gecko", Syntax: defaultStyle},
+	{Name: "dracula", Syntax: "dracula", Colors: map[string]string{
+		"status_bar": "#bd93f9", "status_bar_text": "#282a36", "border": "#6272a4",
+		"line_number": "#6272a4", "selection": "#44475a", "selection_text": "#f8f8f2",
+		"cursor_line": "#343746", "word_highlight": "#424450", "cursor": "#f8f8f2",
+		"minibuffer": "#44475a", "minibuffer_text": "#f8f8f2", "prompt": "#8be9fd",
+		"ruler": "#3a3c4e", "modified": "#ff5555", "help_title": "#bd93f9",
+		"help_key": "#8be9fd", "help_text": "#f8f8f2", "dim_text": "#6272a4",
+		"search_result": "#50fa7b", "search_result_selected": "#ff79c6",
+		"flash_success": "#50fa7b", "flash_error": "#ff5555", "flash_warning": "#f1fa8c",
+	}},
+	{Name: "nord", Syntax: "nord", Colors: map[string]string{
+		"status_bar": "#5e81ac", "status_bar_text": "#eceff4", "border": "#4c566a",
+		"line_number": "#4c566a", "selection": "#434c5e", "selection_text": "#eceff4",
+		"cursor_line": "#3b4252", "word_highlight": "#434c5e", "cursor": "#d8dee9",
+		"minibuffer": "#3b4252", "minibuffer_text": "#e5e9f0", "prompt": "#88c0d0",
+		"ruler": "#3b4252", "modified": "#bf616a", "help_title": "#88c0d0",
+		"help_key": "#81a1c1", "help_text": "#e5e9f0", "dim_text": "#4c566a",
+		"search_result": "#8fbcbb", "search_result_selected": "#b48ead",
+		"flash_success": "#a3be8c", "flash_error": "#bf616a", "flash_warning": "#ebcb8b",
+	}},
+	{Name: "gruvbox", Syntax: "gruvbox", Colors: map[string]string{
+		"status_bar": "#504945", "status_bar_text": "#ebdbb2", "border": "#665c54",
+		"line_number": "#7c6f64", "selection": "#504945", "selection_text": "#fbf1c7",
+		"cursor_line": "#32302f", "word_highlight": "#3c3836", "cursor": "#ebdbb2",
+		"minibuffer": "#3c3836", "minibuffer_text": "#ebdbb2", "prompt": "#fabd2f",
+		"ruler": "#3c3836", "modified": "#fb4934", "help_title": "#fe8019",
+		"help_key": "#83a598", "help_text": "#ebdbb2", "dim_text": "#928374",
+		"search_result": "#8ec07c", "search_result_selected": "#d3869b",
+		"flash_success": "#b8bb26", "flash_error": "#fb4934", "flash_warning": "#fabd2f",
+	}},
+	{Name: "catppuccin", Syntax: "catppuccin-mocha", Colors: map[string]string{
+		"status_bar": "#89b4fa", "status_bar_text": "#1e1e2e", "border": "#45475a",
+		"line_number": "#6c7086", "selection": "#45475a", "selection_text": "#cdd6f4",
+		"cursor_line": "#2a2b3c", "word_highlight": "#313244", "cursor": "#f5e0dc",
+		"minibuffer": "#313244", "minibuffer_text": "#cdd6f4", "prompt": "#cba6f7",
+		"ruler": "#313244", "modified": "#f38ba8", "help_title": "#cba6f7",
+		"help_key": "#89b4fa", "help_text": "#cdd6f4", "dim_text": "#6c7086",
+		"search_result": "#94e2d5", "search_result_selected": "#cba6f7",
+		"flash_success": "#a6e3a1", "flash_error": "#f38ba8", "flash_warning": "#f9e2af",
+	}},
+	{Name: "github-light", Syntax: "github", Colors: map[string]string{
+		"status_bar": "#0366d6", "status_bar_text": "#ffffff", "border": "#d1d5da",
+		"line_number": "#959da5", "selection": "#c8e1ff", "selection_text": "#24292e",
+		"cursor_line": "#f6f8fa", "word_highlight": "#fffbdd", "cursor": "#24292e",
+		"minibuffer": "#f6f8fa", "minibuffer_text": "#24292e", "prompt": "#0366d6",
+		"ruler": "#eaecef", "modified": "#d73a49", "help_title": "#0366d6",
+		"help_key": "#6f42c1", "help_text": "#24292e", "dim_text": "#6a737d",
+		"search_result": "#22863a", "search_result_selected": "#79b8ff",
+		"flash_success": "#22863a", "flash_error": "#d73a49", "flash_warning": "#b08800",
+	}},
+}
+
+// themes holds the built-in and user themes by name. User themes are reread
+// whenever the config is applied.
+var themes = indexThemes(builtinThemes)
+
+func indexThemes(list []Theme) map[string]Theme {
+	byName := make(map[string]Theme, len(list))
+	for _, t := range list {
+		byName[t.Name] = t
+	}
+	return byName
+}
+
+// themeNames lists the available themes, built-ins first in their defined
+// order and then user themes alphabetically.
+func themeNames() []string {
+	var names, user []string
+	for _, t := range builtinThemes {
+		if themes[t.Name].path == "" {
+			names = append(names, t.Name)
+		}
+	}
+	for name, t := range themes {
+		if t.path != "" {
+			user = append(user, name)
+		}
+	}
+	sort.Strings(user)
+	return append(names, user...)
+}
+
+// loadUserThemes reads every .toml and .json file in the themes directory
+// under the config directory. A user theme with a built-in's name replaces it.
+func loadUserThemes() []string {
+	themes = indexThemes(builtinThemes)
+	dir, err := configDir()
+	if err != nil {
+		return nil
+	}
+	entries, err := os.ReadDir(filepath.Join(dir, themesDirName))
+	if err != nil {
+		return nil
+	}
+
+	var warnings []string
+	for _, e := range entries {
+		ext := strings.ToLower(filepath.Ext(e.Name()))
+		if e.IsDir() || (ext != ".toml" && ext != ".json") {
+			continue
+		}
+		t, err := loadThemeFile(filepath.Join(dir, themesDirName, e.Name()))
+		if err != nil {
+			warnings = append(warnings, err.Error())
+			continue
+		}
+		themes[t.Name] = t
+	}
+	return warnings
+}
+
+func loadThemeFile(path string) (Theme, error) {
+	var t Theme
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return t, fmt.Errorf("reading theme: %w", err)
+	}
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		err = json.Unmarshal(data, &t)
+	} else {
+		_, err = toml.Decode(string(data), &t)
+	}
+	if err != nil {
+		return t, fmt.Errorf("parsing theme %s: %w", filepath.Base(path), err)
+	}
+	if t.Name == "" {
+		t.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	if t.Syntax == "" {
+		t.Syntax = defaultStyle
+	}
+	t.path = path
+	return t, nil
+}
+
+// applyTheme recolors the UI with the theme, then the config [colors]
+// overrides, and re-highlights the buffer with the theme's chroma style
+// unless the config names one explicitly. It only restyles: the lexer and the
+// buffer's settings stay as they are, so previews in the picker are cheap and
+// keep an indentation converted by hand.
+func (m *Model) applyTheme(t Theme) error {
+	resetStyles()
+	m.theme = t
+	var errs []string
+	if err := applyColorOverrides(t.Colors); err != nil {
+		errs = append(errs, fmt.Sprintf("theme %s: %v", t.Name, err))
+	}
+	if err := applyColorOverrides(m.config.Colors); err != nil {
+		errs = append(errs, err.Error())
+	}
+	if colorMode == ColorNone {
+		applyMonochromeStyles()
+	}
+	if m.highlighter != nil {
+		m.highlighter.SetStyle(m.syntaxStyle())
+		m.highlightedLines = nil
+		m.applySyntaxHighlighting()
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// syntaxStyle is the chroma style for the buffer: the config style when set,
+// otherwise the theme's.
+func (m Model) syntaxStyle() string {
+	if m.config.Style != "" {
+		return m.config.Style
+	}
+	return m.theme.Syntax
+}
+
+func handleThemePicker(m Model, _ tea.KeyMsg) (tea.Model, tea.Cmd) {
+	m.minibufferType = MinibufferThemePicker
+	m.minibufferInput = ""
+	m.minibufferCursorPos = 0
+	m.themeBefore = m.theme
+	m.paletteIndex = 0
+	m.paletteOffset = 0
+	for i, name := range m.themeMatches() {
+		if name == m.theme.Name {
+			m.movePickerSelection(i)
+		}
+	}
+	return m, nil
+}
+
+// themeMatches filters the theme names by the picker input.
+func (m Model) themeMatches() []string {
+	var matches []string
+	for _, name := range themeNames() {
+		if _, ok := fuzzyScore(m.minibufferInput, name); ok {
+			matches = append(matches, name)
+		}
+	}
+	return matches
+}
+
+// handleThemePickerInput previews the highlighted theme as the selection
+// moves. Enter keeps it and Escape restores the theme the picker opened with.
+func (m Model) handleThemePickerInput(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.Type {
+	case tea.KeyEscape:
+		m.minibufferType = MinibufferNone
+		m.minibufferInput = ""
+		m.minibufferCursorPos = 0
+		if err := m.applyTheme(m.themeBefore); err != nil {
+			m.notify(MessageWarning, err.Error())
+		}
+		return m, nil
+	case tea.KeyEnter:
+		m.minibufferType = MinibufferNone
+		m.minibufferInput = ""
+		m.minibufferCursorPos = 0
+		m.notifyf(MessageSuccess, "Theme %s (set theme = %q in the config to keep it)", m.theme.Name, m.theme.Name)
+		return m, nil
+	case tea.KeyUp:
+		m.movePickerSelection(-1)
+	case tea.KeyDown:
+		m.movePickerSelection(1)
+	case tea.KeyRunes, tea.KeySpace:
+		next, _ := handleTextInput(m, msg)
+		m = next.(Model)
+		m.paletteIndex, m.paletteOffset = 0, 0
+	default:
+		next, _ := handleEditingKeys(m, msg)
+		m = next.(Model)
+		m.paletteIndex, m.paletteOffset = 0, 0
+	}
+
+	if matches := m.themeMatches(); m.paletteIndex < len(matches) && matches[m.paletteIndex] != m.theme.Name {
+		if err := m.applyTheme(themes[matches[m.paletteIndex]]); err != nil {
+			m.notify(MessageWarning, err.Error())
+		}
+	}
+	return m, nil
+}
+
+// movePickerSelection moves the theme or clipboard picker selection,
+// wrapping at the ends.
+func (m *Model) movePickerSelection(delta int) {
+	count := len(m.themeMatches())
+	if m.minibufferType == MinibufferClipboardHistory {
+		count = len(m.clipboardItems())
+	}
+	if count == 0 {
+		return
+	}
+	m.paletteIndex = (m.paletteIndex + delta + count) % count
+	if m.paletteIndex < m.paletteOffset {
+		m.paletteOffset = m.paletteIndex
+	} else if m.paletteIndex >= m.paletteOffset+m.maxResultsDisplay {
+		m.paletteOffset = m.paletteIndex - m.maxResultsDisplay + 1
+	}
+}
+
+func (m Model) getThemePickerHeight() int {
+	rows := min(len(m.themeMatches()), m.maxResultsDisplay)
+	return 1 + max(rows, 1)
+}
+
+func (m Model) renderThemePickerMinibuffer() string {
+	var lines []string
+
+	input := renderMinibufferInput(m.minibufferInput, m.minibufferCursorPos)
+	lines = append(lines, minibufferPromptStyle.Render("Theme: ")+minibufferInputStyle.Render(input))
+
+	matches := m.themeMatches()
+	if len(matches) == 0 {
+		lines = append(lines, helpStyle.Render("  No matching themes"))
+	}
+
+	end := min(m.paletteOffset+m.maxResultsDisplay, len(matches))
+	for i := m.paletteOffset; i < end; i++ {
+		t := themes[matches[i]]
+		source := "built-in"
+		if t.path != "" {
+			source = t.path
+		}
+		row := "  " + lipgloss.NewStyle().Width(24).Render(t.Name) +
+			lipgloss.NewStyle().Width(20).Render(t.Syntax) + source
+		if i == m.paletteIndex {
+			row = searchResultSelectedStyle.Render(row)
+		} else {
+			row = searchResultNormalStyle.Render(row)
+		}
+		lines = append(lines, row)
+	}
+
+	return minibufferStyle.Width(m.width - 2).Render(strings.Join(lines, "\n"))
+}
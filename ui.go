@@ -2,13 +2,24 @@ package main
 
 import (
 	"fmt"
+	"sort"
 	"strings"
-	"time"
+	"unicode/utf8"
 
 	"github.com/charmbracelet/lipgloss"
 )
 
 func (m Model) View() string {
+	if colorMode == ColorNone {
+		return stripColors(m.view())
+	}
+	return m.view()
+}
+
+func (m Model) view() string {
+	if m.viewer != nil {
+		return m.renderViewer()
+	}
 	baseView := m.renderEditor()
 	if m.showHelp {
 		helpView := m.renderHelp()
@@ -44,6 +55,13 @@ func (m Model) renderEditor() string {
 	statusBar := m.renderStatusBar()
 
 	// Ensure editor and status bar share exact width constraints
+	if m.showWhichKey {
+		return lipgloss.JoinVertical(lipgloss.Left,
+			editorStyle.Render(content),
+			m.renderWhichKey(),
+			statusBar,
+		)
+	}
 	return lipgloss.JoinVertical(lipgloss.Left,
 		editorStyle.Render(content),
 		statusBar,
@@ -66,6 +84,14 @@ func (m Model) renderVisibleLines(lines []string, startLine, endLine int, cursor
 			renderedLine = renderedLine[plainToAnsiIndex(renderedLine, m.horizontalOffset):]
 		}
 
+		if actualLineIndex < len(lines) {
+			skipCol := -1
+			if actualLineIndex == cursor.Line {
+				skipCol = cursor.Column - m.horizontalOffset
+			}
+			renderedLine = m.applyRulers(renderedLine, skipCol)
+		}
+
 		// Apply cursor line styling only to the text content, not line numbers
 		if actualLineIndex == cursor.Line {
 			renderedLine = cursorLineStyle.Render(renderedLine)
@@ -78,6 +104,29 @@ func (m Model) renderVisibleLines(lines []string, startLine, endLine int, cursor
 	return strings.Join(contentLines, "\n")
 }
 
+// applyRulers marks the configured ruler columns, padding short lines so the
+// ruler stays continuous. skipCol leaves the cursor cell untouched.
+func (m Model) applyRulers(line string, skipCol int) string {
+	visibleContentWidth := m.width - 9 // borders 2 + padding 2 + lineNum 4 + space 1
+	for _, ruler := range m.settings.Rulers {
+		col := ruler - m.horizontalOffset
+		if col < 0 || col >= visibleContentWidth || col == skipCol {
+			continue
+		}
+
+		plainLen := len(stripAnsiCodes(line))
+		if col >= plainLen {
+			line += strings.Repeat(" ", col-plainLen) + rulerStyle.Render(" ")
+			continue
+		}
+
+		start := plainToAnsiIndex(line, col)
+		r, size := utf8.DecodeRuneInString(line[start:])
+		line = line[:start] + rulerStyle.Render(string(r)) + line[start+size:]
+	}
+	return line
+}
+
 func (m Model) getRenderedLine(lines []string, lineIndex int, cursor Position, selection *Selection) string {
 	if lineIndex >= len(lines) {
 		return ""
@@ -105,12 +154,66 @@ func (m Model) renderLineWithSelection(line string, lineIndex int, cursor Positi
 	// Apply selection if present - use original plain length for consistency
 	line = m.applySelection(line, lineIndex, plainLen, selection)
 
+	block := m.textBuffer.GetBlock()
+	var blockTail string
+	if block != nil {
+		line, blockTail = m.applyBlock(line, lineIndex, originalPlainLine, *block)
+	}
+
 	// Always render cursor on cursor line (visible or invisible for blinking)
-	if lineIndex == cursor.Line {
-		line = m.applyCursor(line, cursor.Column, originalPlainLine, plainLen)
+	var cursorCols []int
+	if lineIndex == cursor.Line && (block == nil || block.Head.Column < displayWidth(originalPlainLine)) {
+		cursorCols = append(cursorCols, cursor.Column)
+	}
+	for _, c := range m.textBuffer.Carets() {
+		line = m.applySelection(line, lineIndex, plainLen, c.Selection)
+		if c.Pos.Line == lineIndex {
+			cursorCols = append(cursorCols, c.Pos.Column)
+		}
+	}
+	// Right to left, so a cursor past the end of the line cannot shift the
+	// others
+	sort.Sort(sort.Reverse(sort.IntSlice(cursorCols)))
+	for _, col := range cursorCols {
+		line = m.applyCursor(line, col, originalPlainLine, plainLen)
 	}
 
-	return line
+	return line + blockTail
+}
+
+// applyBlock highlights the part of a block selection on lineIndex. The part
+// past the end of the line, and the cursor when the block's head is there,
+// come back separately as tail, to be drawn after the line.
+func (m Model) applyBlock(line string, lineIndex int, plainLine string, b Block) (string, string) {
+	top, bottom, left, right := b.bounds()
+	if lineIndex < top || lineIndex > bottom {
+		return line, ""
+	}
+	start, end, _ := columnSpan(plainLine, left, right)
+	if start < end {
+		line = m.applySelection(line, lineIndex, len(plainLine), &Selection{
+			Start: Position{Line: lineIndex, Column: start},
+			End:   Position{Line: lineIndex, Column: end},
+		})
+	}
+
+	width := displayWidth(plainLine)
+	last := right
+	if lineIndex == b.Head.Line && b.Head.Column >= width {
+		last = max(last, b.Head.Column+1)
+	}
+	var tail strings.Builder
+	for col := width; col < last; col++ {
+		switch {
+		case lineIndex == b.Head.Line && col == b.Head.Column && m.cursorVisible:
+			tail.WriteString(cursorStyle.Render(" "))
+		case col >= left && col < right:
+			tail.WriteString(selectedTextStyle.Render(" "))
+		default:
+			tail.WriteByte(' ')
+		}
+	}
+	return line, tail.String()
 }
 
 func (m Model) applyWordHighlight(highlighted string, start, end int) string {
@@ -260,7 +363,13 @@ func (m Model) getStatusBarFilename() string {
 	}
 
 	if m.modified {
-		return modifiedStyle.Render(filename)
+		filename = modifiedStyle.Render(filename)
+	}
+	if m.vim.enabled {
+		filename = vimModeStyle.Render(m.vim.mode.String()) + "  " + filename
+	}
+	if m.macro.recording {
+		filename = vimModeStyle.Render("REC") + "  " + filename
 	}
 	return filename
 }
@@ -268,16 +377,22 @@ func (m Model) getStatusBarFilename() string {
 func (m Model) getStatusBarCenterInfo() string {
 	cursor := m.textBuffer.GetCursor()
 
-	if m.message != "" && time.Since(m.messageTime) < 3*time.Second {
-		return m.message
+	if len(m.pendingKeys) > 0 {
+		return minibufferPromptStyle.Render(strings.Join(m.pendingKeys, " ") + " …")
+	}
+	if pending := m.vim.pending(); pending != "" {
+		return minibufferPromptStyle.Render(pending)
+	}
+
+	if message, ok := m.activeMessage(); ok {
+		return message
 	}
 
 	return fmt.Sprintf("Line %d, Column %d", cursor.Line+1, cursor.Column+1)
 }
 
 func (m Model) getStatusBarRightInfo() string {
-	lines := m.textBuffer.GetLines()
-	return fmt.Sprintf("Total: %d lines", len(lines))
+	return fmt.Sprintf("%s  Total: %d lines", m.settings.IndentLabel(), m.textBuffer.GetLineCount())
 }
 
 func (m Model) formatStatusBar(left, center, right string) string {
@@ -290,7 +405,7 @@ func (m Model) formatStatusBar(left, center, right string) string {
 	if contentWidth < 30 {
 		// Extremely narrow, just concatenate with single spaces, then hard-set width for consistency.
 		compact := fmt.Sprintf("%s %s %s", left, center, right)
-		rendered := lipgloss.NewStyle().Width(contentWidth).Background(lipgloss.Color("#6f7cbf")).Render(compact)
+		rendered := lipgloss.NewStyle().Width(contentWidth).Background(statusBarStyle.GetBackground()).Render(compact)
 		return statusBarStyle.Render(rendered)
 	}
 
@@ -331,9 +446,9 @@ func (m Model) formatStatusBar(left, center, right string) string {
 		rightRequired = 1
 	}
 
-	leftStyle := lipgloss.NewStyle().Width(leftRequired).Align(lipgloss.Left).Background(lipgloss.Color("#6f7cbf"))
-	centerStyle := lipgloss.NewStyle().Width(centerWidth).Align(lipgloss.Center).Background(lipgloss.Color("#6f7cbf"))
-	rightStyle := lipgloss.NewStyle().Width(rightRequired).Align(lipgloss.Right).Background(lipgloss.Color("#6f7cbf"))
+	leftStyle := lipgloss.NewStyle().Width(leftRequired).Align(lipgloss.Left).Background(statusBarStyle.GetBackground())
+	centerStyle := lipgloss.NewStyle().Width(centerWidth).Align(lipgloss.Center).Background(statusBarStyle.GetBackground())
+	rightStyle := lipgloss.NewStyle().Width(rightRequired).Align(lipgloss.Right).Background(statusBarStyle.GetBackground())
 
 	statusContent := lipgloss.JoinHorizontal(lipgloss.Top,
 		leftStyle.Render(left),
@@ -347,73 +462,6 @@ func (m Model) formatStatusBar(left, center, right string) string {
 	return statusBarStyle.Render(statusContent)
 }
 
-func (m Model) renderHelp() string {
-	const keyColumnWidth = 18
-	// Choose help box width based on current terminal size.
-	// Use 60% of width when wide enough, but never exceed terminal minus 4 cols.
-	maxWidth := m.width * 60 / 100
-	if maxWidth > m.width-4 {
-		maxWidth = m.width - 4
-	}
-	// Ensure a sane minimum so content is readable.
-	if maxWidth < 40 {
-		maxWidth = m.width - 4 // in very narrow terminals just use almost full width
-	}
-
-	contentWidth := maxWidth - 3
-	descWidth := contentWidth - keyColumnWidth - 1
-	var help strings.Builder
-
-	title := helpTitleStyle.Render("Text Editor Help")
-	help.WriteString(lipgloss.PlaceHorizontal(contentWidth, lipgloss.Center, title))
-	help.WriteString("\n\n")
-
-	helpItems := []struct {
-		key  string
-		desc string
-	}{
-		{"Ctrl+S", "Save file"},
-		{"Ctrl+Q", "Quit"},
-		{"Ctrl+C", "Copy selected text"},
-		{"Ctrl+X", "Cut selected text"},
-		{"Ctrl+V", "Paste text"},
-		{"Ctrl+Z", "Undo"},
-		{"Ctrl+Y", "Redo"},
-		{"Ctrl+A", "Select all"},
-		{"Ctrl+F", "Find text (shows results list)"},
-		{"↑/↓", "Navigate through search results"},
-		{"Ctrl+N", "Find next occurrence"},
-		{"Ctrl+L", "Find previous occurrence"},
-		{"Ctrl+G", "Go to line"},
-		{"Shift+Arrow", "Select text"},
-		{"Ctrl+Arrow", "Move by word"},
-		{"Alt+Arrow", "Select by word"},
-		{"Home/End", "Move to line start/end"},
-		{"PgUp/PgDn", "Move by page"},
-		{"Enter", "Confirm action"},
-		{"Escape", "Cancel dialog input"},
-		{"Ctrl+H", "Toggle this help"},
-	}
-
-	for _, item := range helpItems {
-		key := helpKeyStyle.Render(item.key)
-		key = lipgloss.NewStyle().Width(keyColumnWidth).Render(key)
-
-		desc := lipgloss.NewStyle().
-			Width(descWidth).
-			MaxWidth(descWidth).
-			Render(helpDescStyle.Render(item.desc))
-
-		help.WriteString(key + " " + desc + "\n")
-	}
-
-	help.WriteString("\n")
-	footer := helpStyle.Render("Press Ctrl+H again to close help")
-	help.WriteString(lipgloss.PlaceHorizontal(contentWidth, lipgloss.Center, footer))
-
-	return helpBoxStyle.Render(help.String())
-}
-
 func (m Model) padLineToWidth(line string) string {
 	// Ensure the inner content strictly fits within the editor window so the right border is always visible.
 	innerWidth := m.width - 4 // 1 char left border + 1 left padding + 1 right padding + 1 right border
@@ -425,7 +473,7 @@ func (m Model) padLineToWidth(line string) string {
 	return lipgloss.NewStyle().Width(innerWidth).Render(line)
 }
 func (m Model) getVisibleLines() int {
-	minibufferHeight := m.getMinibufferHeight()
+	minibufferHeight := m.getMinibufferHeight() + m.getWhichKeyHeight()
 	visibleLines := m.height - 3 - minibufferHeight
 	if visibleLines < 0 {
 		return 0
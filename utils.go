@@ -1,13 +1,10 @@
 package main
 
 import (
+	"fmt"
 	"os"
-	"os/exec"
 	"runtime"
 	"strings"
-	"syscall"
-	"time"
-	"unsafe"
 )
 
 func max(a, b int) int {
@@ -140,7 +137,7 @@ func (m *Model) ensureCursorVisible() {
 		visibleContentWidth = 1
 	}
 
-	m.horizontalOffset = max(0, cursor.Column - visibleContentWidth/2)
+	m.horizontalOffset = max(0, cursor.Column-visibleContentWidth/2)
 
 	if cursor.Column < m.horizontalOffset {
 		m.horizontalOffset = cursor.Column
@@ -207,89 +204,27 @@ func convertLineEndingsForOS(content string) string {
 	}
 }
 
-// enableWindowsANSI enables ANSI escape sequence processing on Windows terminals
-func enableWindowsANSI() {
-	if runtime.GOOS == "windows" {
-		// Enable ANSI escape sequences on Windows 10+
-		kernel32 := syscall.NewLazyDLL("kernel32.dll")
-		getStdHandle := kernel32.NewProc("GetStdHandle")
-		setConsoleMode := kernel32.NewProc("SetConsoleMode")
-		getConsoleMode := kernel32.NewProc("GetConsoleMode")
-		
-		// Get stdout handle
-		handle, _, _ := getStdHandle.Call(uintptr(^uint32(10) + 1)) // STD_OUTPUT_HANDLE = -11
-		
-		// Get current console mode
-		var mode uint32
-		getConsoleMode.Call(handle, uintptr(unsafe.Pointer(&mode)))
-		
-		// Enable ANSI escape sequences (ENABLE_VIRTUAL_TERMINAL_PROCESSING = 0x0004)
-		mode |= 0x0004
-		setConsoleMode.Call(handle, uintptr(mode))
-	}
-}
-
-// ensureUTF8Output ensures proper UTF-8 output on Windows terminals
-func ensureUTF8Output() {
-	if runtime.GOOS == "windows" {
-		// Set console output code page to UTF-8 (65001)
-		kernel32 := syscall.NewLazyDLL("kernel32.dll")
-		setConsoleOutputCP := kernel32.NewProc("SetConsoleOutputCP")
-		setConsoleOutputCP.Call(uintptr(65001))
-	}
-}
-
 func (m Model) saveFile() error {
 	content := m.textBuffer.GetContent()
-	// Convert line endings to match the target OS
-	content = convertLineEndingsForOS(content)
-	return os.WriteFile(m.filename, []byte(content), 0644)
-}
-
-func copyToClipboard(text string) error {
-	switch runtime.GOOS {
-	case "windows":
-		cmd := exec.Command("powershell", "-command", "Set-Clipboard -Value $args[0]", text)
-		return cmd.Run()
-	case "darwin":
-		cmd := exec.Command("pbcopy")
-		cmd.Stdin = strings.NewReader(text)
-		return cmd.Run()
-	default: // linux and others
-		cmd := exec.Command("xclip", "-selection", "clipboard")
-		cmd.Stdin = strings.NewReader(text)
-		return cmd.Run()
-	}
-}
-
-func pasteFromClipboard() (string, error) {
-	switch runtime.GOOS {
-	case "windows":
-		cmd := exec.Command("powershell", "-command", "Get-Clipboard")
-		output, err := cmd.Output()
+	// Convert line endings to the .editorconfig ones or the target OS's
+	content = convertLineEndings(content, m.settings.EndOfLine)
+	if m.encrypted {
+		// Encrypt in memory so the plaintext never reaches the disk
+		data, err := encryptContainer([]byte(content), m.passphrase)
 		if err != nil {
-			return "", err
+			return err
 		}
-		// Remove trailing CRLF that PowerShell adds
-		result := strings.TrimSuffix(string(output), "\r\n")
-		return result, nil
-	case "darwin":
-		cmd := exec.Command("pbpaste")
-		output, err := cmd.Output()
-		return string(output), err
-	default: // linux and others
-		cmd := exec.Command("xclip", "-selection", "clipboard", "-o")
-		output, err := cmd.Output()
-		return string(output), err
+		return os.WriteFile(m.filename, data, 0600)
 	}
+	data, err := encodeCharset(content, m.settings.Charset)
+	if err != nil {
+		return fmt.Errorf("encode as %s: %w", m.settings.Charset, err)
+	}
+	return os.WriteFile(m.filename, data, 0644)
 }
 
 func (m *Model) updateModified() {
+	m.editSeq++
 	m.modified = m.textBuffer.GetContent() != m.originalText
 	m.applySyntaxHighlighting()
 }
-
-func (m *Model) setMessage(msg string) {
-	m.message = msg
-	m.messageTime = time.Now()
-}
\ No newline at end of file
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// Viewer is a read-only buffer shown over the editor, used for the message
+// history and the debug log.
+type Viewer struct {
+	Title  string
+	Lines  []string
+	scroll int
+}
+
+func (m *Model) openViewer(title string, lines []string) {
+	m.viewer = &Viewer{Title: title, Lines: lines}
+}
+
+// viewerPageSize is the number of lines shown below the title bar and above
+// the status bar.
+func (m Model) viewerPageSize() int {
+	return max(m.height-2, 1)
+}
+
+func (v *Viewer) scrollBy(delta, page int) {
+	v.scroll = clamp(v.scroll+delta, 0, max(len(v.Lines)-page, 0))
+}
+
+func (v *Viewer) scrollToEnd(page int) {
+	v.scroll = max(len(v.Lines)-page, 0)
+}
+
+// handleViewerKey scrolls the viewer and closes it on Esc or q. Editing keys
+// are ignored, so the buffer underneath is never touched.
+func (m Model) handleViewerKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	page := m.viewerPageSize()
+	v := *m.viewer
+	switch msg.String() {
+	case "esc", "q":
+		m.viewer = nil
+		return m, nil
+	case "up", "k":
+		v.scrollBy(-1, page)
+	case "down", "j":
+		v.scrollBy(1, page)
+	case "pgup":
+		v.scrollBy(-page, page)
+	case "pgdown", " ":
+		v.scrollBy(page, page)
+	case "home", "g":
+		v.scroll = 0
+	case "end", "G":
+		v.scrollToEnd(page)
+	}
+	m.viewer = &v
+	return m, nil
+}
+
+func (m Model) renderViewer() string {
+	v := m.viewer
+	page := m.viewerPageSize()
+
+	title := statusBarStyle.Width(m.width).Render(fmt.Sprintf(" %s  [read-only]", v.Title))
+
+	end := min(v.scroll+page, len(v.Lines))
+	var body strings.Builder
+	for i := v.scroll; i < end; i++ {
+		body.WriteString(lipgloss.NewStyle().MaxWidth(m.width).Render(v.Lines[i]))
+		body.WriteString("\n")
+	}
+	for i := end - v.scroll; i < page; i++ {
+		body.WriteString("\n")
+	}
+
+	position := fmt.Sprintf("%d-%d of %d", min(v.scroll+1, end), end, len(v.Lines))
+	footer := m.formatStatusBar(helpStyle.Render("↑/↓ PgUp/PgDn scroll"), position, "Esc/q close")
+	return title + "\n" + body.String() + footer
+}
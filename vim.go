@@ -0,0 +1,697 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// VimMode is the active mode when vim-style modal editing is enabled.
+type VimMode int
+
+const (
+	VimNormal VimMode = iota
+	VimInsert
+	VimVisual
+	VimVisualLine
+)
+
+func (v VimMode) String() string {
+	switch v {
+	case VimInsert:
+		return "INSERT"
+	case VimVisual:
+		return "VISUAL"
+	case VimVisualLine:
+		return "V-LINE"
+	default:
+		return "NORMAL"
+	}
+}
+
+// vimState tracks modal editing. Only the command in progress and the last
+// change are kept; registers other than the unnamed one are not supported.
+type vimState struct {
+	enabled  bool
+	mode     VimMode
+	count    string // digits typed before a command or motion
+	operator string // pending d, c or y
+	opCount  int    // count typed before the operator
+	prefix   string // "g" while waiting for the second key of gg
+	anchor   Position
+
+	keys       []tea.KeyMsg // keys of the command in progress, replayed by '.'
+	lastChange []tea.KeyMsg
+	replaying  bool
+	grouped    bool // an undo group is open for the command in progress
+}
+
+// vimMotion moves the cursor count times. explicit reports whether the user
+// typed a count, which changes the meaning of G and gg.
+type vimMotion struct {
+	move      func(tb *TextBuffer, count int, explicit bool)
+	linewise  bool
+	inclusive bool
+}
+
+var vimMotions = map[string]vimMotion{
+	"h": {move: func(tb *TextBuffer, n int, _ bool) {
+		cursor := tb.GetCursor()
+		tb.SetCursor(Position{Line: cursor.Line, Column: max(cursor.Column-n, 0)})
+	}},
+	"l": {move: func(tb *TextBuffer, n int, _ bool) {
+		// May land past the last character so that x can delete it;
+		// plain motions are clamped back afterwards.
+		cursor := tb.GetCursor()
+		tb.SetCursor(Position{Line: cursor.Line, Column: min(cursor.Column+n, len(tb.GetLine(cursor.Line)))})
+	}},
+	"j": {linewise: true, move: func(tb *TextBuffer, n int, _ bool) {
+		logIgnored(tb.MoveCursorDelta(n, 0, false), "vim motion failed")
+	}},
+	"k": {linewise: true, move: func(tb *TextBuffer, n int, _ bool) {
+		logIgnored(tb.MoveCursorDelta(-n, 0, false), "vim motion failed")
+	}},
+	"w": {move: func(tb *TextBuffer, n int, _ bool) {
+		for i := 0; i < n; i++ {
+			tb.MoveToWordBoundary(true, false)
+		}
+	}},
+	"b": {move: func(tb *TextBuffer, n int, _ bool) {
+		for i := 0; i < n; i++ {
+			tb.MoveToWordBoundary(false, false)
+		}
+	}},
+	"e": {inclusive: true, move: func(tb *TextBuffer, n int, _ bool) {
+		for i := 0; i < n; i++ {
+			vimWordEnd(tb)
+		}
+	}},
+	"0": {move: func(tb *TextBuffer, _ int, _ bool) {
+		tb.SetCursor(Position{Line: tb.GetCursor().Line, Column: 0})
+	}},
+	"$": {inclusive: true, move: func(tb *TextBuffer, n int, _ bool) {
+		if n > 1 {
+			logIgnored(tb.MoveCursorDelta(n-1, 0, false), "vim motion failed")
+		}
+		line := tb.GetCursor().Line
+		tb.SetCursor(Position{Line: line, Column: max(len(tb.GetLine(line))-1, 0)})
+	}},
+	"gg": {linewise: true, move: func(tb *TextBuffer, n int, explicit bool) {
+		if !explicit {
+			n = 1
+		}
+		tb.GoToLine(n - 1)
+	}},
+	"G": {linewise: true, move: func(tb *TextBuffer, n int, explicit bool) {
+		if !explicit {
+			n = tb.GetLineCount()
+		}
+		tb.GoToLine(n - 1)
+	}},
+}
+
+// vimKeyAliases maps special keys onto the equivalent vim motion.
+var vimKeyAliases = map[string]string{
+	"left":      "h",
+	"right":     "l",
+	"up":        "k",
+	"down":      "j",
+	"backspace": "h",
+	"home":      "0",
+	"end":       "$",
+}
+
+// vimWordEnd moves to the end of the current or next word.
+func vimWordEnd(tb *TextBuffer) {
+	isSpaceAt := func(p Position) bool {
+		line := tb.GetLine(p.Line)
+		return p.Column >= len(line) || unicode.IsSpace(rune(line[p.Column]))
+	}
+	lastLine := tb.GetLineCount() - 1
+
+	logIgnored(tb.MoveCursorDelta(0, 1, false), "vim motion failed")
+	for isSpaceAt(tb.GetCursor()) {
+		cursor := tb.GetCursor()
+		if cursor.Line == lastLine && cursor.Column >= len(tb.GetLine(cursor.Line)) {
+			return
+		}
+		logIgnored(tb.MoveCursorDelta(0, 1, false), "vim motion failed")
+	}
+	for {
+		cursor := tb.GetCursor()
+		next := Position{Line: cursor.Line, Column: cursor.Column + 1}
+		if isSpaceAt(next) {
+			return
+		}
+		tb.SetCursor(next)
+	}
+}
+
+func (v *vimState) record(msg tea.KeyMsg) {
+	if !v.replaying {
+		v.keys = append(v.keys, msg)
+	}
+}
+
+// takeCount consumes the typed count, returning 1 when none was given.
+func (v *vimState) takeCount() (int, bool) {
+	explicit := v.count != ""
+	n, err := strconv.Atoi(v.count)
+	if err != nil || n < 1 {
+		n = 1
+	}
+	v.count = ""
+	return n, explicit
+}
+
+// finish ends the current command. Completed changes become the target of '.'.
+func (v *vimState) finish(change bool) {
+	if change && !v.replaying {
+		v.lastChange = v.keys
+	}
+	v.keys = nil
+	v.count = ""
+	v.operator = ""
+	v.opCount = 0
+	v.prefix = ""
+}
+
+// handleVimKey routes a key press through modal editing. It reports false for
+// insert-mode keys that should fall through to normal editing. Each command,
+// including the text typed by one that enters insert mode, is one undo step.
+func (m Model) handleVimKey(msg tea.KeyMsg) (tea.Model, tea.Cmd, bool) {
+	if !m.vim.grouped && !m.vim.replaying {
+		m.textBuffer.BeginUndoGroup()
+		m.vim.grouped = true
+	}
+	m.vim.record(msg)
+	if m.vim.mode == VimInsert {
+		if msg.Type == tea.KeyEscape {
+			m.vimLeaveInsert()
+			m.vimEndUndoGroup()
+			return m, nil, true
+		}
+		return m, nil, false
+	}
+	next, cmd := m.handleVimCommandKey(msg)
+	result := next.(Model)
+	if result.vim.keys == nil {
+		result.vimEndUndoGroup()
+	}
+	return result, cmd, true
+}
+
+// vimEndUndoGroup closes the undo group of the finished command.
+func (m *Model) vimEndUndoGroup() {
+	if m.vim.grouped && !m.vim.replaying {
+		m.textBuffer.EndUndoGroup()
+		m.vim.grouped = false
+	}
+}
+
+func (m Model) handleVimCommandKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	raw := msg.String()
+	k := raw
+	if alias, ok := vimKeyAliases[k]; ok {
+		k = alias
+	}
+
+	if msg.Type == tea.KeyEscape {
+		m.vimEnterNormal()
+		m.vim.finish(false)
+		return m, nil
+	}
+
+	if m.vim.prefix == "g" {
+		m.vim.prefix = ""
+		if k == "g" {
+			return m.vimDoMotion("gg")
+		}
+		m.vim.finish(false)
+		return m, nil
+	}
+
+	if len(raw) == 1 && raw[0] >= '0' && raw[0] <= '9' && (raw != "0" || m.vim.count != "") {
+		m.vim.count += raw
+		return m, nil
+	}
+
+	if _, ok := vimMotions[k]; ok {
+		return m.vimDoMotion(k)
+	}
+	if k == "g" {
+		m.vim.prefix = "g"
+		return m, nil
+	}
+
+	if m.vim.operator != "" {
+		if k == m.vim.operator {
+			return m.vimLineOperator()
+		}
+		m.vim.finish(false)
+		return m, nil
+	}
+
+	if m.vim.mode == VimVisual || m.vim.mode == VimVisualLine {
+		return m.handleVimVisualKey(msg, k)
+	}
+
+	return m.handleVimNormalKey(msg, k)
+}
+
+func (m Model) handleVimNormalKey(msg tea.KeyMsg, k string) (tea.Model, tea.Cmd) {
+	switch k {
+	case "d", "c", "y":
+		m.vim.operator = k
+		m.vim.opCount, _ = m.vim.takeCount()
+		return m, nil
+	case "x", "X", "D", "C", "s":
+		shorthand := map[string][2]string{
+			"x": {"d", "l"}, "X": {"d", "h"}, "D": {"d", "$"}, "C": {"c", "$"}, "s": {"c", "l"},
+		}[k]
+		return m.vimOperatorMotion(shorthand[0], shorthand[1])
+	case "S":
+		m.vim.operator = "c"
+		m.vim.opCount = 1
+		return m.vimLineOperator()
+	case "i", "a", "I", "A", "o", "O":
+		return m.vimInsertCommand(k)
+	case "p", "P":
+		return m.vimPut(k == "P")
+	case "u":
+		m.vim.finish(false)
+		return m.handleUndo()
+	case "ctrl+r":
+		m.vim.finish(false)
+		return m.handleRedo()
+	case "v":
+		m.vimEnterVisual(VimVisual)
+		return m, nil
+	case "V":
+		m.vimEnterVisual(VimVisualLine)
+		return m, nil
+	case ".":
+		return m.vimRepeat()
+	case ":":
+		m.vim.finish(false)
+		m.openCommandLine("")
+		return m, nil
+	}
+
+	// Anything vim does not claim falls back to the regular keymap so
+	// bindings such as save keep working, but never inserts text.
+	m.vim.finish(false)
+	if next, cmd, handled := m.handleKeySequence(msg); handled {
+		return next, cmd
+	}
+	return m, nil
+}
+
+func (m Model) handleVimVisualKey(msg tea.KeyMsg, k string) (tea.Model, tea.Cmd) {
+	switch k {
+	case "d", "x", "c", "y":
+		op := k
+		if op == "x" {
+			op = "d"
+		}
+		return m.vimOperateVisual(op)
+	case "v", "V":
+		mode := VimVisual
+		if k == "V" {
+			mode = VimVisualLine
+		}
+		if m.vim.mode == mode {
+			m.vimEnterNormal()
+		} else {
+			m.vim.mode = mode
+			m.vimUpdateVisualSelection()
+		}
+		m.vim.finish(false)
+		return m, nil
+	case ":":
+		m.vim.finish(false)
+		m.openCommandLine("'<,'>")
+		return m, nil
+	}
+
+	m.vim.finish(false)
+	if next, cmd, handled := m.handleKeySequence(msg); handled {
+		return next, cmd
+	}
+	return m, nil
+}
+
+// vimDoMotion runs a motion, either moving the cursor or, with an operator
+// pending, applying the operator over the text the motion covered.
+func (m Model) vimDoMotion(name string) (tea.Model, tea.Cmd) {
+	count, explicit := m.vim.takeCount()
+	op := m.vim.operator
+	if op != "" && m.vim.opCount > 1 {
+		count *= m.vim.opCount
+		explicit = true
+	}
+
+	// cw behaves like ce, as in vim
+	if op == "c" && name == "w" {
+		name = "e"
+	}
+	motion := vimMotions[name]
+
+	start := m.textBuffer.GetCursor()
+	motion.move(m.textBuffer, count, explicit)
+	end := m.textBuffer.GetCursor()
+
+	if op != "" {
+		// A word motion never pulls the next line into a change
+		if name == "w" && end.Line > start.Line {
+			end = Position{Line: start.Line, Column: len(m.textBuffer.GetLine(start.Line))}
+		}
+		m.textBuffer.SetCursor(start)
+		m.vimApplyOperator(op, start, end, motion.linewise, motion.inclusive)
+		m.postMovementUpdate()
+		return m, nil
+	}
+
+	m.vimClampCursor()
+	if m.vim.mode == VimVisual || m.vim.mode == VimVisualLine {
+		m.vimUpdateVisualSelection()
+		m.vim.keys = nil
+	} else {
+		m.vim.finish(false)
+	}
+	m.postMovementUpdate()
+	return m, nil
+}
+
+// vimOperatorMotion runs a shorthand such as x (dl) or D (d$).
+func (m Model) vimOperatorMotion(op, motion string) (tea.Model, tea.Cmd) {
+	m.vim.operator = op
+	m.vim.opCount, _ = m.vim.takeCount()
+	return m.vimDoMotion(motion)
+}
+
+// vimLineOperator handles doubled operators such as dd, cc and yy.
+func (m Model) vimLineOperator() (tea.Model, tea.Cmd) {
+	count, _ := m.vim.takeCount()
+	count *= max(m.vim.opCount, 1)
+	first := m.textBuffer.GetCursor().Line
+	last := min(first+count-1, m.textBuffer.GetLineCount()-1)
+	m.vimOperateLines(m.vim.operator, first, last)
+	m.postMovementUpdate()
+	return m, nil
+}
+
+func (m *Model) vimApplyOperator(op string, start, end Position, linewise, inclusive bool) {
+	if end.Line < start.Line || (end.Line == start.Line && end.Column < start.Column) {
+		start, end = end, start
+	}
+	if linewise {
+		m.vimOperateLines(op, start.Line, end.Line)
+		return
+	}
+	if inclusive {
+		end.Column = min(end.Column+1, len(m.textBuffer.GetLine(end.Line)))
+	}
+	if start == end {
+		m.vim.finish(false)
+		return
+	}
+
+	m.textBuffer.SetSelection(&Selection{Start: start, End: end})
+	m.vimOperateSelection(op, false)
+}
+
+// vimOperateSelection applies op to the current selection.
+func (m *Model) vimOperateSelection(op string, linewise bool) {
+	m.kill(m.textBuffer.GetSelectedText(), linewise)
+
+	switch op {
+	case "y":
+		start, _ := m.textBuffer.GetSelection().Normalize()
+		m.textBuffer.ClearSelection()
+		m.textBuffer.SetCursor(start)
+		m.vimEnterNormal()
+		m.vim.finish(false)
+	case "d":
+		m.textBuffer.DeleteSelection()
+		m.invalidateHighlightCache()
+		m.updateModified()
+		m.vimEnterNormal()
+		m.vim.finish(true)
+	case "c":
+		m.textBuffer.DeleteSelection()
+		m.invalidateHighlightCache()
+		m.updateModified()
+		m.vim.mode = VimInsert
+	}
+}
+
+// vimOperateLines applies op to whole lines first..last.
+func (m *Model) vimOperateLines(op string, first, last int) {
+	lines := m.textBuffer.GetLines()
+	m.kill(strings.Join(lines[first:last+1], "\n")+"\n", true)
+
+	switch op {
+	case "y":
+		m.vimEnterNormal()
+		m.vim.finish(false)
+		m.setMessage(fmt.Sprintf("%d lines yanked", last-first+1))
+		return
+	case "c":
+		indent := len(lines[first]) - len(strings.TrimLeft(lines[first], " \t"))
+		m.textBuffer.SetSelection(&Selection{
+			Start: Position{Line: first, Column: indent},
+			End:   Position{Line: last, Column: len(lines[last])},
+		})
+		m.textBuffer.DeleteSelection()
+		m.vim.mode = VimInsert
+	case "d":
+		var sel Selection
+		switch {
+		case last < len(lines)-1:
+			sel = Selection{Start: Position{Line: first}, End: Position{Line: last + 1}}
+		case first > 0:
+			sel = Selection{
+				Start: Position{Line: first - 1, Column: len(lines[first-1])},
+				End:   Position{Line: last, Column: len(lines[last])},
+			}
+		default:
+			sel = Selection{End: Position{Line: last, Column: len(lines[last])}}
+		}
+		m.textBuffer.SetSelection(&sel)
+		m.textBuffer.DeleteSelection()
+		line := min(first, m.textBuffer.GetLineCount()-1)
+		m.textBuffer.SetCursor(Position{Line: line, Column: firstNonBlank(m.textBuffer.GetLine(line))})
+		m.vimEnterNormal()
+		m.vim.finish(true)
+	}
+	m.invalidateHighlightCache()
+	m.updateModified()
+}
+
+func (m Model) vimOperateVisual(op string) (tea.Model, tea.Cmd) {
+	if m.vim.mode == VimVisualLine {
+		sel := m.textBuffer.GetSelection()
+		if sel == nil {
+			m.vimEnterNormal()
+			return m, nil
+		}
+		start, end := sel.Normalize()
+		m.textBuffer.ClearSelection()
+		m.textBuffer.SetCursor(Position{Line: start.Line})
+		m.vimOperateLines(op, start.Line, end.Line)
+	} else {
+		m.vimOperateSelection(op, false)
+	}
+	if op != "c" {
+		m.vimEnterNormal()
+	}
+	m.postMovementUpdate()
+	return m, nil
+}
+
+func (m Model) vimInsertCommand(k string) (tea.Model, tea.Cmd) {
+	m.vim.count = ""
+	cursor := m.textBuffer.GetCursor()
+	line := m.textBuffer.GetLine(cursor.Line)
+	var err error
+
+	switch k {
+	case "a":
+		if len(line) > 0 {
+			m.textBuffer.SetCursor(Position{Line: cursor.Line, Column: cursor.Column + 1})
+		}
+	case "I":
+		m.textBuffer.SetCursor(Position{Line: cursor.Line, Column: firstNonBlank(line)})
+	case "A":
+		m.textBuffer.SetCursor(Position{Line: cursor.Line, Column: len(line)})
+	case "o":
+		m.textBuffer.SetCursor(Position{Line: cursor.Line, Column: len(line)})
+		err = m.textBuffer.InsertText("\n")
+	case "O":
+		m.textBuffer.SetCursor(Position{Line: cursor.Line, Column: 0})
+		err = m.textBuffer.InsertText("\n")
+		if err == nil {
+			logIgnored(m.textBuffer.MoveCursorDelta(-1, 0, false), "vim motion failed")
+		}
+	}
+	logIgnored(err, "vim open line failed", "command", k)
+	if err == nil && (k == "o" || k == "O") {
+		m.invalidateHighlightCache()
+		m.updateModified()
+	}
+
+	m.vim.mode = VimInsert
+	m.postMovementUpdate()
+	return m, nil
+}
+
+// vimPut pastes the newest kill ring entry after (p) or before (P) the
+// cursor.
+func (m Model) vimPut(before bool) (tea.Model, tea.Cmd) {
+	count, _ := m.vim.takeCount()
+	entry, ok := m.killRing.current()
+	if !ok {
+		m.vim.finish(false)
+		m.setMessage("Nothing to paste")
+		return m, nil
+	}
+
+	cursor := m.textBuffer.GetCursor()
+	line := m.textBuffer.GetLine(cursor.Line)
+	m.textBuffer.ClearSelection()
+
+	var err error
+	if entry.Linewise {
+		body := strings.TrimSuffix(strings.Repeat(entry.Text, count), "\n")
+		target := cursor.Line
+		if before {
+			m.textBuffer.SetCursor(Position{Line: cursor.Line, Column: 0})
+			err = m.textBuffer.InsertText(body + "\n")
+		} else {
+			m.textBuffer.SetCursor(Position{Line: cursor.Line, Column: len(line)})
+			err = m.textBuffer.InsertText("\n" + body)
+			target++
+		}
+		m.textBuffer.SetCursor(Position{Line: target, Column: firstNonBlank(m.textBuffer.GetLine(target))})
+	} else {
+		if !before && len(line) > 0 {
+			m.textBuffer.SetCursor(Position{Line: cursor.Line, Column: cursor.Column + 1})
+		}
+		err = m.textBuffer.InsertText(strings.Repeat(entry.Text, count))
+		m.vimClampCursor()
+	}
+
+	if err != nil {
+		m.vim.finish(false)
+		m.notify(MessageError, "Error pasting text")
+		return m, nil
+	}
+	m.invalidateHighlightCache()
+	m.updateModified()
+	m.vim.finish(true)
+	m.postMovementUpdate()
+	return m, nil
+}
+
+// vimRepeat replays the keys of the last change.
+func (m Model) vimRepeat() (tea.Model, tea.Cmd) {
+	count := m.vim.count
+	change := m.vim.lastChange
+	m.vim.finish(false)
+	if len(change) == 0 {
+		return m, nil
+	}
+	if count != "" {
+		change = vimWithCount(change, count)
+	}
+
+	m.textBuffer.BeginUndoGroup()
+	defer m.textBuffer.EndUndoGroup()
+	m.vim.replaying = true
+	var next tea.Model = m
+	for _, k := range change {
+		next, _ = next.(Model).handleKey(k)
+	}
+	result := next.(Model)
+	result.vim.replaying = false
+	result.vim.keys = nil
+	return result, nil
+}
+
+// vimWithCount replaces the count typed before a change with count, so that
+// 3. after 2dw deletes three words.
+func vimWithCount(change []tea.KeyMsg, count string) []tea.KeyMsg {
+	i := 0
+	for i < len(change) && change[i].Type == tea.KeyRunes && len(change[i].Runes) == 1 && unicode.IsDigit(change[i].Runes[0]) {
+		i++
+	}
+	keys := make([]tea.KeyMsg, 0, len(count)+len(change)-i)
+	for _, r := range count {
+		keys = append(keys, tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{r}})
+	}
+	return append(keys, change[i:]...)
+}
+
+func (m *Model) vimEnterVisual(mode VimMode) {
+	m.vim.finish(false)
+	m.vim.mode = mode
+	m.vim.anchor = m.textBuffer.GetCursor()
+	m.vimUpdateVisualSelection()
+}
+
+// vimUpdateVisualSelection selects from the anchor to the cursor, inclusive
+// of the character under the cursor, or whole lines in visual-line mode.
+func (m *Model) vimUpdateVisualSelection() {
+	start, end := m.vim.anchor, m.textBuffer.GetCursor()
+	if end.Line < start.Line || (end.Line == start.Line && end.Column < start.Column) {
+		start, end = end, start
+	}
+	if m.vim.mode == VimVisualLine {
+		start.Column = 0
+		end.Column = len(m.textBuffer.GetLine(end.Line))
+	} else {
+		end.Column = min(end.Column+1, len(m.textBuffer.GetLine(end.Line)))
+	}
+	m.textBuffer.SetSelection(&Selection{Start: start, End: end})
+}
+
+func (m *Model) vimEnterNormal() {
+	if m.vim.mode == VimVisual || m.vim.mode == VimVisualLine {
+		m.textBuffer.ClearSelection()
+	}
+	m.vim.mode = VimNormal
+	m.vimClampCursor()
+}
+
+func (m *Model) vimLeaveInsert() {
+	cursor := m.textBuffer.GetCursor()
+	if cursor.Column > 0 {
+		m.textBuffer.SetCursor(Position{Line: cursor.Line, Column: cursor.Column - 1})
+	}
+	m.vim.mode = VimNormal
+	m.vim.finish(true)
+	m.postMovementUpdate()
+}
+
+// vimClampCursor keeps the normal-mode cursor on a character rather than
+// past the end of the line.
+func (m *Model) vimClampCursor() {
+	cursor := m.textBuffer.GetCursor()
+	if n := len(m.textBuffer.GetLine(cursor.Line)); n > 0 && cursor.Column >= n {
+		m.textBuffer.SetCursor(Position{Line: cursor.Line, Column: n - 1})
+	}
+}
+
+// vimPending describes a partially typed command for the status bar.
+func (v vimState) pending() string {
+	return v.count + v.operator + v.prefix
+}
+
+// firstNonBlank returns the column of the first non-whitespace character.
+func firstNonBlank(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " \t"))
+}
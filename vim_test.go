@@ -0,0 +1,47 @@
+package main
+
+import (
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// vimKeys turns a string of normal-mode keys into key presses, with \x1b for
+// Escape.
+func vimKeys(s string) []tea.KeyMsg {
+	var keys []tea.KeyMsg
+	for _, r := range s {
+		if r == '\x1b' {
+			keys = append(keys, tea.KeyMsg{Type: tea.KeyEscape})
+		} else {
+			keys = append(keys, tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{r}})
+		}
+	}
+	return keys
+}
+
+func TestVimUndoSteps(t *testing.T) {
+	tests := []struct {
+		name, keys, want string
+	}{
+		{"change word is one step", "cwnew\x1bu", "one two three four"},
+		{"insert is one step", "ifoo bar\x1bu", "one two three four"},
+		{"dot is one step", "cwnew\x1bw.u", "new two three four"},
+		{"dot takes a count", "dww2.", "two "},
+		{"count replaces the change's count", "2dw.", ""},
+		{"counted dot is one step", "dw2.u", "two three four"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			cfg.VimMode = true
+			m := newTestModel(t, "", cfg)
+			m.textBuffer.SetContent("one two three four")
+			m.textBuffer.SetCursor(Position{})
+			m = pressKeys(m, vimKeys(tt.keys)...)
+			if got := m.textBuffer.GetContent(); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}